@@ -1,39 +1,252 @@
 package cache
 
-import "sync"
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 type CacheInterface[T any] interface {
 	Get(key string) (T, bool)
 	Set(key string, val T)
+	SetWithTTL(key string, val T, ttl time.Duration)
 	Delete(key string)
+	Len() int
+	Keys() []string
+	Range(fn func(key string, val T) bool)
+	GetOrSet(key string, val T) (actual T, loaded bool)
+	Update(key string, fn func(old T, exists bool) T) T
+	CompareAndSwap(key string, old, new T) bool
+	LoadOrCompute(key string, loader func() (T, error)) (T, error)
+}
+
+// entry はキャッシュに保存された値と有効期限
+type entry[T any] struct {
+	val       T
+	expiresAt time.Time // ゼロ値は期限なし
+}
+
+// expired はエントリが時刻nowの時点で期限切れかどうかを返す
+func (e entry[T]) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
 }
 
 type Cache[T any] struct {
-	val map[string]T
-	mu  sync.Mutex
+	val        map[string]entry[T]
+	mu         sync.RWMutex
+	defaultTTL time.Duration
+	now        func() time.Time
+	capacity   int
+	tracker    tracker // 容量上限がない場合はnil
+	codec      Codec   // スナップショットの形式（snapshot.go）
+	stats      counters
+	keys       keyTrie // キーのトピック階層による索引（match.go）
+
+	// 変更通知（events.go）
+	listeners    []listener[T]
+	nextListener int
+	hasListeners atomic.Bool
+	lmu          sync.RWMutex
+	pending      []Event[T] // ロック中に発生し、ロック解放後に通知するイベント
+
+	// LoadOrComputeの実行中の読み込み（ops.go）
+	flights  map[string]*flight[T]
+	flightMu sync.Mutex
+
+	stopJanitor chan struct{}
+	janitorDone chan struct{}
+	closeOnce   sync.Once
+}
+
+// Option はキャッシュのオプション設定を行う関数
+type Option func(*options)
+
+// options はNewに渡されたオプションの設定値
+type options struct {
+	defaultTTL      time.Duration
+	janitorInterval time.Duration
+	capacity        int
+	policy          EvictionPolicy
+	codec           Codec
 }
 
-func New[T any]() *Cache[T] {
-	return &Cache[T]{
-		val: make(map[string]T),
+// WithDefaultTTL はSetで保存したエントリの有効期限を設定する（0以下は期限なし）
+func WithDefaultTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.defaultTTL = ttl
 	}
 }
 
+// WithJanitor は期限切れエントリを一定間隔で削除するバックグラウンド処理を有効にする
+// 開始した処理はCloseで停止する
+func WithJanitor(interval time.Duration) Option {
+	return func(o *options) {
+		o.janitorInterval = interval
+	}
+}
+
+func New[T any](opts ...Option) *Cache[T] {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	c := &Cache[T]{
+		val:        make(map[string]entry[T]),
+		defaultTTL: o.defaultTTL,
+		now:        time.Now,
+		codec:      o.codec,
+	}
+	if c.codec == nil {
+		c.codec = GobCodec
+	}
+	if o.capacity > 0 {
+		c.capacity = o.capacity
+		c.tracker = newTracker(o.policy)
+	}
+	if o.janitorInterval > 0 {
+		c.startJanitor(o.janitorInterval)
+	}
+	return c
+}
+
+// Get は値を返す。期限切れのエントリは取得時に削除される
 func (c *Cache[T]) Get(key string) (T, bool) {
+	// 参照順を記録しない場合は読み取りロックのみで取得する
+	if c.tracker == nil {
+		c.mu.RLock()
+		e, ok := c.val[key]
+		c.mu.RUnlock()
+		if !ok {
+			c.stats.misses.Add(1)
+			var zero T
+			return zero, false
+		}
+		if !e.expired(c.now()) {
+			c.stats.hits.Add(1)
+			return e.val, true
+		}
+	}
+
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	val, ok := c.val[key]
-	return val, ok
+	defer c.unlockAndEmit()
+	e, ok := c.getLocked(key)
+	c.stats.countLookup(ok)
+	return e.val, ok
 }
 
+// Set はデフォルトの有効期限で値を保存する
 func (c *Cache[T]) Set(key string, val T) {
+	c.SetWithTTL(key, val, c.defaultTTL)
+}
+
+// SetWithTTL は有効期限を指定して値を保存する（0以下は期限なし）
+func (c *Cache[T]) SetWithTTL(key string, val T, ttl time.Duration) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.val[key] = val
+	defer c.unlockAndEmit()
+	c.setLocked(key, val, ttl)
+}
+
+// setLocked は値を保存し、必要に応じて古い値や容量超過分を追い出す
+// ロックが既に取得された状態で呼び出される内部メソッド
+func (c *Cache[T]) setLocked(key string, val T, ttl time.Duration) {
+	now := c.now()
+	e := entry[T]{val: val}
+	if ttl > 0 {
+		e.expiresAt = now.Add(ttl)
+	}
+
+	old, exists := c.val[key]
+	if exists {
+		reason := EvictReplaced
+		if old.expired(now) {
+			reason = EvictExpired
+		}
+		c.stats.countRemoval(reason)
+		c.record(Event[T]{Type: EventEvict, Key: key, Value: old.val, Reason: reason})
+	}
+
+	if c.tracker != nil {
+		if !exists {
+			// 容量上限に達している場合は方針に従って追い出す
+			for len(c.val) >= c.capacity {
+				victim, ok := c.tracker.victim()
+				if !ok {
+					break
+				}
+				c.removeLocked(victim, EvictCapacity)
+			}
+		}
+		c.tracker.add(key)
+	}
+	if !exists {
+		c.keys.insert(key)
+	}
+	c.val[key] = e
+	c.stats.sets.Add(1)
+	c.record(Event[T]{Type: EventSet, Key: key, Value: val})
 }
 
 func (c *Cache[T]) Delete(key string) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.unlockAndEmit()
+	c.removeLocked(key, EvictDeleted)
+}
+
+// removeLocked はエントリを削除する
+// ロックが既に取得された状態で呼び出される内部メソッド
+func (c *Cache[T]) removeLocked(key string, reason EvictReason) {
+	e, exists := c.val[key]
+	if !exists {
+		return
+	}
 	delete(c.val, key)
+	c.keys.remove(key)
+	if c.tracker != nil {
+		c.tracker.remove(key)
+	}
+	c.stats.countRemoval(reason)
+	c.record(Event[T]{Type: EventEvict, Key: key, Value: e.val, Reason: reason})
+}
+
+// DeleteExpired は期限切れのエントリをすべて削除する
+func (c *Cache[T]) DeleteExpired() {
+	c.mu.Lock()
+	defer c.unlockAndEmit()
+	now := c.now()
+	for key, e := range c.val {
+		if e.expired(now) {
+			c.removeLocked(key, EvictExpired)
+		}
+	}
+}
+
+// Close はバックグラウンドの期限切れ削除処理を停止する
+// WithJanitorを指定していない場合は何もしない
+func (c *Cache[T]) Close() {
+	c.closeOnce.Do(func() {
+		if c.stopJanitor != nil {
+			close(c.stopJanitor)
+			<-c.janitorDone
+		}
+	})
+}
+
+// startJanitor は期限切れ削除処理のゴルーチンを開始する
+func (c *Cache[T]) startJanitor(interval time.Duration) {
+	c.stopJanitor = make(chan struct{})
+	c.janitorDone = make(chan struct{})
+	go func() {
+		defer close(c.janitorDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				c.DeleteExpired()
+			case <-c.stopJanitor:
+				return
+			}
+		}
+	}()
 }
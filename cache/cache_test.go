@@ -3,6 +3,7 @@ package cache
 import (
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestCache_Basic(t *testing.T) {
@@ -123,7 +124,8 @@ func TestCache_Concurrency_ReadWrite(t *testing.T) {
 	}
 
 	// 同期用チャネル
-	done := make(chan bool)
+	// 同じゴルーチンで送信してから受信するため、バッファがないと送信がブロックしてデッドロックする
+	done := make(chan bool, 1)
 	var wg sync.WaitGroup
 
 	// 複数のリーダーを作成
@@ -174,9 +176,17 @@ func TestCache_Concurrency_ReadWrite(t *testing.T) {
 
 // モックキャッシュの実装（インターフェースに対するテスト用）
 type MockCache[T any] struct {
-	GetFunc    func(key string) (T, bool)
-	SetFunc    func(key string, val T)
-	DeleteFunc func(key string)
+	GetFunc            func(key string) (T, bool)
+	SetFunc            func(key string, val T)
+	SetWithTTLFunc     func(key string, val T, ttl time.Duration)
+	DeleteFunc         func(key string)
+	LenFunc            func() int
+	KeysFunc           func() []string
+	RangeFunc          func(fn func(key string, val T) bool)
+	GetOrSetFunc       func(key string, val T) (T, bool)
+	UpdateFunc         func(key string, fn func(old T, exists bool) T) T
+	CompareAndSwapFunc func(key string, old, new T) bool
+	LoadOrComputeFunc  func(key string, loader func() (T, error)) (T, error)
 }
 
 func (m *MockCache[T]) Get(key string) (T, bool) {
@@ -187,10 +197,42 @@ func (m *MockCache[T]) Set(key string, val T) {
 	m.SetFunc(key, val)
 }
 
+func (m *MockCache[T]) SetWithTTL(key string, val T, ttl time.Duration) {
+	m.SetWithTTLFunc(key, val, ttl)
+}
+
 func (m *MockCache[T]) Delete(key string) {
 	m.DeleteFunc(key)
 }
 
+func (m *MockCache[T]) Len() int {
+	return m.LenFunc()
+}
+
+func (m *MockCache[T]) Keys() []string {
+	return m.KeysFunc()
+}
+
+func (m *MockCache[T]) Range(fn func(key string, val T) bool) {
+	m.RangeFunc(fn)
+}
+
+func (m *MockCache[T]) GetOrSet(key string, val T) (T, bool) {
+	return m.GetOrSetFunc(key, val)
+}
+
+func (m *MockCache[T]) Update(key string, fn func(old T, exists bool) T) T {
+	return m.UpdateFunc(key, fn)
+}
+
+func (m *MockCache[T]) CompareAndSwap(key string, old, new T) bool {
+	return m.CompareAndSwapFunc(key, old, new)
+}
+
+func (m *MockCache[T]) LoadOrCompute(key string, loader func() (T, error)) (T, error) {
+	return m.LoadOrComputeFunc(key, loader)
+}
+
 func TestCacherInterface(t *testing.T) {
 	// インターフェースを使用したテスト
 	var c CacheInterface[string]
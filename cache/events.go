@@ -0,0 +1,167 @@
+package cache
+
+import "sync"
+
+// EvictReason はエントリがキャッシュから外れた理由
+type EvictReason int
+
+const (
+	// EvictExpired は有効期限切れによる削除
+	EvictExpired EvictReason = iota + 1
+	// EvictCapacity は容量上限による追い出し
+	EvictCapacity
+	// EvictDeleted はDeleteによる削除
+	EvictDeleted
+	// EvictReplaced は同じキーへの上書きによる置き換え
+	EvictReplaced
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictExpired:
+		return "expired"
+	case EvictCapacity:
+		return "capacity"
+	case EvictDeleted:
+		return "deleted"
+	case EvictReplaced:
+		return "replaced"
+	default:
+		return "unknown"
+	}
+}
+
+// EventType は変更通知の種類
+type EventType int
+
+const (
+	// EventSet は値の保存
+	EventSet EventType = iota + 1
+	// EventEvict はエントリの削除・置き換え
+	EventEvict
+)
+
+// Event はキャッシュの変更通知
+type Event[T any] struct {
+	Type   EventType
+	Key    string
+	Value  T           // EventSetでは保存された値、EventEvictでは外れた値
+	Reason EvictReason // EventEvictのみ
+}
+
+// listener は登録された通知先
+type listener[T any] struct {
+	id int
+	fn func(Event[T])
+}
+
+// OnEvict はエントリがキャッシュから外れたときに呼び出される関数を登録する
+// 関数はキャッシュのロックを解放した後に、操作したゴルーチンで呼び出される
+func (c *Cache[T]) OnEvict(fn func(key string, val T, reason EvictReason)) {
+	c.addListener(func(e Event[T]) {
+		if e.Type == EventEvict {
+			fn(e.Key, e.Value, e.Reason)
+		}
+	})
+}
+
+// OnSet は値が保存されたときに呼び出される関数を登録する
+// 上書きの場合は、先に古い値についてEvictReplacedのOnEvictが呼び出される
+func (c *Cache[T]) OnSet(fn func(key string, val T)) {
+	c.addListener(func(e Event[T]) {
+		if e.Type == EventSet {
+			fn(e.Key, e.Value)
+		}
+	})
+}
+
+// Watch は変更通知を受け取るチャネルを返す
+// 受信側が追いつかずバッファが一杯の場合、通知は破棄される
+// 返された関数を呼び出すと購読を解除し、チャネルを閉じる
+func (c *Cache[T]) Watch(buffer int) (<-chan Event[T], func()) {
+	ch, fn, closeCh := newWatcher[T](buffer)
+	remove := c.addListener(fn)
+	return ch, func() {
+		remove()
+		closeCh()
+	}
+}
+
+// newWatcher はWatch用のチャネルと送信関数、チャネルを閉じる関数を作成
+func newWatcher[T any](buffer int) (<-chan Event[T], func(Event[T]), func()) {
+	ch := make(chan Event[T], buffer)
+	var mu sync.Mutex
+	closed := false
+
+	send := func(e Event[T]) {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+	closeCh := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if !closed {
+			closed = true
+			close(ch)
+		}
+	}
+	return ch, send, closeCh
+}
+
+// addListener は通知先を登録し、登録を解除する関数を返す
+func (c *Cache[T]) addListener(fn func(Event[T])) func() {
+	c.lmu.Lock()
+	defer c.lmu.Unlock()
+
+	c.nextListener++
+	id := c.nextListener
+	c.listeners = append(c.listeners, listener[T]{id: id, fn: fn})
+	c.hasListeners.Store(true)
+
+	return func() {
+		c.lmu.Lock()
+		defer c.lmu.Unlock()
+		for i, l := range c.listeners {
+			if l.id == id {
+				c.listeners = append(c.listeners[:i:i], c.listeners[i+1:]...)
+				break
+			}
+		}
+		c.hasListeners.Store(len(c.listeners) > 0)
+	}
+}
+
+// record はロック中に発生したイベントを保留する
+// 通知先がない場合は何もしない
+func (c *Cache[T]) record(e Event[T]) {
+	if c.hasListeners.Load() {
+		c.pending = append(c.pending, e)
+	}
+}
+
+// unlockAndEmit はロックを解放してから保留中のイベントを通知する
+func (c *Cache[T]) unlockAndEmit() {
+	events := c.pending
+	c.pending = nil
+	c.mu.Unlock()
+
+	if len(events) == 0 {
+		return
+	}
+	c.lmu.RLock()
+	listeners := c.listeners
+	c.lmu.RUnlock()
+
+	for _, e := range events {
+		for _, l := range listeners {
+			l.fn(e)
+		}
+	}
+}
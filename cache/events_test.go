@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// evictRecord はOnEvictで受け取った内容
+type evictRecord struct {
+	key    string
+	val    int
+	reason EvictReason
+}
+
+func TestCache_OnEvictReasons(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	c := NewLRU[int](2)
+	withClock(c, clock)
+
+	var mu sync.Mutex
+	var evicted []evictRecord
+	c.OnEvict(func(key string, val int, reason EvictReason) {
+		mu.Lock()
+		defer mu.Unlock()
+		evicted = append(evicted, evictRecord{key, val, reason})
+	})
+
+	c.Set("a", 1)
+	c.Set("a", 2)                     // replaced
+	c.SetWithTTL("b", 3, time.Second) // 追加
+	c.Set("c", 4)                     // capacity（aが最も古い）
+	clock.advance(2 * time.Second)
+	c.Get("b")          // expired
+	c.Delete("c")       // deleted
+	c.Delete("missing") // 存在しないキーは通知しない
+
+	want := []evictRecord{
+		{"a", 1, EvictReplaced},
+		{"a", 2, EvictCapacity},
+		{"b", 3, EvictExpired},
+		{"c", 4, EvictDeleted},
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(evicted) != len(want) {
+		t.Fatalf("OnEvict呼び出し = %v、期待値は %v", evicted, want)
+	}
+	for i := range want {
+		if evicted[i] != want[i] {
+			t.Errorf("OnEvict[%d] = %+v、期待値は %+v", i, evicted[i], want[i])
+		}
+	}
+}
+
+func TestCache_OnSet(t *testing.T) {
+	c := New[string]()
+
+	var keys []string
+	c.OnSet(func(key string, val string) {
+		keys = append(keys, key+"="+val)
+		// コールバック内からキャッシュを操作してもデッドロックしない
+		c.Get(key)
+	})
+
+	c.Set("a", "1")
+	c.Set("a", "2")
+	c.SetWithTTL("b", "3", time.Minute)
+
+	want := []string{"a=1", "a=2", "b=3"}
+	if len(keys) != len(want) {
+		t.Fatalf("OnSet呼び出し = %v、期待値は %v", keys, want)
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("OnSet[%d] = %s、期待値は %s", i, keys[i], want[i])
+		}
+	}
+}
+
+func TestCache_ExpiredOnOverwriteAndJanitor(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	c := New[int]()
+	withClock(c, clock)
+
+	var reasons []EvictReason
+	c.OnEvict(func(_ string, _ int, reason EvictReason) {
+		reasons = append(reasons, reason)
+	})
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.SetWithTTL("b", 2, time.Second)
+	clock.advance(2 * time.Second)
+
+	// 期限切れのエントリへの上書きは置き換えではなく期限切れとして通知する
+	c.Set("a", 10)
+	c.DeleteExpired()
+
+	if len(reasons) != 2 || reasons[0] != EvictExpired || reasons[1] != EvictExpired {
+		t.Errorf("削除理由 = %v、期待値は [expired expired]", reasons)
+	}
+}
+
+func TestCache_Watch(t *testing.T) {
+	c := New[int]()
+	ch, cancel := c.Watch(10)
+
+	c.Set("a", 1)
+	c.Delete("a")
+
+	e := <-ch
+	if e.Type != EventSet || e.Key != "a" || e.Value != 1 {
+		t.Errorf("1件目のイベント = %+v、期待値は Set a=1", e)
+	}
+	e = <-ch
+	if e.Type != EventEvict || e.Reason != EvictDeleted {
+		t.Errorf("2件目のイベント = %+v、期待値は Evict deleted", e)
+	}
+
+	cancel()
+	cancel() // 複数回呼び出しても安全
+	c.Set("b", 2)
+	if _, ok := <-ch; ok {
+		t.Error("購読解除後もイベントを受信した")
+	}
+	if c.hasListeners.Load() {
+		t.Error("購読解除後も通知先が残っている")
+	}
+}
+
+func TestCache_WatchDropsWhenFull(t *testing.T) {
+	c := New[int]()
+	ch, cancel := c.Watch(1)
+	defer cancel()
+
+	// バッファを超えた通知は破棄され、Setはブロックしない
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			c.Set("a", i)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("受信されない通知でSetがブロックした")
+	}
+	if len(ch) != 1 {
+		t.Errorf("バッファ内のイベント数 = %d、期待値は 1", len(ch))
+	}
+}
+
+func TestSharded_Watch(t *testing.T) {
+	s := NewSharded[int](4)
+	ch, cancel := s.Watch(100)
+	defer cancel()
+
+	var evicted []string
+	s.OnEvict(func(key string, _ int, reason EvictReason) {
+		evicted = append(evicted, key+":"+reason.String())
+	})
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		s.Set(key, 1)
+	}
+	s.Delete("c")
+
+	if len(ch) != 6 {
+		t.Errorf("受信したイベント数 = %d、期待値は 6", len(ch))
+	}
+	if len(evicted) != 1 || evicted[0] != "c:deleted" {
+		t.Errorf("OnEvict呼び出し = %v、期待値は [c:deleted]", evicted)
+	}
+}
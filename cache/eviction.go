@@ -0,0 +1,179 @@
+package cache
+
+import (
+	"container/list"
+	"slices"
+)
+
+// EvictionPolicy は容量上限に達したときに追い出すエントリを選ぶ方針
+type EvictionPolicy int
+
+const (
+	// LRU は最も長く参照されていないエントリを追い出す
+	LRU EvictionPolicy = iota
+	// LFU は参照回数が最も少ないエントリを追い出す（同数の場合は最も長く参照されていないもの）
+	LFU
+)
+
+// WithCapacity はエントリ数の上限と追い出し方針を設定する（0以下は上限なし）
+func WithCapacity(capacity int, policy EvictionPolicy) Option {
+	return func(o *options) {
+		o.capacity = capacity
+		o.policy = policy
+	}
+}
+
+// NewLRU は容量上限付きのLRUキャッシュを作成
+func NewLRU[T any](capacity int, opts ...Option) *Cache[T] {
+	return New[T](slices.Concat(opts, []Option{WithCapacity(capacity, LRU)})...)
+}
+
+// NewLFU は容量上限付きのLFUキャッシュを作成
+func NewLFU[T any](capacity int, opts ...Option) *Cache[T] {
+	return New[T](slices.Concat(opts, []Option{WithCapacity(capacity, LFU)})...)
+}
+
+// tracker はキーの参照状況を記録し、追い出すキーを選ぶ
+// Cacheのロックが取得された状態で呼び出される
+type tracker interface {
+	add(key string)
+	access(key string)
+	remove(key string)
+	victim() (string, bool)
+}
+
+// newTracker は追い出し方針に対応するtrackerを作成
+func newTracker(policy EvictionPolicy) tracker {
+	if policy == LFU {
+		return newLFUTracker()
+	}
+	return newLRUTracker()
+}
+
+// lruTracker は参照順のリストでLRUを実装する（先頭が最も新しい）
+type lruTracker struct {
+	order *list.List
+	elems map[string]*list.Element
+}
+
+func newLRUTracker() *lruTracker {
+	return &lruTracker{
+		order: list.New(),
+		elems: make(map[string]*list.Element),
+	}
+}
+
+func (t *lruTracker) add(key string) {
+	if e, ok := t.elems[key]; ok {
+		t.order.MoveToFront(e)
+		return
+	}
+	t.elems[key] = t.order.PushFront(key)
+}
+
+func (t *lruTracker) access(key string) {
+	if e, ok := t.elems[key]; ok {
+		t.order.MoveToFront(e)
+	}
+}
+
+func (t *lruTracker) remove(key string) {
+	if e, ok := t.elems[key]; ok {
+		t.order.Remove(e)
+		delete(t.elems, key)
+	}
+}
+
+func (t *lruTracker) victim() (string, bool) {
+	e := t.order.Back()
+	if e == nil {
+		return "", false
+	}
+	return e.Value.(string), true
+}
+
+// lfuTracker は参照回数ごとのリストでLFUを実装する
+// 各リストは先頭が最も新しく参照されたキー
+type lfuTracker struct {
+	nodes   map[string]*lfuNode
+	freqs   map[int]*list.List
+	minFreq int
+}
+
+type lfuNode struct {
+	freq int
+	elem *list.Element
+}
+
+func newLFUTracker() *lfuTracker {
+	return &lfuTracker{
+		nodes: make(map[string]*lfuNode),
+		freqs: make(map[int]*list.List),
+	}
+}
+
+func (t *lfuTracker) add(key string) {
+	if _, ok := t.nodes[key]; ok {
+		t.access(key)
+		return
+	}
+	t.nodes[key] = &lfuNode{freq: 1, elem: t.push(1, key)}
+	t.minFreq = 1
+}
+
+func (t *lfuTracker) access(key string) {
+	n, ok := t.nodes[key]
+	if !ok {
+		return
+	}
+	t.unlink(n)
+	n.freq++
+	n.elem = t.push(n.freq, key)
+}
+
+func (t *lfuTracker) remove(key string) {
+	if n, ok := t.nodes[key]; ok {
+		t.unlink(n)
+		delete(t.nodes, key)
+	}
+}
+
+func (t *lfuTracker) victim() (string, bool) {
+	if len(t.nodes) == 0 {
+		return "", false
+	}
+	l, ok := t.freqs[t.minFreq]
+	if !ok {
+		// 削除によって最小参照回数のリストが空になった場合は探し直す
+		t.minFreq = 0
+		for f := range t.freqs {
+			if t.minFreq == 0 || f < t.minFreq {
+				t.minFreq = f
+			}
+		}
+		l = t.freqs[t.minFreq]
+	}
+	return l.Back().Value.(string), true
+}
+
+// push は参照回数freqのリストの先頭にキーを追加
+func (t *lfuTracker) push(freq int, key string) *list.Element {
+	l, ok := t.freqs[freq]
+	if !ok {
+		l = list.New()
+		t.freqs[freq] = l
+	}
+	return l.PushFront(key)
+}
+
+// unlink はノードを現在の参照回数のリストから外す
+func (t *lfuTracker) unlink(n *lfuNode) {
+	l := t.freqs[n.freq]
+	l.Remove(n.elem)
+	if l.Len() == 0 {
+		delete(t.freqs, n.freq)
+		if t.minFreq == n.freq {
+			t.minFreq = n.freq + 1
+		}
+	}
+}
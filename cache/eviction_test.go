@@ -0,0 +1,147 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestCache_LRUEviction(t *testing.T) {
+	c := NewLRU[int](3)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+
+	// aを参照するとbが最も古くなる
+	c.Get("a")
+	c.Set("d", 4)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("最も長く参照されていないbが追い出されていない")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s が追い出された", key)
+		}
+	}
+
+	// 既存キーの上書きでは追い出さない
+	c.Set("a", 10)
+	if len(c.val) != 3 {
+		t.Errorf("エントリ数 = %d、期待値は 3", len(c.val))
+	}
+
+	// 上書きも参照として扱う（c → d → a の順で古い）
+	c.Set("e", 5)
+	if _, ok := c.Get("c"); ok {
+		t.Error("最も長く参照されていないcが追い出されていない")
+	}
+}
+
+func TestCache_LFUEviction(t *testing.T) {
+	c := NewLFU[int](3)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+
+	c.Get("a")
+	c.Get("a")
+	c.Get("b")
+
+	// 参照回数が最も少ないcが追い出される
+	c.Set("d", 4)
+	if _, ok := c.Get("c"); ok {
+		t.Error("参照回数が最も少ないcが追い出されていない")
+	}
+
+	// 参照回数が同じ場合は最も長く参照されていないものを追い出す
+	// b: 3回（Set, Get, Get）、d: 2回（Set, Get）、a: 3回
+	c.Get("d")
+	c.Get("b")
+	c.Set("e", 5)
+	if _, exists := c.val["d"]; exists {
+		t.Error("参照回数が最も少ないdが追い出されていない")
+	}
+	if _, exists := c.val["e"]; !exists {
+		t.Error("追加したeが存在しない")
+	}
+
+	// 削除後も正しく追い出し対象を選べる
+	c.Delete("e")
+	c.Set("f", 6)
+	c.Set("g", 7)
+	if len(c.val) != 3 {
+		t.Errorf("エントリ数 = %d、期待値は 3", len(c.val))
+	}
+	if _, exists := c.val["f"]; exists {
+		t.Error("参照回数が最も少ないfが追い出されていない")
+	}
+}
+
+func TestCache_EvictionConcurrent(t *testing.T) {
+	for _, policy := range []EvictionPolicy{LRU, LFU} {
+		t.Run(fmt.Sprintf("policy=%d", policy), func(t *testing.T) {
+			const capacity = 50
+			c := New[int](WithCapacity(capacity, policy))
+
+			// ホットキーは全ゴルーチンから頻繁に参照される
+			c.Set("hot", -1)
+
+			var wg sync.WaitGroup
+			for w := 0; w < 8; w++ {
+				wg.Add(1)
+				go func(id int) {
+					defer wg.Done()
+					for i := 0; i < 1000; i++ {
+						c.Set(fmt.Sprintf("key-%d-%d", id, i), i)
+						c.Get("hot")
+						if i%3 == 0 {
+							c.Delete(fmt.Sprintf("key-%d-%d", id, i-1))
+						}
+					}
+				}(w)
+			}
+			wg.Wait()
+
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			if len(c.val) > capacity {
+				t.Errorf("エントリ数 = %d、容量上限 %d を超えている", len(c.val), capacity)
+			}
+			if _, exists := c.val["hot"]; !exists {
+				t.Error("頻繁に参照されたキーが追い出された")
+			}
+
+			// trackerとマップの内容が一致していること
+			for n := len(c.val); n > 0; n-- {
+				victim, ok := c.tracker.victim()
+				if !ok {
+					t.Fatal("trackerにキーが残っていない")
+				}
+				if _, exists := c.val[victim]; !exists {
+					t.Errorf("trackerの追い出し対象 %s がマップに存在しない", victim)
+				}
+				c.removeLocked(victim, EvictDeleted)
+			}
+			if _, ok := c.tracker.victim(); ok {
+				t.Error("すべて削除した後もtrackerにキーが残っている")
+			}
+		})
+	}
+}
+
+func TestCache_CapacityWithTTL(t *testing.T) {
+	c := NewLRU[string](2, WithDefaultTTL(0))
+	c.Set("a", "1")
+	c.Set("b", "2")
+	c.Set("c", "3")
+
+	if len(c.val) != 2 {
+		t.Errorf("エントリ数 = %d、期待値は 2", len(c.val))
+	}
+	if _, ok := c.Get("a"); ok {
+		t.Error("最も古いaが追い出されていない")
+	}
+}
@@ -0,0 +1,182 @@
+package cache
+
+import "strings"
+
+// Match はMQTTのトピックフィルターにキーが一致する有効期限内のエントリを返す
+//
+// キーを "/" 区切りのトピックとして扱い、+ は1レベル、# は残りすべてのレベル
+// （親レベル自体を含む）に一致する。$で始まるキーは先頭のワイルドカードに一致しない
+// キーのトピック階層による索引を使用するため、全件の走査は行わない
+func (c *Cache[T]) Match(filter string) map[string]T {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := c.now()
+	result := make(map[string]T)
+	c.keys.match(filter, func(key string) {
+		if e, ok := c.val[key]; ok && !e.expired(now) {
+			result[key] = e.val
+		}
+	})
+	return result
+}
+
+// DeletePrefix はキーがprefixで始まるエントリをすべて削除し、削除した件数を返す
+// prefixは文字列としての前方一致で、"site1/" は "site1" 自体を含まない
+func (c *Cache[T]) DeletePrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.unlockAndEmit()
+
+	var keys []string
+	c.keys.prefix(prefix, func(key string) {
+		keys = append(keys, key)
+	})
+	for _, key := range keys {
+		c.removeLocked(key, EvictDeleted)
+	}
+	return len(keys)
+}
+
+// Match はすべてのシャードからトピックフィルターに一致するエントリを返す
+func (s *Sharded[T]) Match(filter string) map[string]T {
+	result := make(map[string]T)
+	for _, c := range s.shards {
+		for key, val := range c.Match(filter) {
+			result[key] = val
+		}
+	}
+	return result
+}
+
+// DeletePrefix はすべてのシャードからキーがprefixで始まるエントリを削除し、削除した件数を返す
+func (s *Sharded[T]) DeletePrefix(prefix string) int {
+	n := 0
+	for _, c := range s.shards {
+		n += c.DeletePrefix(prefix)
+	}
+	return n
+}
+
+// keyTrie はキーを "/" 区切りのレベルごとに保持するトライ木
+// Cacheのロックが取得された状態で呼び出される
+type keyTrie struct {
+	root trieNode
+}
+
+// trieNode はトライ木の1レベル
+type trieNode struct {
+	children map[string]*trieNode
+	terminal bool // このノードまでのレベルがキーとして存在するか
+}
+
+// insert はキーを追加する
+func (t *keyTrie) insert(key string) {
+	n := &t.root
+	for _, level := range strings.Split(key, "/") {
+		child, ok := n.children[level]
+		if !ok {
+			if n.children == nil {
+				n.children = make(map[string]*trieNode)
+			}
+			child = &trieNode{}
+			n.children[level] = child
+		}
+		n = child
+	}
+	n.terminal = true
+}
+
+// remove はキーを削除し、不要になったノードを取り除く
+func (t *keyTrie) remove(key string) {
+	levels := strings.Split(key, "/")
+	path := make([]*trieNode, 0, len(levels)+1)
+	n := &t.root
+	path = append(path, n)
+	for _, level := range levels {
+		child, ok := n.children[level]
+		if !ok {
+			return
+		}
+		n = child
+		path = append(path, n)
+	}
+	n.terminal = false
+
+	// 葉から順に、キーでも分岐でもないノードを削除する
+	for i := len(levels); i > 0; i-- {
+		node := path[i]
+		if node.terminal || len(node.children) > 0 {
+			return
+		}
+		delete(path[i-1].children, levels[i-1])
+	}
+}
+
+// match はトピックフィルターに一致するキーについてfnを呼び出す
+func (t *keyTrie) match(filter string, fn func(key string)) {
+	t.root.match(strings.Split(filter, "/"), 0, nil, fn)
+}
+
+func (n *trieNode) match(filter []string, depth int, path []string, fn func(key string)) {
+	if depth == len(filter) {
+		if n.terminal {
+			fn(strings.Join(path, "/"))
+		}
+		return
+	}
+
+	switch f := filter[depth]; f {
+	case "#":
+		if depth == len(filter)-1 {
+			n.each(path, depth == 0, fn)
+		}
+	case "+":
+		for level, child := range n.children {
+			if depth == 0 && strings.HasPrefix(level, "$") {
+				continue
+			}
+			child.match(filter, depth+1, append(path, level), fn)
+		}
+	default:
+		if child, ok := n.children[f]; ok {
+			child.match(filter, depth+1, append(path, f), fn)
+		}
+	}
+}
+
+// each はこのノード以下のすべてのキーについてfnを呼び出す
+// skipSysがtrueの場合、$で始まる子レベルを除外する
+func (n *trieNode) each(path []string, skipSys bool, fn func(key string)) {
+	if n.terminal && len(path) > 0 {
+		fn(strings.Join(path, "/"))
+	}
+	for level, child := range n.children {
+		if skipSys && strings.HasPrefix(level, "$") {
+			continue
+		}
+		child.each(append(path, level), false, fn)
+	}
+}
+
+// prefix は文字列としてprefixで始まるキーについてfnを呼び出す
+func (t *keyTrie) prefix(prefix string, fn func(key string)) {
+	levels := strings.Split(prefix, "/")
+	n := &t.root
+	path := make([]string, 0, len(levels))
+
+	// 完全なレベルはそのまま辿り、最後の（途中までの）レベルは前方一致で子を選ぶ
+	for _, level := range levels[:len(levels)-1] {
+		child, ok := n.children[level]
+		if !ok {
+			return
+		}
+		n = child
+		path = append(path, level)
+	}
+	last := levels[len(levels)-1]
+	for level, child := range n.children {
+		if strings.HasPrefix(level, last) {
+			child.each(append(path, level), false, fn)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+// sortedKeys はマップのキーをソートして返す
+func sortedKeys[T any](m map[string]T) []string {
+	return slices.Sorted(maps.Keys(m))
+}
+
+func TestCache_Match(t *testing.T) {
+	c := New[int]()
+	for i, key := range []string{
+		"sensors/a/temp",
+		"sensors/b/temp",
+		"sensors/b/humidity",
+		"sensors",
+		"sensors/a/temp/raw",
+		"$SYS/broker/load",
+		"other/a/temp",
+	} {
+		c.Set(key, i)
+	}
+
+	tests := []struct {
+		filter string
+		want   []string
+	}{
+		{"sensors/+/temp", []string{"sensors/a/temp", "sensors/b/temp"}},
+		{"sensors/#", []string{"sensors", "sensors/a/temp", "sensors/a/temp/raw", "sensors/b/humidity", "sensors/b/temp"}},
+		{"+/a/temp", []string{"other/a/temp", "sensors/a/temp"}},
+		{"#", []string{"other/a/temp", "sensors", "sensors/a/temp", "sensors/a/temp/raw", "sensors/b/humidity", "sensors/b/temp"}},
+		{"$SYS/#", []string{"$SYS/broker/load"}},
+		{"sensors/b/humidity", []string{"sensors/b/humidity"}},
+		{"sensors/+", nil},
+		{"sensors/#/temp", nil},
+	}
+	for _, tt := range tests {
+		got := sortedKeys(c.Match(tt.filter))
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Match(%q) = %v、期待値は %v", tt.filter, got, tt.want)
+		}
+	}
+
+	if got := c.Match("sensors/b/temp"); got["sensors/b/temp"] != 1 {
+		t.Errorf("Match の値 = %v、期待値は 1", got["sensors/b/temp"])
+	}
+}
+
+func TestCache_MatchSkipsExpiredAndDeleted(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	c := New[int]()
+	withClock(c, clock)
+
+	c.SetWithTTL("sensors/a/temp", 1, time.Second)
+	c.Set("sensors/b/temp", 2)
+	c.Set("sensors/c/temp", 3)
+	c.Delete("sensors/c/temp")
+	clock.advance(2 * time.Second)
+
+	got := sortedKeys(c.Match("sensors/+/temp"))
+	if want := []string{"sensors/b/temp"}; !slices.Equal(got, want) {
+		t.Errorf("Match = %v、期待値は %v", got, want)
+	}
+
+	// 削除したキーの不要なノードは取り除かれる
+	c.Delete("sensors/b/temp")
+	c.DeleteExpired()
+	if len(c.keys.root.children) != 0 {
+		t.Errorf("索引にノードが残っています: %v", c.keys.root.children)
+	}
+}
+
+func TestCache_DeletePrefix(t *testing.T) {
+	c := New[int]()
+	for i, key := range []string{"site1", "site1/a", "site1/b/c", "site10/a", "site2/a"} {
+		c.Set(key, i)
+	}
+
+	var evicted []string
+	c.OnEvict(func(key string, _ int, reason EvictReason) {
+		if reason == EvictDeleted {
+			evicted = append(evicted, key)
+		}
+	})
+
+	if n := c.DeletePrefix("site1/"); n != 2 {
+		t.Errorf("DeletePrefix(site1/) = %d、期待値は 2", n)
+	}
+	slices.Sort(evicted)
+	if want := []string{"site1/a", "site1/b/c"}; !slices.Equal(evicted, want) {
+		t.Errorf("削除通知 = %v、期待値は %v", evicted, want)
+	}
+	if got, want := sortedKeys(c.Match("#")), []string{"site1", "site10/a", "site2/a"}; !slices.Equal(got, want) {
+		t.Errorf("残ったキー = %v、期待値は %v", got, want)
+	}
+
+	// レベルの途中までの前方一致
+	if n := c.DeletePrefix("site1"); n != 2 {
+		t.Errorf("DeletePrefix(site1) = %d、期待値は 2", n)
+	}
+	if got, want := c.Keys(), []string{"site2/a"}; !slices.Equal(got, want) {
+		t.Errorf("残ったキー = %v、期待値は %v", got, want)
+	}
+}
+
+func TestSharded_MatchAndDeletePrefix(t *testing.T) {
+	s := NewSharded[int](4)
+	defer s.Close()
+	for i := range 20 {
+		s.Set("sensors/"+string(rune('a'+i))+"/temp", i)
+		s.Set("sensors/"+string(rune('a'+i))+"/humidity", i)
+	}
+
+	if got := s.Match("sensors/+/temp"); len(got) != 20 {
+		t.Errorf("Match の件数 = %d、期待値は 20", len(got))
+	}
+	if n := s.DeletePrefix("sensors/"); n != 40 {
+		t.Errorf("DeletePrefix の件数 = %d、期待値は 40", n)
+	}
+	if n := s.Len(); n != 0 {
+		t.Errorf("Len() = %d、期待値は 0", n)
+	}
+}
@@ -0,0 +1,187 @@
+package cache
+
+import (
+	"fmt"
+	"time"
+)
+
+// Len は有効期限内のエントリ数を返す
+func (c *Cache[T]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.now()
+	n := 0
+	for _, e := range c.val {
+		if !e.expired(now) {
+			n++
+		}
+	}
+	return n
+}
+
+// Keys は有効期限内のエントリのキーを返す（順序は不定）
+func (c *Cache[T]) Keys() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	now := c.now()
+	keys := make([]string, 0, len(c.val))
+	for key, e := range c.val {
+		if !e.expired(now) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Range は有効期限内の各エントリについてfnを呼び出す（順序は不定）
+// fnがfalseを返すと走査を終了する
+// 呼び出し時点のスナップショットを走査するため、fnの中からキャッシュを操作してもよい
+func (c *Cache[T]) Range(fn func(key string, val T) bool) {
+	type kv struct {
+		key string
+		val T
+	}
+
+	c.mu.RLock()
+	now := c.now()
+	items := make([]kv, 0, len(c.val))
+	for key, e := range c.val {
+		if !e.expired(now) {
+			items = append(items, kv{key, e.val})
+		}
+	}
+	c.mu.RUnlock()
+
+	for _, item := range items {
+		if !fn(item.key, item.val) {
+			return
+		}
+	}
+}
+
+// GetOrSet はキーが存在すればその値を、なければvalを保存して返す
+// loadedは既存の値を返した場合にtrueになる
+func (c *Cache[T]) GetOrSet(key string, val T) (actual T, loaded bool) {
+	c.mu.Lock()
+	defer c.unlockAndEmit()
+	e, ok := c.getLocked(key)
+	c.stats.countLookup(ok)
+	if ok {
+		return e.val, true
+	}
+	c.setLocked(key, val, c.defaultTTL)
+	return val, false
+}
+
+// Update はキーの値をfnの戻り値で置き換え、新しい値を返す
+// 読み取りから保存までを1つのロック内で行うため、並行な更新が失われない
+// fnはロック中に呼び出されるため、fnの中からキャッシュを操作してはならない
+// 既存のエントリの有効期限は変更せず、新しいエントリにはデフォルトの有効期限が設定される
+func (c *Cache[T]) Update(key string, fn func(old T, exists bool) T) T {
+	c.mu.Lock()
+	defer c.unlockAndEmit()
+	e, ok := c.getLocked(key)
+	val := fn(e.val, ok)
+	c.setLocked(key, val, c.remainingTTL(e, ok))
+	return val
+}
+
+// CompareAndSwap は現在の値がoldと等しい場合のみnewに置き換える
+// エントリの有効期限は変更しない
+// sync.Map.CompareAndSwapと同様に、比較できない型の値ではパニックする
+func (c *Cache[T]) CompareAndSwap(key string, old, new T) bool {
+	c.mu.Lock()
+	defer c.unlockAndEmit()
+	e, ok := c.getLocked(key)
+	if !ok || any(e.val) != any(old) {
+		return false
+	}
+	c.setLocked(key, new, c.remainingTTL(e, true))
+	return true
+}
+
+// remainingTTL は値を置き換えるエントリeの残りの有効期限を返す（0は期限なし）
+// エントリが存在しない場合はデフォルトの有効期限を返す
+// ロックが既に取得された状態で呼び出される内部メソッド
+func (c *Cache[T]) remainingTTL(e entry[T], exists bool) time.Duration {
+	if !exists {
+		return c.defaultTTL
+	}
+	if e.expiresAt.IsZero() {
+		return 0
+	}
+	return e.expiresAt.Sub(c.now())
+}
+
+// flight は実行中のLoadOrComputeの読み込み
+type flight[T any] struct {
+	done chan struct{}
+	val  T
+	err  error
+}
+
+// LoadOrCompute はキーが存在すればその値を、なければloaderで読み込んで保存した値を返す
+// 同じキーに対する並行な呼び出しでは、loaderは1回だけ実行され結果が共有される
+// loaderがエラーを返した場合は何も保存しない
+// loaderがパニックした場合、呼び出し元ではパニックを再開し、結果を待っていた呼び出しにはエラーを返す
+func (c *Cache[T]) LoadOrCompute(key string, loader func() (T, error)) (T, error) {
+	if val, ok := c.Get(key); ok {
+		return val, nil
+	}
+
+	c.flightMu.Lock()
+	// 直前に完了した読み込みの結果が保存されている場合
+	if val, ok := c.Get(key); ok {
+		c.flightMu.Unlock()
+		return val, nil
+	}
+	if f, ok := c.flights[key]; ok {
+		c.flightMu.Unlock()
+		<-f.done
+		return f.val, f.err
+	}
+	f := &flight[T]{done: make(chan struct{})}
+	if c.flights == nil {
+		c.flights = make(map[string]*flight[T])
+	}
+	c.flights[key] = f
+	c.flightMu.Unlock()
+
+	defer func() {
+		r := recover()
+		if r != nil {
+			f.err = fmt.Errorf("キー %s の読み込みでパニック: %v", key, r)
+		}
+		c.flightMu.Lock()
+		delete(c.flights, key)
+		c.flightMu.Unlock()
+		close(f.done)
+		if r != nil {
+			panic(r)
+		}
+	}()
+
+	f.val, f.err = loader()
+	if f.err == nil {
+		c.Set(key, f.val)
+	}
+	return f.val, f.err
+}
+
+// getLocked は有効期限内のエントリを返し、参照を記録する
+// 期限切れのエントリは削除する
+// ロックが既に取得された状態で呼び出される内部メソッド
+func (c *Cache[T]) getLocked(key string) (entry[T], bool) {
+	e, ok := c.val[key]
+	if !ok {
+		return entry[T]{}, false
+	}
+	if e.expired(c.now()) {
+		c.removeLocked(key, EvictExpired)
+		return entry[T]{}, false
+	}
+	if c.tracker != nil {
+		c.tracker.access(key)
+	}
+	return e, true
+}
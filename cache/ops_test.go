@@ -0,0 +1,299 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCache_LenKeysRange(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	c := New[int]()
+	withClock(c, clock)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.SetWithTTL("c", 3, time.Second)
+	clock.advance(2 * time.Second)
+
+	// 期限切れのエントリは含まない
+	if n := c.Len(); n != 2 {
+		t.Errorf("Len() = %d、期待値は 2", n)
+	}
+	keys := c.Keys()
+	sort.Strings(keys)
+	if len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Errorf("Keys() = %v、期待値は [a b]", keys)
+	}
+
+	sum := 0
+	c.Range(func(key string, val int) bool {
+		sum += val
+		// 走査中にキャッシュを操作してもデッドロックしない
+		c.Set(key+"-copy", val)
+		return true
+	})
+	if sum != 3 {
+		t.Errorf("Rangeの合計 = %d、期待値は 3", sum)
+	}
+
+	visited := 0
+	c.Range(func(string, int) bool {
+		visited++
+		return false
+	})
+	if visited != 1 {
+		t.Errorf("falseを返した後の走査数 = %d、期待値は 1", visited)
+	}
+}
+
+func TestCache_GetOrSet(t *testing.T) {
+	c := New[string]()
+
+	val, loaded := c.GetOrSet("a", "first")
+	if loaded || val != "first" {
+		t.Errorf("GetOrSet() = %s, %t、期待値は first, false", val, loaded)
+	}
+	val, loaded = c.GetOrSet("a", "second")
+	if !loaded || val != "first" {
+		t.Errorf("GetOrSet() = %s, %t、期待値は first, true", val, loaded)
+	}
+}
+
+func TestCache_UpdateConcurrent(t *testing.T) {
+	c := New[int]()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				c.Update("counter", func(old int, _ bool) int {
+					return old + 1
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	if val, _ := c.Get("counter"); val != 5000 {
+		t.Errorf("counter = %d、期待値は 5000", val)
+	}
+
+	created := c.Update("new", func(old int, exists bool) int {
+		if exists {
+			t.Error("存在しないキーでexists = true")
+		}
+		return old + 10
+	})
+	if created != 10 {
+		t.Errorf("Update() = %d、期待値は 10", created)
+	}
+}
+
+func TestCache_CompareAndSwap(t *testing.T) {
+	c := New[string]()
+
+	if c.CompareAndSwap("missing", "", "x") {
+		t.Error("存在しないキーでCompareAndSwapが成功した")
+	}
+
+	c.Set("state", "online")
+	if c.CompareAndSwap("state", "offline", "unknown") {
+		t.Error("値が異なるのにCompareAndSwapが成功した")
+	}
+	if !c.CompareAndSwap("state", "online", "offline") {
+		t.Error("値が等しいのにCompareAndSwapが失敗した")
+	}
+	if val, _ := c.Get("state"); val != "offline" {
+		t.Errorf("state = %s、期待値は offline", val)
+	}
+}
+
+func TestCache_LoadOrComputeSingleflight(t *testing.T) {
+	c := New[string]()
+
+	var calls atomic.Int32
+	release := make(chan struct{})
+	loader := func() (string, error) {
+		calls.Add(1)
+		<-release
+		return "loaded", nil
+	}
+
+	const n = 20
+	var wg sync.WaitGroup
+	results := make([]string, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			val, err := c.LoadOrCompute("key", loader)
+			if err != nil {
+				t.Errorf("LoadOrCompute() 失敗: %v", err)
+			}
+			results[i] = val
+		}(i)
+	}
+
+	// すべてのゴルーチンが待機するまで少し待ってから読み込みを完了させる
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Errorf("loader呼び出し回数 = %d、期待値は 1", got)
+	}
+	for i, val := range results {
+		if val != "loaded" {
+			t.Errorf("results[%d] = %s、期待値は loaded", i, val)
+		}
+	}
+
+	// 保存済みの値はloaderを呼び出さずに返す
+	if _, err := c.LoadOrCompute("key", func() (string, error) {
+		t.Error("保存済みのキーでloaderが呼び出された")
+		return "", nil
+	}); err != nil {
+		t.Errorf("LoadOrCompute() 失敗: %v", err)
+	}
+}
+
+func TestCache_LoadOrComputeError(t *testing.T) {
+	c := New[int]()
+	loadErr := errors.New("読み込みエラー")
+
+	if _, err := c.LoadOrCompute("key", func() (int, error) {
+		return 0, loadErr
+	}); !errors.Is(err, loadErr) {
+		t.Errorf("LoadOrCompute() エラー = %v、期待値は %v", err, loadErr)
+	}
+	if _, ok := c.Get("key"); ok {
+		t.Error("読み込みに失敗した値が保存された")
+	}
+
+	// エラーはキャッシュされず、次の呼び出しで再度読み込む
+	val, err := c.LoadOrCompute("key", func() (int, error) { return 42, nil })
+	if err != nil || val != 42 {
+		t.Errorf("LoadOrCompute() = %d, %v、期待値は 42, nil", val, err)
+	}
+}
+
+func TestSharded_Ops(t *testing.T) {
+	var c CacheInterface[int] = NewSharded[int](4)
+	for i := 0; i < 20; i++ {
+		c.Set(fmt.Sprintf("key-%d", i), i)
+	}
+
+	if n := c.Len(); n != 20 {
+		t.Errorf("Len() = %d、期待値は 20", n)
+	}
+	if keys := c.Keys(); len(keys) != 20 {
+		t.Errorf("len(Keys()) = %d、期待値は 20", len(keys))
+	}
+	visited := 0
+	c.Range(func(string, int) bool {
+		visited++
+		return visited < 5
+	})
+	if visited != 5 {
+		t.Errorf("Rangeの走査数 = %d、期待値は 5", visited)
+	}
+
+	if _, loaded := c.GetOrSet("key-1", 100); !loaded {
+		t.Error("既存のキーでGetOrSetがloaded = falseを返した")
+	}
+	if val := c.Update("key-1", func(old int, _ bool) int { return old * 10 }); val != 10 {
+		t.Errorf("Update() = %d、期待値は 10", val)
+	}
+	if !c.CompareAndSwap("key-1", 10, 11) {
+		t.Error("CompareAndSwapが失敗した")
+	}
+	if val, err := c.LoadOrCompute("key-new", func() (int, error) { return 7, nil }); err != nil || val != 7 {
+		t.Errorf("LoadOrCompute() = %d, %v、期待値は 7, nil", val, err)
+	}
+}
+
+func TestCache_LoadOrComputePanic(t *testing.T) {
+	c := New[int]()
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var recovered any
+	go func() {
+		defer wg.Done()
+		defer func() { recovered = recover() }()
+		c.LoadOrCompute("key", func() (int, error) {
+			close(started)
+			<-release
+			panic("読み込み失敗")
+		})
+	}()
+	<-started
+
+	// 同じキーの読み込みを待つ呼び出しは、このflightの結果を返す
+	c.flightMu.Lock()
+	f := c.flights["key"]
+	c.flightMu.Unlock()
+	close(release)
+	wg.Wait()
+
+	if recovered == nil {
+		t.Error("loaderを実行した呼び出し元でパニックが再開されなかった")
+	}
+	select {
+	case <-f.done:
+	default:
+		t.Fatal("パニックした読み込みの完了が通知されなかった")
+	}
+	if f.err == nil {
+		t.Error("パニックした読み込みを待つ呼び出しにエラーが返されない")
+	}
+	if _, ok := c.Get("key"); ok {
+		t.Error("パニックした読み込みの値が保存された")
+	}
+	if val, err := c.LoadOrCompute("key", func() (int, error) { return 1, nil }); err != nil || val != 1 {
+		t.Errorf("LoadOrCompute() = %d, %v、期待値は 1, nil", val, err)
+	}
+}
+
+func TestCache_UpdateKeepsTTL(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	c := New[int](WithDefaultTTL(time.Hour))
+	withClock(c, clock)
+
+	c.SetWithTTL("short", 1, time.Minute)
+	c.SetWithTTL("forever", 1, 0)
+	clock.advance(30 * time.Second)
+
+	c.Update("short", func(old int, _ bool) int { return old + 1 })
+	c.CompareAndSwap("forever", 1, 2)
+	c.Update("new", func(int, bool) int { return 1 })
+
+	// 既存のエントリの有効期限は延長されない
+	clock.advance(31 * time.Second)
+	if _, ok := c.Get("short"); ok {
+		t.Error("Updateで有効期限が延長された")
+	}
+	if val, ok := c.Get("forever"); !ok || val != 2 {
+		t.Errorf("期限なしのエントリ = %d, %t、期待値は 2, true", val, ok)
+	}
+	// 新しいエントリにはデフォルトの有効期限が設定される
+	if _, ok := c.Get("new"); !ok {
+		t.Error("Updateで作成したエントリが取得できない")
+	}
+	clock.advance(time.Hour)
+	if _, ok := c.Get("new"); ok {
+		t.Error("Updateで作成したエントリにデフォルトの有効期限が設定されていない")
+	}
+	if _, ok := c.Get("forever"); !ok {
+		t.Error("CompareAndSwapで期限なしのエントリに有効期限が設定された")
+	}
+}
@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"hash/maphash"
+	"sync"
+	"time"
+)
+
+// Sharded はキーのハッシュで複数のCacheに分割したキャッシュ
+// 多数のゴルーチンから同時に参照される場合のロック競合を減らす
+type Sharded[T any] struct {
+	shards []*Cache[T]
+	seed   maphash.Seed
+
+	stopJanitor chan struct{}
+	janitorDone chan struct{}
+	closeOnce   sync.Once
+}
+
+// NewSharded はshardCount個のシャードを持つキャッシュを作成
+// WithCapacityの上限はシャードごとに均等に割り当てられる
+func NewSharded[T any](shardCount int, opts ...Option) *Sharded[T] {
+	if shardCount <= 0 {
+		shardCount = 1
+	}
+
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	// シャードごとの期限切れ削除処理は起動せず、まとめて1つのゴルーチンで行う
+	shardOpts := append(opts[:len(opts):len(opts)], WithJanitor(0))
+	if o.capacity > 0 {
+		perShard := (o.capacity + shardCount - 1) / shardCount
+		shardOpts = append(shardOpts, WithCapacity(perShard, o.policy))
+	}
+
+	s := &Sharded[T]{
+		shards: make([]*Cache[T], shardCount),
+		seed:   maphash.MakeSeed(),
+	}
+	for i := range s.shards {
+		s.shards[i] = New[T](shardOpts...)
+	}
+	if o.janitorInterval > 0 {
+		s.startJanitor(o.janitorInterval)
+	}
+	return s
+}
+
+// shard はキーを担当するシャードを返す
+func (s *Sharded[T]) shard(key string) *Cache[T] {
+	return s.shards[maphash.String(s.seed, key)%uint64(len(s.shards))]
+}
+
+func (s *Sharded[T]) Get(key string) (T, bool) {
+	return s.shard(key).Get(key)
+}
+
+func (s *Sharded[T]) Set(key string, val T) {
+	s.shard(key).Set(key, val)
+}
+
+func (s *Sharded[T]) SetWithTTL(key string, val T, ttl time.Duration) {
+	s.shard(key).SetWithTTL(key, val, ttl)
+}
+
+func (s *Sharded[T]) Delete(key string) {
+	s.shard(key).Delete(key)
+}
+
+// DeleteExpired はすべてのシャードから期限切れのエントリを削除する
+func (s *Sharded[T]) DeleteExpired() {
+	for _, c := range s.shards {
+		c.DeleteExpired()
+	}
+}
+
+// Close はバックグラウンドの期限切れ削除処理を停止する
+func (s *Sharded[T]) Close() {
+	s.closeOnce.Do(func() {
+		if s.stopJanitor != nil {
+			close(s.stopJanitor)
+			<-s.janitorDone
+		}
+	})
+}
+
+// startJanitor は期限切れ削除処理のゴルーチンを開始する
+func (s *Sharded[T]) startJanitor(interval time.Duration) {
+	s.stopJanitor = make(chan struct{})
+	s.janitorDone = make(chan struct{})
+	go func() {
+		defer close(s.janitorDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.DeleteExpired()
+			case <-s.stopJanitor:
+				return
+			}
+		}
+	}()
+}
+
+// OnEvict はいずれかのシャードでエントリが外れたときに呼び出される関数を登録する
+func (s *Sharded[T]) OnEvict(fn func(key string, val T, reason EvictReason)) {
+	for _, c := range s.shards {
+		c.OnEvict(fn)
+	}
+}
+
+// OnSet はいずれかのシャードで値が保存されたときに呼び出される関数を登録する
+func (s *Sharded[T]) OnSet(fn func(key string, val T)) {
+	for _, c := range s.shards {
+		c.OnSet(fn)
+	}
+}
+
+// Watch はすべてのシャードの変更通知を受け取るチャネルを返す
+func (s *Sharded[T]) Watch(buffer int) (<-chan Event[T], func()) {
+	ch, fn, closeCh := newWatcher[T](buffer)
+	removes := make([]func(), len(s.shards))
+	for i, c := range s.shards {
+		removes[i] = c.addListener(fn)
+	}
+	return ch, func() {
+		for _, remove := range removes {
+			remove()
+		}
+		closeCh()
+	}
+}
+
+// Len はすべてのシャードの有効期限内のエントリ数を返す
+func (s *Sharded[T]) Len() int {
+	n := 0
+	for _, c := range s.shards {
+		n += c.Len()
+	}
+	return n
+}
+
+// Keys はすべてのシャードの有効期限内のエントリのキーを返す（順序は不定）
+func (s *Sharded[T]) Keys() []string {
+	var keys []string
+	for _, c := range s.shards {
+		keys = append(keys, c.Keys()...)
+	}
+	return keys
+}
+
+// Range はすべてのシャードの有効期限内の各エントリについてfnを呼び出す
+// fnがfalseを返すと走査を終了する
+func (s *Sharded[T]) Range(fn func(key string, val T) bool) {
+	for _, c := range s.shards {
+		stopped := false
+		c.Range(func(key string, val T) bool {
+			if !fn(key, val) {
+				stopped = true
+				return false
+			}
+			return true
+		})
+		if stopped {
+			return
+		}
+	}
+}
+
+func (s *Sharded[T]) GetOrSet(key string, val T) (T, bool) {
+	return s.shard(key).GetOrSet(key, val)
+}
+
+func (s *Sharded[T]) Update(key string, fn func(old T, exists bool) T) T {
+	return s.shard(key).Update(key, fn)
+}
+
+func (s *Sharded[T]) CompareAndSwap(key string, old, new T) bool {
+	return s.shard(key).CompareAndSwap(key, old, new)
+}
+
+func (s *Sharded[T]) LoadOrCompute(key string, loader func() (T, error)) (T, error) {
+	return s.shard(key).LoadOrCompute(key, loader)
+}
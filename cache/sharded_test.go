@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSharded_Basic(t *testing.T) {
+	var c CacheInterface[string] = NewSharded[string](8)
+
+	if _, ok := c.Get("missing"); ok {
+		t.Error("存在しないキーでGetがokを返した")
+	}
+
+	for i := 0; i < 100; i++ {
+		c.Set(fmt.Sprintf("key-%d", i), fmt.Sprintf("value-%d", i))
+	}
+	for i := 0; i < 100; i++ {
+		val, ok := c.Get(fmt.Sprintf("key-%d", i))
+		if !ok || val != fmt.Sprintf("value-%d", i) {
+			t.Errorf("key-%d = %v, %t、期待値は value-%d, true", i, val, ok, i)
+		}
+	}
+
+	c.Delete("key-0")
+	if _, ok := c.Get("key-0"); ok {
+		t.Error("Delete後もキーが取得できた")
+	}
+}
+
+func TestSharded_Distribution(t *testing.T) {
+	s := NewSharded[int](4)
+	for i := 0; i < 1000; i++ {
+		s.Set(fmt.Sprintf("device-%d", i), i)
+	}
+	for i, shard := range s.shards {
+		if n := len(shard.val); n == 0 {
+			t.Errorf("シャード %d にエントリがない", i)
+		}
+	}
+}
+
+func TestSharded_TTLAndJanitor(t *testing.T) {
+	s := NewSharded[int](4, WithDefaultTTL(10*time.Millisecond), WithJanitor(5*time.Millisecond))
+	defer s.Close()
+
+	for i := 0; i < 20; i++ {
+		s.Set(fmt.Sprintf("key-%d", i), i)
+	}
+	s.SetWithTTL("forever", 1, 0)
+
+	// シャードごとのJanitorは起動しない
+	for i, shard := range s.shards {
+		if shard.stopJanitor != nil {
+			t.Errorf("シャード %d で個別のJanitorが起動している", i)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		total := 0
+		for _, shard := range s.shards {
+			shard.mu.RLock()
+			total += len(shard.val)
+			shard.mu.RUnlock()
+		}
+		if total == 1 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, ok := s.Get("forever"); !ok {
+		t.Error("期限なしのエントリが削除された")
+	}
+	if _, ok := s.Get("key-0"); ok {
+		t.Error("期限切れのエントリが取得できた")
+	}
+}
+
+func TestSharded_Capacity(t *testing.T) {
+	s := NewSharded[int](4, WithCapacity(10, LRU))
+	for i := 0; i < 100; i++ {
+		s.Set(fmt.Sprintf("key-%d", i), i)
+	}
+	for i, shard := range s.shards {
+		if shard.capacity != 3 {
+			t.Errorf("シャード %d の容量 = %d、期待値は 3", i, shard.capacity)
+		}
+		if n := len(shard.val); n > 3 {
+			t.Errorf("シャード %d のエントリ数 = %d、容量上限を超えている", i, n)
+		}
+	}
+}
+
+func TestSharded_Concurrency_ReadWrite(t *testing.T) {
+	s := NewSharded[int](8)
+	var wg sync.WaitGroup
+	for w := 0; w < 10; w++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				key := string(rune((i % 10) + 'a'))
+				if id%2 == 0 {
+					s.Set(key, id*1000+i)
+				} else {
+					s.Get(key)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
+
+// benchmarkCache はreadPercent%が読み取り、残りが書き込みの操作を並行に実行する
+func benchmarkCache(b *testing.B, c CacheInterface[int], keys []string, readPercent int) {
+	for i, key := range keys {
+		c.Set(key, i)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := keys[i%len(keys)]
+			if i%100 < readPercent {
+				c.Get(key)
+			} else {
+				c.Set(key, i)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkCacheReadWrite(b *testing.B) {
+	// cache_test.go の並行テストと同じ10個のキー集合と、デバイス数を想定した1000個のキー集合
+	keySets := map[string][]string{}
+	for _, n := range []int{10, 1000} {
+		keys := make([]string, n)
+		for i := range keys {
+			if n == 10 {
+				keys[i] = string(rune(i + 'a'))
+			} else {
+				keys[i] = fmt.Sprintf("device-%d", i)
+			}
+		}
+		keySets[fmt.Sprintf("keys=%d", n)] = keys
+	}
+
+	// 90%: 読み取り中心、67%: TestCache_Concurrency_ReadWrite（リーダー10:ライター5）、50%: 書き込み多め
+	for _, name := range []string{"keys=10", "keys=1000"} {
+		keys := keySets[name]
+		for _, read := range []int{90, 67, 50} {
+			b.Run(fmt.Sprintf("Cache/%s/read=%d%%", name, read), func(b *testing.B) {
+				benchmarkCache(b, New[int](), keys, read)
+			})
+			b.Run(fmt.Sprintf("Sharded/%s/read=%d%%", name, read), func(b *testing.B) {
+				benchmarkCache(b, NewSharded[int](16), keys, read)
+			})
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package cache
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Codec はスナップショットのエンコード形式
+type Codec interface {
+	Encode(w io.Writer, v any) error
+	Decode(r io.Reader, v any) error
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Encode(w io.Writer, v any) error { return gob.NewEncoder(w).Encode(v) }
+func (gobCodec) Decode(r io.Reader, v any) error { return gob.NewDecoder(r).Decode(v) }
+
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(w io.Writer, v any) error { return json.NewEncoder(w).Encode(v) }
+func (jsonCodec) Decode(r io.Reader, v any) error { return json.NewDecoder(r).Decode(v) }
+
+var (
+	// GobCodec はencoding/gobでエンコードする（デフォルト）
+	GobCodec Codec = gobCodec{}
+	// JSONCodec はencoding/jsonでエンコードする
+	JSONCodec Codec = jsonCodec{}
+)
+
+// WithCodec はスナップショットのエンコード形式を設定する
+func WithCodec(codec Codec) Option {
+	return func(o *options) {
+		o.codec = codec
+	}
+}
+
+// snapshotData はスナップショットとして保存する内容
+type snapshotData[T any] struct {
+	Entries []snapshotEntry[T] `json:"entries"`
+}
+
+// snapshotEntry はスナップショット内の1エントリ
+type snapshotEntry[T any] struct {
+	Key       string    `json:"key"`
+	Value     T         `json:"value"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"` // ゼロ値は期限なし
+}
+
+// Snapshot は有効期限内のすべてのエントリをwに書き出す
+func (c *Cache[T]) Snapshot(w io.Writer) error {
+	c.mu.RLock()
+	now := c.now()
+	data := snapshotData[T]{Entries: make([]snapshotEntry[T], 0, len(c.val))}
+	for key, e := range c.val {
+		if !e.expired(now) {
+			data.Entries = append(data.Entries, snapshotEntry[T]{Key: key, Value: e.val, ExpiresAt: e.expiresAt})
+		}
+	}
+	c.mu.RUnlock()
+
+	if err := c.codec.Encode(w, data); err != nil {
+		return fmt.Errorf("スナップショットの書き出しに失敗: %w", err)
+	}
+	return nil
+}
+
+// Restore はrから読み込んだエントリをキャッシュに保存する
+// 既存のエントリは残したまま、同じキーは上書きする
+// 読み込み時点で期限切れのエントリは保存しない
+func (c *Cache[T]) Restore(r io.Reader) error {
+	var data snapshotData[T]
+	if err := c.codec.Decode(r, &data); err != nil {
+		return fmt.Errorf("スナップショットの読み込みに失敗: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.unlockAndEmit()
+	now := c.now()
+	for _, e := range data.Entries {
+		var ttl time.Duration
+		if !e.ExpiresAt.IsZero() {
+			ttl = e.ExpiresAt.Sub(now)
+			if ttl <= 0 {
+				continue
+			}
+		}
+		c.setLocked(e.Key, e.Value, ttl)
+	}
+	return nil
+}
+
+// SaveFile はスナップショットをファイルに保存する
+// 同じディレクトリの一時ファイルに書き出してからリネームするため、
+// 保存中に異常終了しても既存のファイルは壊れない
+func (c *Cache[T]) SaveFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("一時ファイルの作成に失敗: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // リネーム後は存在しないため失敗しても問題ない
+
+	if err := c.Snapshot(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("一時ファイルの同期に失敗: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("一時ファイルのクローズに失敗: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("スナップショットファイルの置き換えに失敗: %w", err)
+	}
+	return nil
+}
+
+// LoadFile はファイルからスナップショットを読み込む
+// ファイルが存在しない場合はos.ErrNotExistをラップしたエラーを返す
+func (c *Cache[T]) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("スナップショットファイルを開けません: %w", err)
+	}
+	defer f.Close()
+	return c.Restore(f)
+}
+
+// StartAutosave は一定間隔でスナップショットをファイルに保存する
+// 定期保存のエラーはonError（nilの場合は無視）に渡される
+// 返された関数は定期保存を停止し、最後にもう一度保存した結果を返す
+// intervalが0以下の場合はエラーを返す
+func (c *Cache[T]) StartAutosave(path string, interval time.Duration, onError func(error)) (func() error, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("定期保存の間隔 %v は正の値を指定してください", interval)
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.SaveFile(path); err != nil && onError != nil {
+					onError(err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	var err error
+	return func() error {
+		once.Do(func() {
+			close(stop)
+			<-done
+			err = c.SaveFile(path)
+		})
+		return err
+	}, nil
+}
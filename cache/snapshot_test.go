@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type deviceState struct {
+	Online bool
+	Value  float64
+}
+
+func TestCache_SnapshotRestore(t *testing.T) {
+	for name, codec := range map[string]Codec{"gob": GobCodec, "json": JSONCodec} {
+		t.Run(name, func(t *testing.T) {
+			clock := &fakeClock{t: time.Now()}
+			src := New[deviceState](WithCodec(codec))
+			withClock(src, clock)
+
+			src.Set("dev-1", deviceState{Online: true, Value: 1.5})
+			src.SetWithTTL("dev-2", deviceState{Value: 2}, time.Minute)
+			src.SetWithTTL("dev-3", deviceState{Value: 3}, time.Second)
+			clock.advance(2 * time.Second) // dev-3は期限切れ
+
+			var buf bytes.Buffer
+			if err := src.Snapshot(&buf); err != nil {
+				t.Fatalf("Snapshot() 失敗: %v", err)
+			}
+
+			dst := New[deviceState](WithCodec(codec))
+			withClock(dst, clock)
+			dst.Set("existing", deviceState{Value: 9})
+			if err := dst.Restore(&buf); err != nil {
+				t.Fatalf("Restore() 失敗: %v", err)
+			}
+
+			if val, ok := dst.Get("dev-1"); !ok || val != (deviceState{Online: true, Value: 1.5}) {
+				t.Errorf("dev-1 = %+v, %t、期待値は {true 1.5}, true", val, ok)
+			}
+			if _, ok := dst.Get("dev-3"); ok {
+				t.Error("期限切れのエントリが復元された")
+			}
+			if _, ok := dst.Get("existing"); !ok {
+				t.Error("既存のエントリがRestoreで消えた")
+			}
+
+			// 有効期限も復元される
+			clock.advance(time.Minute)
+			if _, ok := dst.Get("dev-2"); ok {
+				t.Error("復元したエントリの有効期限が引き継がれていない")
+			}
+			if _, ok := dst.Get("dev-1"); !ok {
+				t.Error("期限なしのエントリが期限切れになった")
+			}
+		})
+	}
+}
+
+func TestCache_RestoreInvalid(t *testing.T) {
+	c := New[int](WithCodec(JSONCodec))
+	if err := c.Restore(strings.NewReader("not json")); err == nil {
+		t.Error("不正なデータでRestore()がエラーを返さなかった")
+	}
+}
+
+func TestCache_SaveLoadFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cache.snapshot")
+
+	c := New[string]()
+	if err := c.LoadFile(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("存在しないファイルのLoadFile() エラー = %v、期待値は os.ErrNotExist", err)
+	}
+
+	c.Set("a", "1")
+	if err := c.SaveFile(path); err != nil {
+		t.Fatalf("SaveFile() 失敗: %v", err)
+	}
+
+	// 一時ファイルが残っていないこと
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() 失敗: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("ディレクトリ内のファイル数 = %d、期待値は 1", len(entries))
+	}
+
+	loaded := New[string]()
+	if err := loaded.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile() 失敗: %v", err)
+	}
+	if val, ok := loaded.Get("a"); !ok || val != "1" {
+		t.Errorf("a = %s, %t、期待値は 1, true", val, ok)
+	}
+}
+
+func TestCache_Autosave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "autosave.snapshot")
+
+	c := New[int]()
+	c.Set("a", 1)
+	stop, err := c.StartAutosave(path, 5*time.Millisecond, func(err error) {
+		t.Errorf("定期保存に失敗: %v", err)
+	})
+	if err != nil {
+		t.Fatalf("StartAutosave() 失敗: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// 停止時に最新の内容が保存される
+	c.Set("b", 2)
+	if err := stop(); err != nil {
+		t.Fatalf("停止時の保存に失敗: %v", err)
+	}
+	if err := stop(); err != nil {
+		t.Errorf("2回目の停止でエラー: %v", err)
+	}
+
+	loaded := New[int]()
+	if err := loaded.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile() 失敗: %v", err)
+	}
+	if loaded.Len() != 2 {
+		t.Errorf("復元したエントリ数 = %d、期待値は 2", loaded.Len())
+	}
+}
+
+func TestCache_AutosaveInvalidInterval(t *testing.T) {
+	c := New[int]()
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if stop, err := c.StartAutosave(filepath.Join(t.TempDir(), "x"), interval, nil); err == nil || stop != nil {
+			t.Errorf("間隔 %v でエラーが返されませんでした", interval)
+		}
+	}
+}
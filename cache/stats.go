@@ -0,0 +1,94 @@
+package cache
+
+import "sync/atomic"
+
+// Stats はキャッシュの統計情報のスナップショット
+type Stats struct {
+	Hits        uint64 // Get/GetOrSetで値が見つかった回数
+	Misses      uint64 // Get/GetOrSetで値が見つからなかった回数
+	Sets        uint64 // 値を保存した回数（上書きを含む）
+	Deletes     uint64 // Deleteでエントリを削除した回数
+	Evictions   uint64 // 容量上限で追い出した回数
+	Expirations uint64 // 有効期限切れで削除した回数
+	Size        int    // 現在のエントリ数（削除前の期限切れエントリを含む）
+}
+
+// HitRatio はヒット率を返す（参照がない場合は0）
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// add は2つの統計情報を合算する
+func (s Stats) add(o Stats) Stats {
+	return Stats{
+		Hits:        s.Hits + o.Hits,
+		Misses:      s.Misses + o.Misses,
+		Sets:        s.Sets + o.Sets,
+		Deletes:     s.Deletes + o.Deletes,
+		Evictions:   s.Evictions + o.Evictions,
+		Expirations: s.Expirations + o.Expirations,
+		Size:        s.Size + o.Size,
+	}
+}
+
+// counters はロックなしで更新できる統計カウンター
+type counters struct {
+	hits        atomic.Uint64
+	misses      atomic.Uint64
+	sets        atomic.Uint64
+	deletes     atomic.Uint64
+	evictions   atomic.Uint64
+	expirations atomic.Uint64
+}
+
+// countLookup は参照の結果を記録する
+func (c *counters) countLookup(hit bool) {
+	if hit {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+}
+
+// countRemoval は削除理由ごとの件数を記録する
+// 上書き（EvictReplaced）はSetとして数えるため記録しない
+func (c *counters) countRemoval(reason EvictReason) {
+	switch reason {
+	case EvictDeleted:
+		c.deletes.Add(1)
+	case EvictCapacity:
+		c.evictions.Add(1)
+	case EvictExpired:
+		c.expirations.Add(1)
+	}
+}
+
+// Stats は統計情報のスナップショットを返す
+func (c *Cache[T]) Stats() Stats {
+	c.mu.RLock()
+	size := len(c.val)
+	c.mu.RUnlock()
+
+	return Stats{
+		Hits:        c.stats.hits.Load(),
+		Misses:      c.stats.misses.Load(),
+		Sets:        c.stats.sets.Load(),
+		Deletes:     c.stats.deletes.Load(),
+		Evictions:   c.stats.evictions.Load(),
+		Expirations: c.stats.expirations.Load(),
+		Size:        size,
+	}
+}
+
+// Stats はすべてのシャードの統計情報を合算したスナップショットを返す
+func (s *Sharded[T]) Stats() Stats {
+	var total Stats
+	for _, c := range s.shards {
+		total = total.add(c.Stats())
+	}
+	return total
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCache_Stats(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	c := NewLRU[int](2)
+	withClock(c, clock)
+
+	c.Set("a", 1)
+	c.Set("a", 2)
+	c.Get("a")
+	c.Get("missing")
+	c.GetOrSet("a", 3)
+	c.GetOrSet("b", 4)
+	c.SetWithTTL("c", 5, time.Second) // aを追い出す
+	clock.advance(2 * time.Second)
+	c.Get("c") // 期限切れ
+	c.Delete("b")
+	c.Delete("b") // 存在しないキーは数えない
+
+	got := c.Stats()
+	want := Stats{
+		Hits:        2,
+		Misses:      3,
+		Sets:        4,
+		Deletes:     1,
+		Evictions:   1,
+		Expirations: 1,
+		Size:        0,
+	}
+	if got != want {
+		t.Errorf("Stats() = %+v、期待値は %+v", got, want)
+	}
+	if ratio := got.HitRatio(); ratio != 0.4 {
+		t.Errorf("HitRatio() = %v、期待値は 0.4", ratio)
+	}
+	if ratio := (Stats{}).HitRatio(); ratio != 0 {
+		t.Errorf("参照なしのHitRatio() = %v、期待値は 0", ratio)
+	}
+}
+
+func TestCache_StatsConcurrent(t *testing.T) {
+	c := New[int]()
+
+	var wg sync.WaitGroup
+	for w := 0; w < 10; w++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("%d-%d", id, i)
+				c.Set(key, i)
+				c.Get(key)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	st := c.Stats()
+	if st.Sets != 1000 || st.Hits != 1000 || st.Size != 1000 {
+		t.Errorf("Stats() = %+v、期待値は Sets=1000 Hits=1000 Size=1000", st)
+	}
+}
+
+func TestSharded_Stats(t *testing.T) {
+	s := NewSharded[int](4)
+	for i := 0; i < 10; i++ {
+		s.Set(fmt.Sprintf("key-%d", i), i)
+		s.Get(fmt.Sprintf("key-%d", i))
+		s.Get(fmt.Sprintf("missing-%d", i))
+	}
+
+	st := s.Stats()
+	if st.Sets != 10 || st.Hits != 10 || st.Misses != 10 || st.Size != 10 {
+		t.Errorf("Stats() = %+v、期待値は Sets=10 Hits=10 Misses=10 Size=10", st)
+	}
+}
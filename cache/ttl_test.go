@@ -0,0 +1,119 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock はテスト用の手動で進める時計
+type fakeClock struct {
+	t time.Time
+}
+
+func (f *fakeClock) now() time.Time              { return f.t }
+func (f *fakeClock) advance(d time.Duration)     { f.t = f.t.Add(d) }
+func withClock[T any](c *Cache[T], f *fakeClock) { c.now = f.now }
+
+func TestCache_SetWithTTL(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	c := New[string]()
+	withClock(c, clock)
+
+	c.SetWithTTL("short", "a", time.Second)
+	c.SetWithTTL("forever", "b", 0)
+
+	clock.advance(500 * time.Millisecond)
+	if _, ok := c.Get("short"); !ok {
+		t.Error("有効期限内のエントリが取得できない")
+	}
+
+	clock.advance(time.Second)
+	if _, ok := c.Get("short"); ok {
+		t.Error("期限切れのエントリが取得できた")
+	}
+	if _, exists := c.val["short"]; exists {
+		t.Error("期限切れのエントリがGet後も残っている")
+	}
+	if val, ok := c.Get("forever"); !ok || val != "b" {
+		t.Errorf("期限なしのエントリ = %v, %t、期待値は b, true", val, ok)
+	}
+}
+
+func TestCache_DefaultTTL(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	c := New[int](WithDefaultTTL(5 * time.Minute))
+	withClock(c, clock)
+
+	c.Set("device-1", 1)
+	c.SetWithTTL("device-2", 2, time.Hour)
+
+	clock.advance(6 * time.Minute)
+	if _, ok := c.Get("device-1"); ok {
+		t.Error("デフォルトTTLを過ぎたエントリが取得できた")
+	}
+	if _, ok := c.Get("device-2"); !ok {
+		t.Error("個別TTLのエントリがデフォルトTTLで期限切れになった")
+	}
+
+	// 上書きすると有効期限も更新される
+	c.Set("device-1", 10)
+	clock.advance(4 * time.Minute)
+	if val, ok := c.Get("device-1"); !ok || val != 10 {
+		t.Errorf("上書き後のエントリ = %v, %t、期待値は 10, true", val, ok)
+	}
+}
+
+func TestCache_DeleteExpired(t *testing.T) {
+	clock := &fakeClock{t: time.Now()}
+	c := New[int]()
+	withClock(c, clock)
+
+	c.SetWithTTL("a", 1, time.Second)
+	c.SetWithTTL("b", 2, time.Minute)
+	c.Set("c", 3)
+
+	clock.advance(2 * time.Second)
+	c.DeleteExpired()
+
+	if len(c.val) != 2 {
+		t.Errorf("DeleteExpired後のエントリ数 = %d、期待値は 2", len(c.val))
+	}
+	if _, exists := c.val["a"]; exists {
+		t.Error("期限切れのエントリが削除されていない")
+	}
+}
+
+func TestCache_Janitor(t *testing.T) {
+	c := New[int](WithJanitor(5 * time.Millisecond))
+	defer c.Close()
+
+	c.SetWithTTL("a", 1, 10*time.Millisecond)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		n := len(c.val)
+		c.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.val) != 0 {
+		t.Error("バックグラウンド処理で期限切れのエントリが削除されていない")
+	}
+}
+
+func TestCache_CloseWithoutJanitor(t *testing.T) {
+	c := New[int]()
+	// Janitorなしでも複数回のCloseが安全であること
+	c.Close()
+	c.Close()
+
+	j := New[int](WithJanitor(time.Millisecond))
+	j.Close()
+	j.Close()
+}
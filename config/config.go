@@ -2,94 +2,242 @@ package config
 
 import (
 	"fmt"
-	"path/filepath"
+	"log"
+	"os"
+	"reflect"
 	"strings"
 
 	"github.com/spf13/viper"
 )
 
 // MQTTConfig はMQTT接続の設定を保持する
+// descタグはJSON Schemaの説明として使用される（schema.go）
 type MQTTConfig struct {
-	BrokerURL  string `mapstructure:"broker_url"`
-	ClientID   string `mapstructure:"client_id"`
-	Username   string `mapstructure:"username"`
-	Password   string `mapstructure:"password"`
-	UseSSL     bool   `mapstructure:"use_ssl"`
-	CACertPath string `mapstructure:"ca_cert_path"`
-	QoS        uint8  `mapstructure:"qos"`
-	Retained   bool   `mapstructure:"retained"`
+	BrokerURL    string `mapstructure:"broker_url" desc:"ブローカーのURL（例: tcp://localhost:1883, ssl://host:8883）"`
+	ClientID     string `mapstructure:"client_id" desc:"クライアントID（空の場合はランダムに生成）"`
+	Username     string `mapstructure:"username" secretref:"true" desc:"ユーザー名。${env:NAME} や ${file:/path} で参照できる"`
+	Password     string `mapstructure:"password" secret:"true" secretref:"true" desc:"パスワード。${env:NAME} や ${file:/path} で参照できる"`
+	PasswordFile string `mapstructure:"password_file" desc:"パスワードを読み込むファイル（passwordと同時には指定できない）"`
+	UseSSL       bool   `mapstructure:"use_ssl" desc:"SSL/TLSで接続するか"`
+	CACertPath   string `mapstructure:"ca_cert_path" secretref:"true" desc:"CA証明書ファイルのパス（use_ssl が true の場合）。${env:NAME} で参照できる"`
+	QoS          uint8  `mapstructure:"qos" desc:"デフォルトのQoS"`
+	Retained     bool   `mapstructure:"retained" desc:"公開するメッセージを保持メッセージにするか"`
 }
 
 // AppConfig はアプリケーションの全体的な設定を保持する
 type AppConfig struct {
-	MQTT   MQTTConfig           `mapstructure:"mqtt"`
-	Topics map[string]TopicInfo `mapstructure:"topics"`
+	MQTT        MQTTConfig            `mapstructure:"mqtt" desc:"ブローカーへの接続（connection を省略したトピックが使用する default の接続）"`
+	Connections map[string]MQTTConfig `mapstructure:"connections" desc:"名前付きの接続。トピックの connection で指定する"` // connection.go
+	Topics      map[string]TopicInfo  `mapstructure:"topics" desc:"トピックの設定（キーは設定上のトピック名）"`
 }
 
 // TopicInfo はトピックに関する設定情報を保持する
 type TopicInfo struct {
-	Name        string `mapstructure:"name"`
-	Description string `mapstructure:"description"`
-	QoS         *uint8 `mapstructure:"qos"`
+	Name        string `mapstructure:"name" desc:"MQTTのトピック名またはトピックフィルター"`
+	Description string `mapstructure:"description" desc:"トピックの説明"`
+	QoS         *uint8 `mapstructure:"qos" desc:"トピック固有のQoS（省略時は接続のQoS）"` // nilの場合はグローバル設定を使用（0と未指定を区別する）
+	Filter      string `mapstructure:"filter" desc:"条件に一致するメッセージのみ処理するフィルター式（例: value > 50）"`
+	Direction   string `mapstructure:"direction" desc:"公開（publish）、サブスクライブ（subscribe）、または両方（both）"`
+	Retained    *bool  `mapstructure:"retained" desc:"公開するメッセージを保持メッセージにするか（省略時は接続の設定）"` // nilの場合はグローバル設定を使用
+	Codec       string `mapstructure:"codec" desc:"ペイロードの形式"`
+	Schema      string `mapstructure:"schema" desc:"ペイロードのスキーマの参照（例: schemas/sensor.json）"`
+	Handler     string `mapstructure:"handler" desc:"受信したメッセージを処理するハンドラーの登録名"`
+	Enabled     *bool  `mapstructure:"enabled" desc:"false の場合はサブスクライブも公開もしない"` // nilの場合は有効
+	Connection  string `mapstructure:"connection" desc:"使用する接続の名前（connections のキー。省略時は mqtt セクションの接続）"`
+}
+
+// トピックの方向（TopicInfo.Direction）
+const (
+	DirectionPublish   = "publish"   // 公開のみ
+	DirectionSubscribe = "subscribe" // サブスクライブのみ
+	DirectionBoth      = "both"      // 公開とサブスクライブ
+)
+
+// ペイロードの形式（TopicInfo.Codec）
+const (
+	CodecJSON   = "json"   // JSON（application/json）
+	CodecText   = "text"   // UTF-8の文字列（text/plain）
+	CodecBinary = "binary" // 任意のバイト列（application/octet-stream）
+)
+
+// IsEnabled はトピックが有効かを返す
+func (t TopicInfo) IsEnabled() bool {
+	return t.Enabled == nil || *t.Enabled
+}
+
+// TopicDirection はトピックの方向を返す（未指定の場合はDirectionSubscribe）
+func (t TopicInfo) TopicDirection() string {
+	if t.Direction == "" {
+		return DirectionSubscribe
+	}
+	return t.Direction
+}
+
+// Subscribes は有効なトピックをサブスクライブする場合にtrueを返す
+func (t TopicInfo) Subscribes() bool {
+	d := t.TopicDirection()
+	return t.IsEnabled() && (d == DirectionSubscribe || d == DirectionBoth)
+}
+
+// Publishes は有効なトピックに公開する場合にtrueを返す
+func (t TopicInfo) Publishes() bool {
+	d := t.TopicDirection()
+	return t.IsEnabled() && (d == DirectionPublish || d == DirectionBoth)
+}
+
+// PayloadCodec はペイロードの形式を返す（未指定の場合はCodecJSON）
+func (t TopicInfo) PayloadCodec() string {
+	if t.Codec == "" {
+		return CodecJSON
+	}
+	return t.Codec
+}
+
+// defaults は設定ファイルや環境変数で指定されなかった項目の値
+// ゼロ値で判定すると明示的に指定したQoS 0やfalseと区別できないため、viperのデフォルトとして登録する
+// 名前付きの接続（connections.<name>）にも同じ値を登録する
+var defaults = map[string]any{
+	"mqtt.broker_url": "tcp://localhost:1883",
+	"mqtt.qos":        1,
+	"mqtt.retained":   false,
+}
+
+// LoadOption はLoadConfigのオプション設定を行う関数
+type LoadOption func(*loadOptions)
+
+// loadOptions はLoadConfigに渡されたオプションの設定値
+type loadOptions struct {
+	providers   map[string]SecretProvider // スキームごとの秘密情報の参照の解決方法（secret.go）
+	profiles    []string                  // 重ねるプロファイル（profile.go）
+	profilesSet bool                      // WithProfilesが指定されたか
+	confDir     *string                   // 断片ファイルのディレクトリ（nilの場合はconf.d）
+	overrides   map[string]string         // コマンドラインで指定された設定値（flags.go）
+	strict      bool                      // 不明な項目をエラーにするか（schema.go）
+	warn        func(*FieldError)         // 読み込みを中断しない問題の報告先（schema.go）
+}
+
+// newLoadOptions はデフォルト値にoptsを適用したオプションを返す
+func newLoadOptions(opts []LoadOption) loadOptions {
+	o := loadOptions{
+		providers: map[string]SecretProvider{
+			"env":  EnvSecretProvider,
+			"file": FileSecretProvider,
+		},
+		overrides: make(map[string]string),
+		warn: func(fe *FieldError) {
+			log.Printf("設定の警告: %v", fe)
+		},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
 }
 
 // LoadConfig は設定ファイルを読み込み、AppConfig構造体を返す
-func LoadConfig(configPath string) (*AppConfig, error) {
+// conf.dの断片ファイルとプロファイルの設定ファイルは基本の設定ファイルに重ねられる（profile.go）
+// 設定値に含まれる ${env:NAME} や ${file:/path} の参照は読み込み時に解決される
+func LoadConfig(configPath string, opts ...LoadOption) (*AppConfig, error) {
+	config, _, err := load(configPath, newLoadOptions(opts))
+	return config, err
+}
+
+// load は設定を読み込み、各項目の値の由来とともに返す
+func load(configPath string, o loadOptions) (*AppConfig, Sources, error) {
 	v := viper.New()
 
-	// 設定ファイルパスとファイル名を分離
-	dir, file := filepath.Split(configPath)
-	ext := filepath.Ext(file)
-	name := strings.TrimSuffix(file, ext)
+	// デフォルト値の登録
+	for key, val := range defaults {
+		v.SetDefault(key, val)
+	}
+
+	// 基本の設定ファイルにconf.dの断片とプロファイルを重ねて読み込み（profile.go）
+	files, err := configFiles(configPath, &o)
+	if err != nil {
+		return nil, nil, err
+	}
+	merged, origins, err := mergeConfigFiles(files)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 不明な項目や型の誤りをキーパスとともに報告する（schema.go）
+	// 環境変数とフラグは文字列のため、設定ファイルを重ねた結果のみを検証する
+	// 値の誤りもまとめて報告するため、ここでは中断せずValidateのエラーと合わせる
+	schemaErr := validateSchema(merged, &o)
+	if err := v.MergeConfigMap(merged); err != nil {
+		return nil, nil, fmt.Errorf("設定の統合に失敗: %w", err)
+	}
 
-	// Viperの設定
-	v.AddConfigPath(dir)
-	v.SetConfigName(name)
-	v.SetConfigType(strings.TrimPrefix(ext, "."))
+	// コマンドラインで指定された設定値は最も優先される（flags.go）
+	// フラグにのみ存在するトピックにも環境変数を対応付けるため、bindEnvより前に登録する
+	for key, val := range o.overrides {
+		v.Set(key, val)
+	}
 
-	// 環境変数によるオーバーライドを有効化
-	v.AutomaticEnv()
-	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	// 環境変数によるオーバーライドを有効化（env.go）
+	// トピックのキーを知るため、設定ファイルの読み込み後に対応付ける
+	if err := bindEnv(v); err != nil {
+		return nil, nil, fmt.Errorf("環境変数の設定に失敗: %w", err)
+	}
 
-	// 設定ファイルを読み込み
-	if err := v.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("設定ファイルの読み込みに失敗: %w", err)
+	// 名前付きの接続のデフォルト値の登録（環境変数にのみ存在する接続も含む）
+	for name := range mapKeys(v, "connections", reflect.TypeFor[MQTTConfig](), os.Environ()) {
+		for key, val := range defaults {
+			if field, ok := strings.CutPrefix(key, "mqtt."); ok {
+				v.SetDefault(joinKey(connectionKey(name), field), val)
+			}
+		}
 	}
 
 	// 設定を構造体にアンマーシャル
 	var config AppConfig
 	if err := v.Unmarshal(&config); err != nil {
-		return nil, fmt.Errorf("設定の解析に失敗: %w", err)
+		if schemaErr != nil {
+			return nil, nil, schemaErr // 型の誤りはスキーマの検証がキーパスとともに報告する
+		}
+		return nil, nil, fmt.Errorf("設定の解析に失敗: %w", err)
 	}
 
-	// デフォルト値の設定
-	setDefaults(&config)
+	// 秘密情報の参照を解決
+	if err := resolveSecrets(&config, o.providers); err != nil {
+		return nil, nil, mergeValidationErrors(err, schemaErr)
+	}
 
-	return &config, nil
-}
+	// 各項目の値の由来（source.go）。補完されたトピックのQoSを区別するため補完の前に調べる
+	sources := configSources(&config, &o, origins)
 
-// setDefaults は設定にデフォルト値を設定する
-func setDefaults(config *AppConfig) {
-	// MQTTブローカーURLのデフォルト
-	if config.MQTT.BrokerURL == "" {
-		config.MQTT.BrokerURL = "tcp://localhost:1883"
+	// 設定値の検証
+	// 補完の前に検証し、継承したQoSの誤りはトピックごとではなく接続の設定で1回だけ報告する
+	if err := mergeValidationErrors(config.Validate(), schemaErr); err != nil {
+		return nil, nil, err
 	}
 
-	// ClientIDが指定されていない場合、mqtt.NewClientでランダムなものが生成される
-	// QoSのデフォルト
-	if config.MQTT.QoS == 0 {
-		config.MQTT.QoS = 1 // デフォルトはQoS 1
-	}
+	// トピックごとの設定をグローバル設定で補完
+	setDefaults(&config)
 
-	// トピックごとのQoSを確認し、指定されていない場合はグローバル設定を使用
+	return &config, sources, nil
+}
+
+// setDefaults はトピックごとに指定されなかった項目をグローバル設定で補完する
+// グローバル設定のデフォルト値はdefaultsでviperに登録済み
+// ClientIDが指定されていない場合、mqtt.NewClientでランダムなものが生成される
+func setDefaults(config *AppConfig) {
+	// トピックごとのQoSと保持メッセージ設定を確認し、指定されていない場合（nil）はトピックの接続の設定を使用
+	// 明示的に指定したQoS 0やfalseはそのまま使用される
+	// 存在しない接続を指定したトピックは補完せず、Validateでエラーになる
 	for topic, info := range config.Topics {
+		conn, ok := config.Connection(info.Connection)
+		if !ok {
+			continue
+		}
 		if info.QoS == nil {
-			qos := config.MQTT.QoS
-			config.Topics[topic] = TopicInfo{
-				Name:        info.Name,
-				Description: info.Description,
-				QoS:         &qos,
-			}
+			qos := conn.QoS
+			info.QoS = &qos
+		}
+		if info.Retained == nil {
+			retained := conn.Retained
+			info.Retained = &retained
 		}
+		config.Topics[topic] = info
 	}
 }
@@ -1,7 +1,10 @@
 package config
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -28,6 +31,13 @@ topics:
     name: "another/topic"
     description: "別のトピック"
 `
+	// use_ssl が有効な場合はCA証明書ファイルが存在する必要がある
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caFile, []byte("dummy"), 0o600); err != nil {
+		t.Fatalf("CA証明書ファイルの作成に失敗: %v", err)
+	}
+	configContent = strings.ReplaceAll(configContent, "/path/to/ca.crt", caFile)
+
 	tempFile, err := os.CreateTemp("", "config_test*.yaml")
 	if err != nil {
 		t.Fatalf("テスト設定ファイルの作成に失敗: %v", err)
@@ -63,8 +73,8 @@ topics:
 	if !cfg.MQTT.UseSSL {
 		t.Error("UseSSL = false、期待値は true")
 	}
-	if cfg.MQTT.CACertPath != "/path/to/ca.crt" {
-		t.Errorf("CACertPath = %s、期待値は /path/to/ca.crt", cfg.MQTT.CACertPath)
+	if cfg.MQTT.CACertPath != caFile {
+		t.Errorf("CACertPath = %s、期待値は %s", cfg.MQTT.CACertPath, caFile)
 	}
 	if cfg.MQTT.QoS != 2 {
 		t.Errorf("QoS = %d、期待値は 2", cfg.MQTT.QoS)
@@ -153,3 +163,214 @@ topics:
 		t.Errorf("minimal.QoS = %d、期待値は 1 (グローバルデフォルト)", *minimalTopic.QoS)
 	}
 }
+
+func TestLoadConfigTopicFilter(t *testing.T) {
+	configContent := `
+mqtt:
+  qos: 1
+topics:
+  sensors:
+    name: "sensors/data"
+    filter: "value > 50 && device_id in ['a', 'b']"
+`
+	tempFile, err := os.CreateTemp("", "filter_config_test*.yaml")
+	if err != nil {
+		t.Fatalf("テスト設定ファイルの作成に失敗: %v", err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	if _, err := tempFile.Write([]byte(configContent)); err != nil {
+		t.Fatalf("設定内容の書き込みに失敗: %v", err)
+	}
+	if err := tempFile.Close(); err != nil {
+		t.Fatalf("一時ファイルのクローズに失敗: %v", err)
+	}
+
+	cfg, err := LoadConfig(tempFile.Name())
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+
+	sensors := cfg.Topics["sensors"]
+	if sensors.Filter != "value > 50 && device_id in ['a', 'b']" {
+		t.Errorf("sensors.Filter = %s、期待値は value > 50 && device_id in ['a', 'b']", sensors.Filter)
+	}
+	// デフォルトQoSを補完してもフィルター設定は保持される
+	if sensors.QoS == nil || *sensors.QoS != 1 {
+		t.Errorf("sensors.QoS = %v、期待値は 1", sensors.QoS)
+	}
+}
+
+// writeTempConfig は設定内容を一時ファイルに書き込み、そのパスを返す
+func writeTempConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("テスト設定ファイルの作成に失敗: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigValidation(t *testing.T) {
+	path := writeTempConfig(t, `
+mqtt:
+  broker_url: "http://"
+  qos: 3
+topics:
+  bad:
+    name: "sensors/#/temp"
+`)
+
+	_, err := LoadConfig(path)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("LoadConfig のエラー = %v、ValidationError を期待", err)
+	}
+	// すべての問題が一度に報告される
+	// グローバル設定から継承したトピックのQoSは mqtt.qos としてのみ報告される
+	if len(verr.Errors) != 4 {
+		t.Errorf("検証エラー数 = %d、期待値は 4: %v", len(verr.Errors), err)
+	}
+	for _, fe := range verr.Errors {
+		if fe.Path == "topics.bad.qos" {
+			t.Errorf("指定していない topics.bad.qos が報告されました: %v", err)
+		}
+	}
+}
+
+func TestLoadConfigExplicitZero(t *testing.T) {
+	path := writeTempConfig(t, `
+mqtt:
+  qos: 0
+  retained: false
+topics:
+  inherit:
+    name: "inherit/topic"
+  explicit:
+    name: "explicit/topic"
+    qos: 0
+`)
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+	// 明示的に指定したQoS 0はデフォルト値で上書きされない
+	if cfg.MQTT.QoS != 0 {
+		t.Errorf("QoS = %d、期待値は 0", cfg.MQTT.QoS)
+	}
+	if cfg.MQTT.Retained {
+		t.Error("Retained = true、期待値は false")
+	}
+	if q := cfg.Topics["inherit"].QoS; q == nil || *q != 0 {
+		t.Errorf("inherit.QoS = %v、期待値は 0 (グローバル設定からの継承)", q)
+	}
+	if q := cfg.Topics["explicit"].QoS; q == nil || *q != 0 {
+		t.Errorf("explicit.QoS = %v、期待値は 0", q)
+	}
+}
+
+func TestLoadConfigTopicZeroOverridesGlobal(t *testing.T) {
+	path := writeTempConfig(t, `
+mqtt:
+  qos: 2
+  retained: true
+topics:
+  logs:
+    name: "system/logs"
+    qos: 0
+`)
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+	if cfg.MQTT.QoS != 2 {
+		t.Errorf("QoS = %d、期待値は 2", cfg.MQTT.QoS)
+	}
+	if !cfg.MQTT.Retained {
+		t.Error("Retained = false、期待値は true")
+	}
+	// トピックで明示的に指定したQoS 0はグローバル設定で上書きされない
+	if q := cfg.Topics["logs"].QoS; q == nil || *q != 0 {
+		t.Errorf("logs.QoS = %v、期待値は 0", q)
+	}
+}
+
+func TestLoadConfigEnvZero(t *testing.T) {
+	path := writeTempConfig(t, `
+mqtt:
+  qos: 2
+  retained: true
+`)
+	t.Setenv("MQTT_QOS", "0")
+	t.Setenv("MQTT_RETAINED", "false")
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+	// 環境変数で指定したゼロ値も未指定とは区別される
+	if cfg.MQTT.QoS != 0 {
+		t.Errorf("QoS = %d、期待値は 0", cfg.MQTT.QoS)
+	}
+	if cfg.MQTT.Retained {
+		t.Error("Retained = true、期待値は false")
+	}
+}
+
+func TestLoadConfigTopicBindings(t *testing.T) {
+	path := writeTempConfig(t, `
+mqtt:
+  retained: true
+topics:
+  sensors:
+    name: "sensors/data"
+    direction: both
+    retained: false
+    codec: json
+    schema: "schemas/sensor.json"
+    handler: "sensor_data"
+  logs:
+    name: "system/logs"
+    enabled: false
+`)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+
+	sensors := cfg.Topics["sensors"]
+	if sensors.Direction != DirectionBoth || sensors.Codec != CodecJSON || sensors.Schema != "schemas/sensor.json" || sensors.Handler != "sensor_data" {
+		t.Errorf("sensors = %+v", sensors)
+	}
+	// 明示的に指定したfalseはグローバル設定で上書きされない
+	if sensors.Retained == nil || *sensors.Retained {
+		t.Errorf("sensors.Retained = %v、期待値は false", sensors.Retained)
+	}
+	if !sensors.Subscribes() || !sensors.Publishes() {
+		t.Error("direction: both のトピックは公開とサブスクライブの両方を行う")
+	}
+
+	logs := cfg.Topics["logs"]
+	if logs.Retained == nil || !*logs.Retained {
+		t.Errorf("logs.Retained = %v、グローバル設定の true を期待", logs.Retained)
+	}
+	if logs.IsEnabled() || logs.Subscribes() || logs.Publishes() {
+		t.Error("無効なトピックはサブスクライブも公開もしない")
+	}
+}
+
+func TestTopicInfoDefaults(t *testing.T) {
+	var info TopicInfo
+	if !info.IsEnabled() || info.TopicDirection() != DirectionSubscribe || info.PayloadCodec() != CodecJSON {
+		t.Errorf("未指定の場合は有効・subscribe・json を期待: %v %s %s", info.IsEnabled(), info.TopicDirection(), info.PayloadCodec())
+	}
+	if !info.Subscribes() || info.Publishes() {
+		t.Error("未指定の場合はサブスクライブのみを期待")
+	}
+	info.Direction = DirectionPublish
+	if info.Subscribes() || !info.Publishes() {
+		t.Error("direction: publish の場合は公開のみを期待")
+	}
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// DefaultConnection は mqtt セクションの接続の名前
+//
+// 接続が1つの場合は従来どおり mqtt セクションに指定する。複数のブローカーを使用する場合は
+// connections に名前付きの接続を追加し、トピックの connection で使用する接続を指定する:
+//
+//	connections:
+//	  cloud:
+//	    broker_url: "ssl://cloud.example.com:8883"
+//	topics:
+//	  upstream:
+//	    name: "site-a/sensors"
+//	    connection: cloud
+//
+// connection を省略したトピックは mqtt セクションの接続（DefaultConnection）を使用する
+const DefaultConnection = "default"
+
+// Connection は名前の接続の設定を返す
+// 空文字列とDefaultConnectionは mqtt セクションの設定を返す
+func (c *AppConfig) Connection(name string) (MQTTConfig, bool) {
+	if name == "" || name == DefaultConnection {
+		return c.MQTT, true
+	}
+	mc, ok := c.Connections[name]
+	return mc, ok
+}
+
+// ConnectionNames は使用する接続の名前を順に返す
+//
+// connections を指定していない場合は DefaultConnection のみを返す
+// connections を指定した場合、mqtt セクションの接続は使用するトピックがある場合のみ含まれる
+func (c *AppConfig) ConnectionNames() []string {
+	names := slices.Sorted(maps.Keys(c.Connections))
+	if len(c.Connections) == 0 || c.usesDefaultConnection() {
+		names = append([]string{DefaultConnection}, names...)
+	}
+	return names
+}
+
+// usesDefaultConnection はmqttセクションの接続を使用するトピックがあるかを返す
+func (c *AppConfig) usesDefaultConnection() bool {
+	for _, info := range c.Topics {
+		if info.Connection == "" || info.Connection == DefaultConnection {
+			return true
+		}
+	}
+	return false
+}
+
+// connectionKey は接続の設定キーの接頭辞を返す（"mqtt" または "connections.<name>"）
+func connectionKey(name string) string {
+	if name == "" || name == DefaultConnection {
+		return "mqtt"
+	}
+	return "connections." + name
+}
+
+// defaultKey は名前付きの接続の設定キーを、デフォルト値を登録した mqtt セクションのキーに変換する
+// "connections.cloud.qos" は "mqtt.qos" になる
+func defaultKey(key string) string {
+	rest, ok := strings.CutPrefix(key, "connections.")
+	if !ok {
+		return key
+	}
+	if _, field, ok := strings.Cut(rest, "."); ok {
+		return "mqtt." + field
+	}
+	return key
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const connectionsConfig = `
+mqtt:
+  broker_url: "tcp://onsite:1883"
+  qos: 2
+connections:
+  cloud:
+    broker_url: "ssl://cloud:8883"
+    client_id: "bridge"
+    retained: true
+topics:
+  local:
+    name: "sensors/data"
+  upstream:
+    name: "site-a/sensors"
+    connection: cloud
+`
+
+func TestLoadConfigConnections(t *testing.T) {
+	path := writeTempConfig(t, connectionsConfig)
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+
+	// 名前付きの接続にはmqttセクションと同じデフォルト値が使用される
+	want := MQTTConfig{BrokerURL: "ssl://cloud:8883", ClientID: "bridge", QoS: 1, Retained: true}
+	if got, ok := cfg.Connection("cloud"); !ok || got != want {
+		t.Errorf("Connection(cloud) = %+v (%t)、期待値は %+v", got, ok, want)
+	}
+	if got, _ := cfg.Connection(""); got.BrokerURL != "tcp://onsite:1883" {
+		t.Errorf("Connection(\"\").BrokerURL = %s、期待値は mqtt セクションの tcp://onsite:1883", got.BrokerURL)
+	}
+	if _, ok := cfg.Connection("missing"); ok {
+		t.Error("存在しない接続が返されました")
+	}
+	if names := cfg.ConnectionNames(); !slices.Equal(names, []string{DefaultConnection, "cloud"}) {
+		t.Errorf("ConnectionNames() = %v", names)
+	}
+
+	// トピックのQoSと保持メッセージ設定はトピックの接続から補完される
+	local, upstream := cfg.Topics["local"], cfg.Topics["upstream"]
+	if *local.QoS != 2 || *local.Retained {
+		t.Errorf("local = QoS %d, Retained %t、期待値は mqtt セクションの QoS 2, false", *local.QoS, *local.Retained)
+	}
+	if *upstream.QoS != 1 || !*upstream.Retained {
+		t.Errorf("upstream = QoS %d, Retained %t、期待値は cloud の QoS 1, true", *upstream.QoS, *upstream.Retained)
+	}
+}
+
+func TestLoadConfigConnectionOverrides(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "cloud")
+	if err := os.WriteFile(secret, []byte("cloud-secret\n"), 0o600); err != nil {
+		t.Fatalf("パスワードファイルの作成に失敗: %v", err)
+	}
+	path := writeTempConfig(t, connectionsConfig)
+	t.Setenv("GOMQTT_CONNECTIONS_CLOUD_PASSWORD_FILE", secret)
+
+	overrides, _, err := ParseFlags([]string{"--connections.cloud.qos=0"})
+	if err != nil {
+		t.Fatalf("フラグの解析に失敗: %v", err)
+	}
+	cfg, sources, err := LoadConfigWithSources(path, WithOverrides(overrides))
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+	cloud := cfg.Connections["cloud"]
+	if cloud.QoS != 0 || cloud.Password != "cloud-secret" {
+		t.Errorf("cloud = %+v、期待値は QoS 0 と password_file の内容", cloud)
+	}
+	if q := cfg.Topics["upstream"].QoS; *q != 0 {
+		t.Errorf("upstream.QoS = %d、期待値は cloud の 0", *q)
+	}
+
+	for key, want := range map[string]string{
+		"connections.cloud.qos":      "flag --connections.cloud.qos",
+		"connections.cloud.use_ssl":  sourceUnset,
+		"connections.cloud.password": "password_file " + secret,
+		"connections.cloud.retained": "file " + path,
+		"topics.upstream.qos":        "connections.cloud.qos (inherited)",
+		"topics.local.retained":      "mqtt.retained (inherited)",
+	} {
+		if sources[key] != want {
+			t.Errorf("sources[%s] = %q、期待値は %q", key, sources[key], want)
+		}
+	}
+	if sources["connections.cloud.use_ssl"] == "default" {
+		t.Error("デフォルト値のない項目が default になっています")
+	}
+}
+
+func TestConnectionNames(t *testing.T) {
+	// connectionsがない場合はmqttセクションの接続のみ
+	cfg := &AppConfig{Topics: map[string]TopicInfo{"a": {Name: "a"}}}
+	if names := cfg.ConnectionNames(); !slices.Equal(names, []string{DefaultConnection}) {
+		t.Errorf("ConnectionNames() = %v", names)
+	}
+
+	// すべてのトピックが名前付きの接続を使用する場合はmqttセクションの接続を含まない
+	cfg = &AppConfig{
+		Connections: map[string]MQTTConfig{"onsite": {}, "cloud": {}},
+		Topics: map[string]TopicInfo{
+			"a": {Name: "a", Connection: "onsite"},
+			"b": {Name: "b", Connection: "cloud"},
+		},
+	}
+	if names := cfg.ConnectionNames(); !slices.Equal(names, []string{"cloud", "onsite"}) {
+		t.Errorf("ConnectionNames() = %v", names)
+	}
+}
+
+func TestValidateConnections(t *testing.T) {
+	c := validConfig()
+	c.Connections = map[string]MQTTConfig{
+		"cloud":           {BrokerURL: "ssl://cloud:8883", QoS: 1},
+		"bad":             {BrokerURL: "http://bad", QoS: 3},
+		DefaultConnection: {BrokerURL: "tcp://localhost:1883"},
+	}
+	c.Topics["upstream"] = TopicInfo{Name: "up", Connection: "cloud"}
+	c.Topics["orphan"] = TopicInfo{Name: "orphan", Connection: "missing"}
+
+	var verr *ValidationError
+	if err := c.Validate(); !errors.As(err, &verr) {
+		t.Fatalf("Validate のエラー = %v、ValidationError を期待", err)
+	}
+	var got []string
+	for _, fe := range verr.Errors {
+		got = append(got, fe.Path)
+	}
+	want := []string{"connections.bad.broker_url", "connections.bad.qos", "connections.default", "topics.orphan.connection"}
+	if !slices.Equal(got, want) {
+		t.Errorf("エラーのキーパス = %v、期待値は %v", got, want)
+	}
+}
+
+func TestRedactedConnections(t *testing.T) {
+	cfg := &AppConfig{
+		MQTT: MQTTConfig{BrokerURL: "tcp://onsite:1883", Password: "local-secret"},
+		Connections: map[string]MQTTConfig{
+			"cloud": {BrokerURL: "ssl://cloud:8883", Password: "cloud-secret"},
+		},
+		Topics: map[string]TopicInfo{"upstream": {Name: "up", Connection: "cloud"}},
+	}
+
+	red := cfg.Redacted()
+	if got := red.Connections["cloud"].Password; got != redactedValue {
+		t.Errorf("connections.cloud.password = %q、期待値は %q", got, redactedValue)
+	}
+	// 元の設定の接続は変更されない（マップを共有しない）
+	if got := cfg.Connections["cloud"].Password; got != "cloud-secret" {
+		t.Errorf("元の設定の connections.cloud.password = %q、期待値は cloud-secret", got)
+	}
+	if got := cfg.MQTT.Password; got != "local-secret" {
+		t.Errorf("元の設定の mqtt.password = %q、期待値は local-secret", got)
+	}
+	red.Topics["upstream"] = TopicInfo{Name: "changed"}
+	if got := cfg.Topics["upstream"].Name; got != "up" {
+		t.Errorf("元の設定の topics.upstream.name = %q、期待値は up", got)
+	}
+}
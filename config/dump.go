@@ -0,0 +1,107 @@
+package config
+
+import (
+	"io"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redactedValue は伏せた秘密情報の代わりに表示する値
+const redactedValue = "******"
+
+// Redacted は secret:"true" タグが付いた項目を伏せた設定のコピーを返す
+// 空の項目は設定されていないことが分かるようにそのまま残す
+func (c *AppConfig) Redacted() *AppConfig {
+	cp := *c
+	cloneMaps(reflect.ValueOf(&cp).Elem())
+	walkStrings(reflect.ValueOf(&cp).Elem(), "", func(_ string, f reflect.StructField, v reflect.Value) {
+		if f.Tag.Get("secret") == "true" && v.String() != "" {
+			v.SetString(redactedValue)
+		}
+	})
+	return &cp
+}
+
+// cloneMaps は構造体vの（入れ子の構造体を含む）マップの項目をコピーに置き換える
+// walkStringsはマップの要素を書き換えるため、元の設定とマップを共有しないようにする
+func cloneMaps(v reflect.Value) {
+	for i := range v.NumField() {
+		field := v.Field(i)
+		if !v.Type().Field(i).IsExported() {
+			continue
+		}
+		switch field.Kind() {
+		case reflect.Struct:
+			cloneMaps(field)
+		case reflect.Map:
+			if field.IsNil() {
+				continue
+			}
+			m := reflect.MakeMapWithSize(field.Type(), field.Len())
+			iter := field.MapRange()
+			for iter.Next() {
+				elem := reflect.New(field.Type().Elem()).Elem()
+				elem.Set(iter.Value())
+				if elem.Kind() == reflect.Struct {
+					cloneMaps(elem)
+				}
+				m.SetMapIndex(iter.Key(), elem)
+			}
+			field.Set(m)
+		}
+	}
+}
+
+// Dump は設定を設定ファイルと同じキーのYAMLとして書き出す
+// 秘密情報はRedactedと同様に伏せられる
+func (c *AppConfig) Dump(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(configMap(reflect.ValueOf(c.Redacted()).Elem())); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// configMap は構造体vをmapstructureタグのキーを持つマップに変換する
+func configMap(v reflect.Value) map[string]any {
+	m := make(map[string]any)
+	t := v.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if tag == "" || tag == "-" || !f.IsExported() {
+			continue
+		}
+		if val, ok := configValue(v.Field(i)); ok {
+			m[tag] = val
+		}
+	}
+	return m
+}
+
+// configValue はフィールドの値をYAMLに書き出す値に変換する（nilのポインタは省略する）
+func configValue(v reflect.Value) (any, bool) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil, false
+		}
+		return configValue(v.Elem())
+	case reflect.Struct:
+		return configMap(v), true
+	case reflect.Map:
+		m := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			if val, ok := configValue(iter.Value()); ok {
+				m[iter.Key().String()] = val
+			}
+		}
+		return m, true
+	default:
+		return v.Interface(), true
+	}
+}
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// EnvPrefix は環境変数の接頭辞
+// 設定キー "mqtt.broker_url" は GOMQTT_MQTT_BROKER_URL で上書きできる
+// 互換性のため接頭辞なしの名前（MQTT_BROKER_URL）も参照するが、接頭辞付きの名前が優先される
+const EnvPrefix = "GOMQTT"
+
+// envName は設定キーに対応する環境変数名（接頭辞なし）を返す
+func envName(key string) string {
+	return strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// bindEnv はAppConfigのすべての設定キーを環境変数に対応付ける
+//
+// viperのAutomaticEnvは設定ファイルなどで既知のキーしか参照しないため、
+// 構造体のmapstructureタグからキーを列挙して明示的に対応付ける
+// トピックのようなマップのキーは、設定ファイルに含まれるものと環境変数に現れるものを対象にする
+func bindEnv(v *viper.Viper) error {
+	return bindStruct(v, reflect.TypeFor[AppConfig](), "", os.Environ())
+}
+
+// bindStruct は構造体型tのフィールドをprefix以下の設定キーとして対応付ける
+func bindStruct(v *viper.Viper, t reflect.Type, prefix string, environ []string) error {
+	for _, f := range configFields(t) {
+		key := joinKey(prefix, f.key)
+		switch ft := indirect(f.typ); {
+		case ft.Kind() == reflect.Struct:
+			if err := bindStruct(v, ft, key, environ); err != nil {
+				return err
+			}
+		case ft.Kind() == reflect.Map && indirect(ft.Elem()).Kind() == reflect.Struct:
+			elem := indirect(ft.Elem())
+			for name := range mapKeys(v, key, elem, environ) {
+				if err := bindStruct(v, elem, joinKey(key, name), environ); err != nil {
+					return err
+				}
+			}
+		default:
+			name := envName(key)
+			if err := v.BindEnv(key, EnvPrefix+"_"+name, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mapKeys はマップの設定キーkeyの要素名を、設定ファイルと環境変数から集める
+// 環境変数 GOMQTT_TOPICS_MY_TOPIC_QOS からは要素名 "my_topic" を取り出す
+func mapKeys(v *viper.Viper, key string, elem reflect.Type, environ []string) map[string]bool {
+	names := make(map[string]bool)
+	for name := range v.GetStringMap(key) {
+		names[name] = true
+	}
+
+	leaves := leafKeys(elem, "")
+	base := envName(key) + "_"
+	for _, kv := range environ {
+		env, _, _ := strings.Cut(kv, "=")
+		rest, ok := strings.CutPrefix(env, EnvPrefix+"_"+base)
+		if !ok {
+			if rest, ok = strings.CutPrefix(env, base); !ok {
+				continue
+			}
+		}
+		for _, leaf := range leaves {
+			if name, ok := strings.CutSuffix(rest, "_"+envName(leaf)); ok && name != "" {
+				names[strings.ToLower(name)] = true
+			}
+		}
+	}
+	return names
+}
+
+// leafKeys は構造体型tの値を持つ設定キーをprefix以下のパスで列挙する
+func leafKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for _, f := range configFields(t) {
+		key := joinKey(prefix, f.key)
+		switch ft := indirect(f.typ); ft.Kind() {
+		case reflect.Struct:
+			keys = append(keys, leafKeys(ft, key)...)
+		case reflect.Map:
+			// 入れ子のマップは環境変数から要素名を特定できないため対象外
+		default:
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// configField はmapstructureタグを持つ構造体のフィールド
+type configField struct {
+	key string
+	typ reflect.Type
+}
+
+// configFields は構造体型tのmapstructureタグを持つフィールドを返す
+func configFields(t reflect.Type) []configField {
+	var fields []configField
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if tag == "" || tag == "-" || !f.IsExported() {
+			continue
+		}
+		fields = append(fields, configField{key: tag, typ: f.Type})
+	}
+	return fields
+}
+
+// indirect はポインタ型の要素型を返す
+func indirect(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
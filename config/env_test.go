@@ -0,0 +1,183 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadConfigEnvOverrides(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caFile, []byte("dummy"), 0o600); err != nil {
+		t.Fatalf("CA証明書ファイルの作成に失敗: %v", err)
+	}
+
+	path := writeTempConfig(t, `
+mqtt:
+  broker_url: "tcp://file-broker:1883"
+  client_id: "file-client"
+  username: "file-user"
+  password: "file-pass"
+  use_ssl: false
+  ca_cert_path: ""
+  qos: 2
+  retained: false
+topics:
+  sensors:
+    name: "file/sensors"
+    description: "ファイルの説明"
+    qos: 2
+    filter: "value > 1"
+  my_topic:
+    name: "file/my"
+`)
+
+	envs := map[string]string{
+		"GOMQTT_MQTT_BROKER_URL":   "ssl://env-broker:8883",
+		"GOMQTT_MQTT_CLIENT_ID":    "env-client",
+		"GOMQTT_MQTT_USERNAME":     "env-user",
+		"GOMQTT_MQTT_PASSWORD":     "env-pass",
+		"GOMQTT_MQTT_USE_SSL":      "true",
+		"GOMQTT_MQTT_CA_CERT_PATH": caFile,
+		"GOMQTT_MQTT_QOS":          "0",
+		"GOMQTT_MQTT_RETAINED":     "true",
+
+		"GOMQTT_TOPICS_SENSORS_NAME":        "env/sensors",
+		"GOMQTT_TOPICS_SENSORS_DESCRIPTION": "環境変数の説明",
+		"GOMQTT_TOPICS_SENSORS_QOS":         "0",
+		"GOMQTT_TOPICS_SENSORS_FILTER":      "value > 2",
+		"GOMQTT_TOPICS_SENSORS_DIRECTION":   "both",
+		"GOMQTT_TOPICS_SENSORS_RETAINED":    "false",
+		"GOMQTT_TOPICS_SENSORS_CODEC":       "text",
+		"GOMQTT_TOPICS_SENSORS_SCHEMA":      "schemas/env.json",
+		"GOMQTT_TOPICS_SENSORS_HANDLER":     "env_handler",
+		"GOMQTT_TOPICS_SENSORS_ENABLED":     "false",
+		"GOMQTT_TOPICS_SENSORS_CONNECTION":  "cloud",
+
+		// 環境変数にのみ存在する接続
+		"GOMQTT_CONNECTIONS_CLOUD_BROKER_URL": "ssl://cloud:8883",
+
+		// 要素名に _ を含むトピックと、環境変数にのみ存在するトピック
+		"GOMQTT_TOPICS_MY_TOPIC_QOS": "1",
+		"GOMQTT_TOPICS_EXTRA_NAME":   "env/extra",
+	}
+
+	// すべての設定項目が環境変数で上書きされることを確認する
+	for _, key := range leafKeys(reflect.TypeFor[MQTTConfig](), "mqtt") {
+		if key == "mqtt.password_file" {
+			continue // passwordと同時に指定できないため TestLoadConfigPasswordFileEnv で確認する
+		}
+		if _, ok := envs[EnvPrefix+"_"+envName(key)]; !ok {
+			t.Errorf("設定キー %s の環境変数がテストに含まれていません", key)
+		}
+	}
+	for _, key := range leafKeys(reflect.TypeFor[TopicInfo](), "topics.sensors") {
+		if _, ok := envs[EnvPrefix+"_"+envName(key)]; !ok {
+			t.Errorf("設定キー %s の環境変数がテストに含まれていません", key)
+		}
+	}
+	for name, value := range envs {
+		t.Setenv(name, value)
+	}
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+
+	want := MQTTConfig{
+		BrokerURL:  "ssl://env-broker:8883",
+		ClientID:   "env-client",
+		Username:   "env-user",
+		Password:   "env-pass",
+		UseSSL:     true,
+		CACertPath: caFile,
+		QoS:        0,
+		Retained:   true,
+	}
+	if cfg.MQTT != want {
+		t.Errorf("MQTT = %+v、期待値は %+v", cfg.MQTT, want)
+	}
+
+	zero, one := uint8(0), uint8(1)
+	yes, no := true, false
+	wantTopics := map[string]TopicInfo{
+		"sensors": {
+			Name: "env/sensors", Description: "環境変数の説明", QoS: &zero, Filter: "value > 2",
+			Direction: DirectionBoth, Retained: &no, Codec: CodecText, Schema: "schemas/env.json",
+			Handler: "env_handler", Enabled: &no, Connection: "cloud",
+		},
+		"my_topic": {Name: "file/my", QoS: &one, Retained: &yes},
+		"extra":    {Name: "env/extra", QoS: &zero, Retained: &yes}, // グローバル設定（環境変数で0とtrue）を継承
+	}
+	if !reflect.DeepEqual(cfg.Topics, wantTopics) {
+		t.Errorf("Topics = %+v、期待値は %+v", cfg.Topics, wantTopics)
+	}
+
+	// 名前付きの接続にもデフォルト値が使用される
+	wantCloud := MQTTConfig{BrokerURL: "ssl://cloud:8883", QoS: 1}
+	if got := cfg.Connections["cloud"]; got != wantCloud {
+		t.Errorf("Connections[cloud] = %+v、期待値は %+v", got, wantCloud)
+	}
+}
+
+func TestLoadConfigLegacyEnv(t *testing.T) {
+	path := writeTempConfig(t, `
+mqtt:
+  username: "file-user"
+  password: "file-pass"
+topics:
+  sensors:
+    name: "sensors/data"
+`)
+
+	// 接頭辞なしの名前も参照される
+	t.Setenv("MQTT_PASSWORD", "legacy-pass")
+	t.Setenv("TOPICS_SENSORS_QOS", "2")
+	// 両方ある場合は接頭辞付きの名前が優先される
+	t.Setenv("MQTT_USERNAME", "legacy-user")
+	t.Setenv("GOMQTT_MQTT_USERNAME", "env-user")
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+	if cfg.MQTT.Password != "legacy-pass" {
+		t.Errorf("Password = %s、期待値は legacy-pass", cfg.MQTT.Password)
+	}
+	if cfg.MQTT.Username != "env-user" {
+		t.Errorf("Username = %s、期待値は env-user", cfg.MQTT.Username)
+	}
+	if q := cfg.Topics["sensors"].QoS; q == nil || *q != 2 {
+		t.Errorf("sensors.QoS = %v、期待値は 2", q)
+	}
+}
+
+func TestLeafKeys(t *testing.T) {
+	got := leafKeys(reflect.TypeFor[AppConfig](), "")
+	want := []string{
+		"mqtt.broker_url", "mqtt.client_id", "mqtt.username", "mqtt.password",
+		"mqtt.password_file", "mqtt.use_ssl", "mqtt.ca_cert_path", "mqtt.qos", "mqtt.retained",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("leafKeys = %v、期待値は %v", got, want)
+	}
+}
+
+func TestLoadConfigPasswordFileEnv(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "mqtt")
+	if err := os.WriteFile(secret, []byte("file-secret\n"), 0o600); err != nil {
+		t.Fatalf("パスワードファイルの作成に失敗: %v", err)
+	}
+	path := writeTempConfig(t, "mqtt:\n  qos: 1\n")
+	t.Setenv("GOMQTT_MQTT_PASSWORD_FILE", secret)
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+	if cfg.MQTT.PasswordFile != secret || cfg.MQTT.Password != "file-secret" {
+		t.Errorf("PasswordFile = %s, Password = %s、期待値は %s, file-secret", cfg.MQTT.PasswordFile, cfg.MQTT.Password, secret)
+	}
+}
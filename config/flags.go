@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// WithOverrides はコマンドラインで指定された設定値を登録する
+// overridesのキーは設定キー（例: "mqtt.qos", "topics.sensors.qos"）で、
+// 環境変数・設定ファイル・デフォルト値のいずれよりも優先される
+func WithOverrides(overrides map[string]string) LoadOption {
+	return func(o *loadOptions) {
+		for key, val := range overrides {
+			o.overrides[strings.ToLower(key)] = val
+		}
+	}
+}
+
+// ParseFlags はコマンドライン引数から設定キーのフラグを取り出す
+//
+// --mqtt.broker_url=tcp://host:1883、--mqtt.qos 2、--topics.sensors.qos=0 のように
+// "mqtt."、"connections."、"topics." で始まるフラグを設定キーとして扱い、それ以外の引数はrestにそのまま返す
+// flagパッケージと同様に - と -- のどちらも使用でき、真偽値の項目は値を省略するとtrueになる
+// "--" 以降の引数は解析しない
+func ParseFlags(args []string) (overrides map[string]string, rest []string, err error) {
+	overrides = make(map[string]string)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		name, ok := strings.CutPrefix(arg, "-")
+		if !ok {
+			rest = append(rest, arg)
+			continue
+		}
+		name = strings.TrimPrefix(name, "-")
+		key, val, hasValue := strings.Cut(name, "=")
+		key = strings.ToLower(key)
+		if !isConfigFlag(key) {
+			rest = append(rest, arg)
+			continue
+		}
+
+		kind, ok := keyKind(reflect.TypeFor[AppConfig](), strings.Split(key, "."))
+		if !ok {
+			return nil, nil, fmt.Errorf("フラグ %s: 設定キー %s は存在しません", arg, key)
+		}
+		if !hasValue {
+			switch {
+			case kind == reflect.Bool:
+				val = "true"
+			case i+1 < len(args):
+				i++
+				val = args[i]
+			default:
+				return nil, nil, fmt.Errorf("フラグ %s に値が指定されていません", arg)
+			}
+		}
+		overrides[key] = val
+	}
+	return overrides, rest, nil
+}
+
+// keyKind は構造体型tにおける設定キーのパスpartsの値の種類を返す（存在しないキーの場合はfalse）
+// トピックの要素名は任意のため "topics.<name>.<項目>" の形式であればよい
+func keyKind(t reflect.Type, parts []string) (reflect.Kind, bool) {
+	if len(parts) == 0 {
+		return 0, false
+	}
+	for _, f := range configFields(t) {
+		if f.key != parts[0] {
+			continue
+		}
+		switch ft := indirect(f.typ); ft.Kind() {
+		case reflect.Struct:
+			return keyKind(ft, parts[1:])
+		case reflect.Map:
+			// 次の要素はマップのキー
+			if len(parts) < 3 || parts[1] == "" || indirect(ft.Elem()).Kind() != reflect.Struct {
+				return 0, false
+			}
+			return keyKind(indirect(ft.Elem()), parts[2:])
+		default:
+			return ft.Kind(), len(parts) == 1
+		}
+	}
+	return 0, false
+}
+
+// isConfigFlag はフラグ名がAppConfigの項目（"mqtt." など）で始まる場合にtrueを返す
+func isConfigFlag(name string) bool {
+	section, _, ok := strings.Cut(name, ".")
+	if !ok {
+		return false
+	}
+	for _, f := range configFields(reflect.TypeFor[AppConfig]()) {
+		if f.key == section {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	args := []string{
+		"-config", "./site.yaml",
+		"--mqtt.broker_url=tcp://flag:1883",
+		"--mqtt.qos", "0",
+		"-topics.sensors.qos=2",
+		"--mqtt.use_ssl",
+		"--MQTT.Retained=false",
+		"print-config",
+		"--", "--mqtt.qos=1",
+	}
+	overrides, rest, err := ParseFlags(args)
+	if err != nil {
+		t.Fatalf("フラグの解析に失敗: %v", err)
+	}
+
+	want := map[string]string{
+		"mqtt.broker_url":    "tcp://flag:1883",
+		"mqtt.qos":           "0",
+		"topics.sensors.qos": "2",
+		"mqtt.use_ssl":       "true", // 真偽値は値を省略できる
+		"mqtt.retained":      "false",
+	}
+	if !reflect.DeepEqual(overrides, want) {
+		t.Errorf("overrides = %v、期待値は %v", overrides, want)
+	}
+	// 設定キー以外の引数と "--" 以降はそのまま残る
+	wantRest := []string{"-config", "./site.yaml", "print-config", "--", "--mqtt.qos=1"}
+	if !reflect.DeepEqual(rest, wantRest) {
+		t.Errorf("rest = %v、期待値は %v", rest, wantRest)
+	}
+}
+
+func TestParseFlagsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"存在しない項目", []string{"--mqtt.unknown=1"}},
+		{"トピック名なし", []string{"--topics.qos=1"}},
+		{"トピックの存在しない項目", []string{"--topics.sensors.unknown=1"}},
+		{"構造体そのもの", []string{"--mqtt.=1"}},
+		{"値なし", []string{"--mqtt.qos"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ParseFlags(tt.args); err == nil {
+				t.Errorf("ParseFlags(%v) でエラーが返されませんでした", tt.args)
+			}
+		})
+	}
+}
+
+func TestLoadConfigOverrides(t *testing.T) {
+	path := writeTempConfig(t, `
+mqtt:
+  broker_url: "tcp://file-broker:1883"
+  qos: 2
+topics:
+  sensors:
+    name: "sensors/data"
+    qos: 2
+`)
+	t.Setenv("GOMQTT_MQTT_BROKER_URL", "tcp://env-broker:1883")
+	t.Setenv("GOMQTT_TOPICS_SENSORS_QOS", "1")
+
+	overrides, _, err := ParseFlags([]string{
+		"--mqtt.broker_url=tcp://flag-broker:1883",
+		"--topics.sensors.qos=0",
+		"--topics.extra.name=flag/extra",
+	})
+	if err != nil {
+		t.Fatalf("フラグの解析に失敗: %v", err)
+	}
+	cfg, err := LoadConfig(path, WithOverrides(overrides))
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+
+	// フラグは環境変数と設定ファイルより優先される
+	if cfg.MQTT.BrokerURL != "tcp://flag-broker:1883" {
+		t.Errorf("BrokerURL = %s、期待値は tcp://flag-broker:1883", cfg.MQTT.BrokerURL)
+	}
+	if q := cfg.Topics["sensors"].QoS; q == nil || *q != 0 {
+		t.Errorf("sensors.QoS = %v、期待値は 0", q)
+	}
+	if cfg.MQTT.QoS != 2 {
+		t.Errorf("QoS = %d、期待値は 2", cfg.MQTT.QoS)
+	}
+	// フラグにのみ存在するトピックも追加される
+	extra := cfg.Topics["extra"]
+	if extra.Name != "flag/extra" || extra.QoS == nil || *extra.QoS != 2 {
+		t.Errorf("extra = %+v、期待値は flag/extra (QoS 2)", extra)
+	}
+
+	// 不正な値は検証エラーになる
+	if _, err := LoadConfig(path, WithOverrides(map[string]string{"mqtt.qos": "3"})); err == nil {
+		t.Error("不正なQoSでエラーが返されませんでした")
+	}
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// ProfileEnv はWithProfilesを指定しない場合に使用するプロファイルの環境変数（カンマ区切り）
+const ProfileEnv = EnvPrefix + "_PROFILE"
+
+// confDirName は設定ファイルと同じディレクトリにある断片ファイルのディレクトリ名
+const confDirName = "conf.d"
+
+// WithProfiles は基本の設定ファイルに重ねるプロファイルを指定する
+//
+// config.yaml に対してプロファイル "site-a" を指定すると config.site-a.yaml を読み込む
+// 複数指定した場合は指定した順に重ね、後のものが優先される
+// 指定しない場合は環境変数 GOMQTT_PROFILE（例: "staging,site-a"）を使用する
+func WithProfiles(profiles ...string) LoadOption {
+	return func(o *loadOptions) {
+		o.profiles = profiles
+		o.profilesSet = true
+	}
+}
+
+// WithConfDir は断片ファイルのディレクトリを指定する（空文字列の場合は読み込まない）
+// 指定しない場合は設定ファイルと同じディレクトリの conf.d を使用する
+func WithConfDir(dir string) LoadOption {
+	return func(o *loadOptions) {
+		o.confDir = &dir
+	}
+}
+
+// configFiles は重ねる順に設定ファイルの一覧を返す
+//
+// 順序は 基本の設定ファイル → conf.d の断片（ファイル名順）→ プロファイル（指定順）で、
+// 後のファイルほど優先される。プロファイルのファイルが存在しない場合はエラーになる
+func configFiles(configPath string, o *loadOptions) ([]string, error) {
+	files := []string{configPath}
+
+	dir := filepath.Dir(configPath)
+	confDir := filepath.Join(dir, confDirName)
+	if o.confDir != nil {
+		confDir = *o.confDir
+	}
+	if confDir != "" {
+		entries, err := os.ReadDir(confDir)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("ディレクトリ %s の読み込みに失敗: %w", confDir, err)
+		}
+		// os.ReadDirはファイル名順に返す
+		for _, e := range entries {
+			ext := strings.TrimPrefix(filepath.Ext(e.Name()), ".")
+			if !e.IsDir() && slices.Contains(viper.SupportedExts, ext) {
+				files = append(files, filepath.Join(confDir, e.Name()))
+			}
+		}
+	}
+
+	profiles := o.profiles
+	if !o.profilesSet {
+		if env := os.Getenv(ProfileEnv); env != "" {
+			profiles = strings.Split(env, ",")
+		}
+	}
+	ext := filepath.Ext(configPath)
+	base := strings.TrimSuffix(configPath, ext)
+	for _, p := range profiles {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		path := base + "." + p + ext
+		if _, err := os.Stat(path); err != nil {
+			return nil, fmt.Errorf("プロファイル %s の設定ファイルを参照できません: %w", p, err)
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+// mergeConfigFiles は設定ファイルを順に読み込み、1つの設定に重ねる
+//
+// 重ね合わせの規則:
+//   - マップ（mqtt, topics, 各トピックなど）はキーごとに再帰的に重ねる
+//     例えば overlay の topics.sensors.qos は sensors の他の項目を残したまま qos のみを変更する
+//   - 文字列・数値・真偽値・リストは後のファイルの値で置き換える
+//   - null を指定したキーは削除する（例: topics.logs: null でトピック logs を削除）
+//
+// 各設定キーの値を最後に指定したファイルをoriginsとして返す
+func mergeConfigFiles(files []string) (merged map[string]any, origins map[string]string, err error) {
+	merged = make(map[string]any)
+	origins = make(map[string]string)
+	for _, path := range files {
+		fv := viper.New()
+		fv.SetConfigFile(path)
+		if err := fv.ReadInConfig(); err != nil {
+			return nil, nil, fmt.Errorf("設定ファイル %s の読み込みに失敗: %w", path, err)
+		}
+
+		// AllSettingsはnullの値を含まないため、AllKeysから削除するキーを探す
+		for _, key := range fv.AllKeys() {
+			if fv.Get(key) != nil {
+				origins[key] = path
+				continue
+			}
+			deletePath(merged, strings.Split(key, "."))
+			for k := range origins {
+				if k == key || strings.HasPrefix(k, key+".") {
+					delete(origins, k)
+				}
+			}
+		}
+		mergeMaps(merged, fv.AllSettings())
+	}
+	return merged, origins, nil
+}
+
+// mergeMaps はsrcをdstに再帰的に重ねる
+func mergeMaps(dst, src map[string]any) {
+	for key, sv := range src {
+		sm, srcIsMap := sv.(map[string]any)
+		dm, dstIsMap := dst[key].(map[string]any)
+		if srcIsMap && dstIsMap {
+			mergeMaps(dm, sm)
+			continue
+		}
+		if srcIsMap {
+			// 後から変更しても元のファイルの値に影響しないようにコピーする
+			cp := make(map[string]any, len(sm))
+			mergeMaps(cp, sm)
+			sv = cp
+		}
+		dst[key] = sv
+	}
+}
+
+// deletePath はパスのキーを削除する
+func deletePath(m map[string]any, path []string) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := m[key].(map[string]any)
+		if !ok {
+			return
+		}
+		m = next
+	}
+	delete(m, path[len(path)-1])
+}
@@ -0,0 +1,186 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeConfigFiles はディレクトリに設定ファイル群を作成し、基本の設定ファイルのパスを返す
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("ディレクトリの作成に失敗: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("設定ファイルの作成に失敗: %v", err)
+		}
+	}
+	return filepath.Join(dir, "config.yaml")
+}
+
+const baseProfileConfig = `
+mqtt:
+  broker_url: "tcp://localhost:1883"
+  client_id: "base-client"
+  qos: 1
+topics:
+  sensors:
+    name: "sensors/data"
+    description: "センサー"
+  logs:
+    name: "system/logs"
+    qos: 0
+`
+
+func TestLoadConfigProfiles(t *testing.T) {
+	path := writeConfigFiles(t, map[string]string{
+		"config.yaml": baseProfileConfig,
+		"config.staging.yaml": `
+mqtt:
+  broker_url: "tcp://staging:1883"
+topics:
+  sensors:
+    qos: 2
+`,
+		"config.site-a.yaml": `
+mqtt:
+  broker_url: "tcp://site-a:1883"
+topics:
+  logs: null
+  alarms:
+    name: "site-a/alarms"
+`,
+	})
+
+	cfg, err := LoadConfig(path, WithProfiles("staging", "site-a"))
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+
+	// 後に指定したプロファイルが優先され、指定のない項目は基本の設定が残る
+	if cfg.MQTT.BrokerURL != "tcp://site-a:1883" {
+		t.Errorf("BrokerURL = %s、期待値は tcp://site-a:1883", cfg.MQTT.BrokerURL)
+	}
+	if cfg.MQTT.ClientID != "base-client" {
+		t.Errorf("ClientID = %s、期待値は base-client", cfg.MQTT.ClientID)
+	}
+
+	// トピックはキーごとに重ねられる
+	sensors := cfg.Topics["sensors"]
+	if sensors.Name != "sensors/data" || sensors.Description != "センサー" || sensors.QoS == nil || *sensors.QoS != 2 {
+		t.Errorf("sensors = %+v、name と description を残して qos のみ 2 に変更されることを期待", sensors)
+	}
+	if _, ok := cfg.Topics["logs"]; ok {
+		t.Error("null を指定したトピック logs が削除されていません")
+	}
+	if cfg.Topics["alarms"].Name != "site-a/alarms" {
+		t.Errorf("alarms.Name = %s、期待値は site-a/alarms", cfg.Topics["alarms"].Name)
+	}
+}
+
+func TestLoadConfigProfileEnv(t *testing.T) {
+	path := writeConfigFiles(t, map[string]string{
+		"config.yaml":     baseProfileConfig,
+		"config.dev.yaml": "mqtt:\n  client_id: \"dev-client\"\n",
+	})
+
+	t.Setenv(ProfileEnv, "dev")
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+	if cfg.MQTT.ClientID != "dev-client" {
+		t.Errorf("ClientID = %s、期待値は dev-client", cfg.MQTT.ClientID)
+	}
+
+	// WithProfilesは環境変数より優先される
+	cfg, err = LoadConfig(path, WithProfiles())
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+	if cfg.MQTT.ClientID != "base-client" {
+		t.Errorf("ClientID = %s、期待値は base-client", cfg.MQTT.ClientID)
+	}
+}
+
+func TestLoadConfigMissingProfile(t *testing.T) {
+	path := writeConfigFiles(t, map[string]string{"config.yaml": baseProfileConfig})
+	if _, err := LoadConfig(path, WithProfiles("missing")); err == nil {
+		t.Error("存在しないプロファイルでエラーが返されませんでした")
+	}
+}
+
+func TestLoadConfigConfDir(t *testing.T) {
+	path := writeConfigFiles(t, map[string]string{
+		"config.yaml": baseProfileConfig,
+		"conf.d/10-alarms.yaml": `
+topics:
+  alarms:
+    name: "alarms/#"
+    qos: 2
+`,
+		"conf.d/20-override.yaml": `
+topics:
+  alarms:
+    qos: 1
+  sensors: null
+`,
+		"conf.d/README.txt":    "読み込まれない",
+		"config.override.yaml": "topics:\n  alarms:\n    qos: 0\n",
+	})
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+	// 断片はファイル名順に重ねられる
+	alarms := cfg.Topics["alarms"]
+	if alarms.Name != "alarms/#" || alarms.QoS == nil || *alarms.QoS != 1 {
+		t.Errorf("alarms = %+v、期待値は alarms/# (QoS 1)", alarms)
+	}
+	if _, ok := cfg.Topics["sensors"]; ok {
+		t.Error("null を指定したトピック sensors が削除されていません")
+	}
+	if _, ok := cfg.Topics["logs"]; !ok {
+		t.Error("基本の設定のトピック logs がありません")
+	}
+
+	// プロファイルは断片より後に重ねられる
+	cfg, err = LoadConfig(path, WithProfiles("override"))
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+	if q := cfg.Topics["alarms"].QoS; q == nil || *q != 0 {
+		t.Errorf("alarms.QoS = %v、期待値は 0", q)
+	}
+
+	// WithConfDir("") で断片を読み込まない
+	cfg, err = LoadConfig(path, WithConfDir(""))
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+	if _, ok := cfg.Topics["alarms"]; ok {
+		t.Error("WithConfDir(\"\") でも断片が読み込まれました")
+	}
+}
+
+func TestLoadConfigProfileEnvOverride(t *testing.T) {
+	path := writeConfigFiles(t, map[string]string{
+		"config.yaml":      baseProfileConfig,
+		"config.prod.yaml": "topics:\n  sensors:\n    qos: 2\n",
+	})
+
+	// 環境変数はすべてのファイルより優先される
+	t.Setenv("GOMQTT_TOPICS_SENSORS_QOS", "0")
+	cfg, err := LoadConfig(path, WithProfiles("prod"))
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+	if q := cfg.Topics["sensors"].QoS; q == nil || *q != 0 {
+		t.Errorf("sensors.QoS = %v、期待値は 0", q)
+	}
+}
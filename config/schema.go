@@ -0,0 +1,396 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// schemaDraft は生成するJSON Schemaのバージョン
+const schemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema はJSON Schema（draft 2020-12）のうち、設定ファイルの記述に使用するキーワード
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Const                any                `json:"const,omitempty"`
+	Default              any                `json:"default,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	PatternProperties    map[string]*Schema `json:"patternProperties,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"` // false または *Schema
+	PropertyNames        *Schema            `json:"propertyNames,omitempty"`
+	Not                  *Schema            `json:"not,omitempty"`
+	Defs                 map[string]*Schema `json:"$defs,omitempty"`
+}
+
+// schemaEnums は設定キーの末尾の要素ごとに指定できる値
+var schemaEnums = map[string][]any{
+	"qos":       {0, 1, 2},
+	"direction": anySlice(topicDirections),
+	"codec":     anySlice(payloadCodecs),
+}
+
+// topicDefaults はトピックの項目を省略した場合の値（TopicInfoのメソッドと同じ値）
+var topicDefaults = map[string]any{
+	"direction": DirectionSubscribe,
+	"codec":     CodecJSON,
+	"enabled":   true,
+}
+
+// extensionKeyPattern は構造体の項目以外に指定できる拡張キー（YAMLのアンカーの定義などに使用する）
+const extensionKeyPattern = "^x-"
+
+// JSONSchema はAppConfigの構造体から設定ファイルのJSON Schemaを生成する
+//
+// 各項目の説明はmapstructureタグと同じフィールドのdescタグから、デフォルト値はdefaultsから取得する
+// 構造体はそれぞれ $defs に定義し、$ref で参照する
+// 構造体には定義された項目のほか、x- で始まる任意の拡張キーを指定できる
+// エディターで使用するには、設定ファイルの先頭に次のコメントを追加する:
+//
+//	# yaml-language-server: $schema=./config.schema.json
+func JSONSchema() *Schema {
+	g := schemaGenerator{defs: make(map[string]*Schema)}
+	root := g.structSchema(reflect.TypeFor[AppConfig]())
+	root.Schema = schemaDraft
+	root.Title = "go-mqtt の設定ファイル"
+	root.Defs = g.defs
+
+	// default は mqtt セクションの接続の名前として予約されている
+	root.Properties["connections"].PropertyNames = &Schema{Not: &Schema{Const: DefaultConnection}}
+	return root
+}
+
+// WriteJSONSchema はJSONSchemaをインデントしたJSONとして書き出す
+func WriteJSONSchema(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(JSONSchema())
+}
+
+// appSchema はLoadConfigで設定ファイルの検証に使用するJSON Schema
+var appSchema = sync.OnceValue(JSONSchema)
+
+// WithStrictSchema は設定ファイルの不明な項目をエラーにする
+// 指定しない場合、不明な項目は警告として報告し（WithWarningHandler）、読み込みを続ける
+func WithStrictSchema() LoadOption {
+	return func(o *loadOptions) {
+		o.strict = true
+	}
+}
+
+// WithWarningHandler は読み込みを中断しない問題（不明な項目など）の報告先を設定する
+// 指定しない場合は標準のロガーに出力する
+func WithWarningHandler(fn func(*FieldError)) LoadOption {
+	return func(o *loadOptions) {
+		o.warn = fn
+	}
+}
+
+// validateSchema は設定ファイルを重ねた結果docをスキーマで検証する
+// 不明な項目はWithStrictSchemaを指定した場合のみエラーに含め、それ以外は警告として報告する
+func validateSchema(doc any, o *loadOptions) error {
+	errs, unknown := appSchema().validateDoc(doc)
+	if o.strict {
+		errs = append(errs, unknown...)
+	} else if o.warn != nil {
+		for _, fe := range unknown {
+			o.warn(fe)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	slices.SortStableFunc(errs, func(a, b *FieldError) int { return strings.Compare(a.Path, b.Path) })
+	return &ValidationError{Errors: errs}
+}
+
+// schemaGenerator は構造体の型からJSON Schemaを生成する
+type schemaGenerator struct {
+	defs map[string]*Schema
+}
+
+// structSchema は構造体型tのスキーマを返す（定義されていない項目は拡張キーを除いて指定できない）
+func (g *schemaGenerator) structSchema(t reflect.Type) *Schema {
+	s := &Schema{
+		Type:                 "object",
+		Properties:           make(map[string]*Schema),
+		PatternProperties:    map[string]*Schema{extensionKeyPattern: {}},
+		AdditionalProperties: false,
+	}
+	for i := range t.NumField() {
+		f := t.Field(i)
+		key, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if key == "" || key == "-" || !f.IsExported() {
+			continue
+		}
+		fs := g.typeSchema(f.Type)
+		fs.Description = f.Tag.Get("desc")
+		if enum, ok := schemaEnums[key]; ok && fs.Ref == "" {
+			fs.Enum = enum
+			fs.Minimum, fs.Maximum = nil, nil
+		}
+		if def, ok := fieldDefault(t, key); ok {
+			fs.Default = def
+		}
+		s.Properties[key] = fs
+	}
+	return s
+}
+
+// typeSchema はフィールドの型tのスキーマを返す
+func (g *schemaGenerator) typeSchema(t reflect.Type) *Schema {
+	t = indirect(t)
+	switch t.Kind() {
+	case reflect.Struct:
+		if _, ok := g.defs[t.Name()]; !ok {
+			g.defs[t.Name()] = nil // 再帰する型に備えて先に登録する
+			g.defs[t.Name()] = g.structSchema(t)
+		}
+		return &Schema{Ref: "#/$defs/" + t.Name()}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.typeSchema(t.Elem())}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		lo, hi := 0.0, float64(uint64(math.MaxUint64)>>(64-t.Bits()))
+		return &Schema{Type: "integer", Minimum: &lo, Maximum: &hi}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	default:
+		return &Schema{}
+	}
+}
+
+// fieldDefault は構造体型tの項目keyのデフォルト値を返す
+// 名前付きの接続にもmqttセクションと同じdefaultsが使用される
+func fieldDefault(t reflect.Type, key string) (any, bool) {
+	var val any
+	var ok bool
+	switch t {
+	case reflect.TypeFor[MQTTConfig]():
+		val, ok = defaults["mqtt."+key]
+	case reflect.TypeFor[TopicInfo]():
+		val, ok = topicDefaults[key]
+	}
+	return val, ok
+}
+
+// Validate は設定ファイルの内容docをスキーマで検証し、すべての問題を*ValidationErrorとして返す
+// docはYAMLやJSONを読み込んだ値（map[string]any など）で、問題がない場合はnilを返す
+// 不明な項目も問題として報告する（LoadConfigはWithStrictSchemaを指定した場合のみエラーにする）
+func (s *Schema) Validate(doc any) error {
+	errs, unknown := s.validateDoc(doc)
+	errs = append(errs, unknown...)
+	if len(errs) > 0 {
+		slices.SortStableFunc(errs, func(a, b *FieldError) int { return strings.Compare(a.Path, b.Path) })
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// validateDoc はdocを検証し、不明な項目とそれ以外の問題を分けて返す
+func (s *Schema) validateDoc(doc any) (errs, unknown []*FieldError) {
+	sv := schemaValidator{root: s}
+	sv.validate(s, doc, "")
+	return sv.errs, sv.unknown
+}
+
+// schemaValidator はスキーマによる検証エラーを収集する
+type schemaValidator struct {
+	validator
+	root    *Schema
+	unknown []*FieldError // additionalProperties: false で許可されていない項目
+}
+
+func (sv *schemaValidator) validate(s *Schema, v any, path string) {
+	if s.Ref != "" {
+		name, ok := strings.CutPrefix(s.Ref, "#/$defs/")
+		def := sv.root.Defs[name]
+		if !ok || def == nil {
+			sv.addf(path, "スキーマの参照 %s を解決できません", s.Ref)
+			return
+		}
+		s = def
+	}
+
+	if s.Type != "" && !hasType(v, s.Type) {
+		sv.addf(path, "%s を指定してください（%s）", typeName(s.Type), describeValue(v))
+		return
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return equalValue(e, v) }) {
+		sv.addf(path, "%s は指定できません（%s のいずれかを指定）", describeValue(v), joinValues(s.Enum))
+	}
+	if s.Const != nil && !equalValue(s.Const, v) {
+		sv.addf(path, "%s を指定してください（%s）", describeValue(s.Const), describeValue(v))
+	}
+	if s.Not != nil {
+		inner := schemaValidator{root: sv.root}
+		inner.validate(s.Not, v, path)
+		if len(inner.errs) == 0 && len(inner.unknown) == 0 {
+			sv.addf(path, "%s は指定できません", describeValue(v))
+		}
+	}
+	if n, ok := toFloat(v); ok {
+		if s.Minimum != nil && n < *s.Minimum {
+			sv.addf(path, "%v 以上を指定してください（%v）", *s.Minimum, v)
+		}
+		if s.Maximum != nil && n > *s.Maximum {
+			sv.addf(path, "%v 以下を指定してください（%v）", *s.Maximum, v)
+		}
+	}
+
+	m, ok := v.(map[string]any)
+	if !ok {
+		return
+	}
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		child := joinKey(path, key)
+		if s.PropertyNames != nil {
+			sv.validate(s.PropertyNames, key, child)
+		}
+		if ps, ok := s.Properties[key]; ok {
+			sv.validate(ps, m[key], child)
+			continue
+		}
+		if ps, ok := s.patternSchema(key); ok {
+			sv.validate(ps, m[key], child)
+			continue
+		}
+		switch ap := s.AdditionalProperties.(type) {
+		case bool:
+			if !ap {
+				sv.unknown = append(sv.unknown, &FieldError{Path: child, Message: "不明な項目です"})
+			}
+		case *Schema:
+			sv.validate(ap, m[key], child)
+		}
+	}
+}
+
+// patternSchema はキーに一致するpatternPropertiesのスキーマを返す
+func (s *Schema) patternSchema(key string) (*Schema, bool) {
+	for _, pattern := range slices.Sorted(maps.Keys(s.PatternProperties)) {
+		if ok, _ := regexp.MatchString(pattern, key); ok {
+			return s.PatternProperties[pattern], true
+		}
+	}
+	return nil, false
+}
+
+// hasType は値vがJSON Schemaの型typに一致するかを返す
+func hasType(v any, typ string) bool {
+	switch typ {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "integer":
+		n, ok := toFloat(v)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := toFloat(v)
+		return ok
+	default:
+		return true
+	}
+}
+
+// toFloat は数値をfloat64に変換する
+func toFloat(v any) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+// equalValue は数値の型の違いを無視して値を比較する
+func equalValue(a, b any) bool {
+	if x, ok := toFloat(a); ok {
+		y, ok := toFloat(b)
+		return ok && x == y
+	}
+	return a == b
+}
+
+func typeName(typ string) string {
+	switch typ {
+	case "object":
+		return "マップ"
+	case "string":
+		return "文字列"
+	case "boolean":
+		return "true または false"
+	case "integer":
+		return "整数"
+	case "number":
+		return "数値"
+	default:
+		return typ
+	}
+}
+
+func describeValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "値がありません"
+	case string:
+		return fmt.Sprintf("%q", v)
+	case map[string]any:
+		return "マップ"
+	case []any:
+		return "リスト"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func joinValues(vals []any) string {
+	s := make([]string, len(vals))
+	for i, v := range vals {
+		s[i] = fmt.Sprint(v)
+	}
+	return strings.Join(s, ", ")
+}
+
+func anySlice[T any](s []T) []any {
+	out := make([]any, len(s))
+	for i, v := range s {
+		out[i] = v
+	}
+	return out
+}
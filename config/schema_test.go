@@ -0,0 +1,293 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestJSONSchema(t *testing.T) {
+	s := JSONSchema()
+	if s.Schema != schemaDraft {
+		t.Errorf("$schema = %q、期待値は %q", s.Schema, schemaDraft)
+	}
+	for _, key := range []string{"mqtt", "connections", "topics"} {
+		if p, ok := s.Properties[key]; !ok || p.Description == "" {
+			t.Errorf("%s の説明がありません: %+v", key, p)
+		}
+	}
+
+	mqtt := s.Defs["MQTTConfig"]
+	if mqtt == nil {
+		t.Fatal("$defs に MQTTConfig がありません")
+	}
+	if got := mqtt.Properties["broker_url"].Default; got != "tcp://localhost:1883" {
+		t.Errorf("broker_url のデフォルト値 = %v", got)
+	}
+	qos := mqtt.Properties["qos"]
+	if !slices.Equal(qos.Enum, []any{0, 1, 2}) || qos.Maximum != nil {
+		t.Errorf("qos のスキーマ = %+v、期待値は enum [0 1 2]", qos)
+	}
+	if qos.Default == nil || qos.Description == "" {
+		t.Errorf("qos のデフォルト値または説明がありません: %+v", qos)
+	}
+
+	topic := s.Defs["TopicInfo"]
+	if topic == nil {
+		t.Fatal("$defs に TopicInfo がありません")
+	}
+	if got := topic.Properties["direction"]; got.Default != DirectionSubscribe || len(got.Enum) != len(topicDirections) {
+		t.Errorf("direction のスキーマ = %+v", got)
+	}
+	if got := topic.Properties["codec"].Default; got != CodecJSON {
+		t.Errorf("codec のデフォルト値 = %v、期待値は %s", got, CodecJSON)
+	}
+	if got := topic.Properties["qos"]; len(got.Enum) != 3 || got.Default != nil {
+		t.Errorf("トピックの qos のスキーマ = %+v（省略時は接続の値を使用するためデフォルト値なし）", got)
+	}
+	for key, p := range topic.Properties {
+		if p.Description == "" {
+			t.Errorf("topics.*.%s の説明がありません", key)
+		}
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		yaml  string
+		paths []string
+	}{
+		{
+			name: "正常",
+			yaml: `
+mqtt:
+  broker_url: "tcp://localhost:1883"
+  qos: 1
+connections:
+  cloud:
+    broker_url: "ssl://cloud.example.com:8883"
+topics:
+  sensors:
+    name: "sensors/#"
+    direction: both
+    retained: false
+`,
+		},
+		{
+			name: "不明な項目",
+			yaml: `
+mqtt:
+  broker: "tcp://localhost:1883"
+topics:
+  sensors:
+    name: "sensors/data"
+    handlr: "log"
+extra: 1
+`,
+			paths: []string{"extra", "mqtt.broker", "topics.sensors.handlr"},
+		},
+		{
+			name: "拡張キー",
+			yaml: `
+x-defaults:
+  qos: 1
+mqtt:
+  x-note: "メモ"
+topics:
+  sensors:
+    name: "sensors/data"
+    x-owner: "team-a"
+`,
+		},
+		{
+			name: "型の誤り",
+			yaml: `
+mqtt:
+  use_ssl: "yes"
+  qos: 1.5
+topics:
+  sensors: "sensors/data"
+`,
+			paths: []string{"mqtt.qos", "mqtt.use_ssl", "topics.sensors"},
+		},
+		{
+			name: "列挙値以外",
+			yaml: `
+mqtt:
+  qos: 3
+topics:
+  sensors:
+    name: "sensors/data"
+    direction: "in"
+    codec: "xml"
+`,
+			paths: []string{"mqtt.qos", "topics.sensors.codec", "topics.sensors.direction"},
+		},
+		{
+			name: "予約された接続の名前",
+			yaml: `
+connections:
+  default:
+    broker_url: "tcp://localhost:1883"
+`,
+			paths: []string{"connections.default"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc map[string]any
+			if err := yaml.Unmarshal([]byte(tt.yaml), &doc); err != nil {
+				t.Fatalf("YAMLの解析に失敗: %v", err)
+			}
+			err := JSONSchema().Validate(doc)
+			if len(tt.paths) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() = %v、エラーなしを期待", err)
+				}
+				return
+			}
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("Validate() = %v、ValidationError を期待", err)
+			}
+			var got []string
+			for _, fe := range verr.Errors {
+				got = append(got, fe.Path)
+			}
+			if !slices.Equal(got, tt.paths) {
+				t.Errorf("エラーのキーパス = %v、期待値は %v（%v）", got, tt.paths, err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigSchema(t *testing.T) {
+	path := writeTempConfig(t, `
+mqtt:
+  broker_url: "tcp://localhost:1883"
+  client_idd: "typo"
+  qos: 3
+topics:
+  sensors:
+    name: "sensors/data"
+`)
+
+	// WithStrictSchemaを指定すると不明な項目もエラーになる
+	_, err := LoadConfig(path, WithStrictSchema())
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("LoadConfig のエラー = %v、ValidationError を期待", err)
+	}
+	// 不明な項目はスキーマ、QoSはValidateが報告し、同じキーパスのエラーは重複しない
+	// トピックが継承したQoSは報告しない
+	var got []string
+	for _, fe := range verr.Errors {
+		got = append(got, fe.Path)
+	}
+	slices.Sort(got)
+	if want := []string{"mqtt.client_idd", "mqtt.qos"}; !slices.Equal(got, want) {
+		t.Errorf("エラーのキーパス = %v、期待値は %v（%v）", got, want, err)
+	}
+
+	// 指定しない場合、不明な項目は警告になり、それ以外の問題のみエラーになる
+	var warnings []string
+	_, err = LoadConfig(path, WithWarningHandler(func(fe *FieldError) { warnings = append(warnings, fe.Path) }))
+	if !errors.As(err, &verr) || len(verr.Errors) != 1 || verr.Errors[0].Path != "mqtt.qos" {
+		t.Errorf("LoadConfig のエラー = %v、mqtt.qos のみを期待", err)
+	}
+	if want := []string{"mqtt.client_idd"}; !slices.Equal(warnings, want) {
+		t.Errorf("警告 = %v、期待値は %v", warnings, want)
+	}
+
+	// 型の誤りで解析できない場合もキーパスとともに報告される
+	path = writeTempConfig(t, `
+mqtt:
+  qos: "high"
+`)
+	_, err = LoadConfig(path)
+	if err == nil || !strings.Contains(err.Error(), "mqtt.qos") {
+		t.Errorf("型の誤りのエラー = %v、mqtt.qos を含むことを期待", err)
+	}
+}
+
+func TestLoadConfigUnknownKeys(t *testing.T) {
+	// YAMLのアンカーを定義する拡張キーや、このバージョンが知らない項目を含む設定ファイル
+	path := writeTempConfig(t, `
+x-sensor: &sensor
+  qos: 0
+  codec: text
+mqtt:
+  broker_url: "tcp://localhost:1883"
+  keepalive: 30
+topics:
+  sensors:
+    <<: *sensor
+    name: "sensors/data"
+    x-owner: "team-a"
+  alerts:
+    <<: *sensor
+    name: "alerts/#"
+`)
+
+	// デフォルトでは不明な項目があっても読み込める
+	var warnings []string
+	cfg, err := LoadConfig(path, WithWarningHandler(func(fe *FieldError) { warnings = append(warnings, fe.Path) }))
+	if err != nil {
+		t.Fatalf("LoadConfig() 失敗: %v", err)
+	}
+	if info := cfg.Topics["alerts"]; info.Codec != CodecText || *info.QoS != 0 {
+		t.Errorf("アンカーを展開したトピック = %+v", info)
+	}
+	// 拡張キー（x-）は警告されない
+	if want := []string{"mqtt.keepalive"}; !slices.Equal(warnings, want) {
+		t.Errorf("警告 = %v、期待値は %v", warnings, want)
+	}
+
+	// WithStrictSchemaを指定した場合も拡張キーはエラーにならない
+	_, err = LoadConfig(path, WithStrictSchema())
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Errors) != 1 || verr.Errors[0].Path != "mqtt.keepalive" {
+		t.Errorf("LoadConfig のエラー = %v、mqtt.keepalive のみを期待", err)
+	}
+}
+
+func TestWriteJSONSchema(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteJSONSchema(&buf); err != nil {
+		t.Fatalf("WriteJSONSchema() 失敗: %v", err)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("出力がJSONとして解析できません: %v", err)
+	}
+
+	// リポジトリの config.schema.json は go generate で再生成する
+	committed, err := os.ReadFile("../config.schema.json")
+	if err != nil {
+		t.Fatalf("config.schema.json の読み込みに失敗: %v", err)
+	}
+	if !bytes.Equal(committed, buf.Bytes()) {
+		t.Error("config.schema.json が最新ではありません（go generate で再生成してください）")
+	}
+
+	// リポジトリの config.yaml はスキーマに適合する
+	data, err := os.ReadFile("../config.yaml")
+	if err != nil {
+		t.Fatalf("config.yaml の読み込みに失敗: %v", err)
+	}
+	var cfg map[string]any
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		t.Fatalf("config.yaml の解析に失敗: %v", err)
+	}
+	if err := JSONSchema().Validate(cfg); err != nil {
+		t.Errorf("config.yaml がスキーマに適合しません: %v", err)
+	}
+}
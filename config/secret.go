@@ -0,0 +1,165 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// SecretProvider は設定値に含まれる秘密情報の参照を解決する
+//
+// 設定値の ${scheme:ref} は、schemeに登録されたSecretProviderのResolve(ref)の結果で置き換えられる
+// 標準では ${env:NAME}（環境変数）と ${file:/path}（ファイルの内容）が使用できる
+// 参照を解決するのは secretref:"true" タグが付いた認証情報の項目（username, password, ca_cert_path）のみで、
+// トピック名やフィルターなどの他の項目の ${...} はそのままの文字列として扱う
+type SecretProvider interface {
+	Resolve(ref string) (string, error)
+}
+
+// SecretProviderFunc は関数をSecretProviderとして使用するためのアダプター
+type SecretProviderFunc func(ref string) (string, error)
+
+func (f SecretProviderFunc) Resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+// EnvSecretProvider は環境変数の値を返す
+var EnvSecretProvider = SecretProviderFunc(func(name string) (string, error) {
+	val, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("環境変数 %s が設定されていません", name)
+	}
+	return val, nil
+})
+
+// FileSecretProvider はファイルの内容を末尾の改行を除いて返す
+var FileSecretProvider = SecretProviderFunc(readSecretFile)
+
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("秘密情報のファイルの読み込みに失敗: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// WithSecretProvider は ${scheme:ref} の参照を解決するSecretProviderを登録する
+// 標準の "env" と "file" も置き換えられる
+func WithSecretProvider(scheme string, p SecretProvider) LoadOption {
+	return func(o *loadOptions) {
+		o.providers[scheme] = p
+	}
+}
+
+// secretRef は設定値に含まれる秘密情報の参照
+var secretRef = regexp.MustCompile(`\$\{([A-Za-z][A-Za-z0-9_-]*):([^}]*)\}`)
+
+// resolveSecrets は secretref:"true" タグが付いた項目の参照を解決し、password_fileを読み込む
+// 失敗した項目はキーパスとともに*ValidationErrorとしてまとめて返す
+func resolveSecrets(config *AppConfig, providers map[string]SecretProvider) error {
+	var errs []*FieldError
+	walkStrings(reflect.ValueOf(config).Elem(), "", func(path string, f reflect.StructField, v reflect.Value) {
+		if f.Tag.Get("secretref") != "true" {
+			return
+		}
+		resolved, err := expandSecrets(v.String(), providers)
+		if err != nil {
+			errs = append(errs, &FieldError{Path: path, Message: err.Error()})
+			return
+		}
+		v.SetString(resolved)
+	})
+
+	if fe := readPasswordFile(&config.MQTT, "mqtt"); fe != nil {
+		errs = append(errs, fe)
+	}
+	for _, name := range sortedKeys(config.Connections) {
+		mc := config.Connections[name]
+		if fe := readPasswordFile(&mc, connectionKey(name)); fe != nil {
+			errs = append(errs, fe)
+		}
+		config.Connections[name] = mc
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// readPasswordFile は接続のpassword_fileを読み込んでPasswordに設定する
+// prefixはエラーに含める接続の設定キー（"mqtt" または "connections.<name>"）
+func readPasswordFile(mc *MQTTConfig, prefix string) *FieldError {
+	if mc.PasswordFile == "" {
+		return nil
+	}
+	path := prefix + ".password_file"
+	if mc.Password != "" {
+		return &FieldError{Path: path, Message: "password と password_file は同時に指定できません"}
+	}
+	pw, err := readSecretFile(mc.PasswordFile)
+	if err != nil {
+		return &FieldError{Path: path, Message: err.Error()}
+	}
+	mc.Password = pw
+	return nil
+}
+
+// expandSecrets は文字列に含まれるすべての参照を解決する
+func expandSecrets(s string, providers map[string]SecretProvider) (string, error) {
+	var firstErr error
+	out := secretRef.ReplaceAllStringFunc(s, func(match string) string {
+		m := secretRef.FindStringSubmatch(match)
+		scheme, ref := m[1], m[2]
+		p, ok := providers[scheme]
+		if !ok {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("秘密情報の参照 %s のスキーム %q は登録されていません", match, scheme)
+			}
+			return match
+		}
+		val, err := p.Resolve(ref)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("秘密情報の参照 %s の解決に失敗: %w", match, err)
+			}
+			return match
+		}
+		return val
+	})
+	return out, firstErr
+}
+
+// walkStrings は構造体vの文字列フィールドについて、設定キーのパスとともにfnを呼び出す
+// マップの要素はコピーを変更して書き戻す
+func walkStrings(v reflect.Value, prefix string, fn func(path string, f reflect.StructField, v reflect.Value)) {
+	t := v.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag, _, _ := strings.Cut(f.Tag.Get("mapstructure"), ",")
+		if tag == "" || tag == "-" || !f.IsExported() {
+			continue
+		}
+		path := joinKey(prefix, tag)
+		field := v.Field(i)
+
+		switch field.Kind() {
+		case reflect.String:
+			fn(path, f, field)
+		case reflect.Struct:
+			walkStrings(field, path, fn)
+		case reflect.Map:
+			if field.Type().Elem().Kind() != reflect.Struct {
+				continue
+			}
+			iter := field.MapRange()
+			for iter.Next() {
+				elem := reflect.New(field.Type().Elem()).Elem()
+				elem.Set(iter.Value())
+				walkStrings(elem, joinKey(path, iter.Key().String()), fn)
+				field.SetMapIndex(iter.Key(), elem)
+			}
+		}
+	}
+}
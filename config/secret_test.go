@@ -0,0 +1,153 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigSecretReferences(t *testing.T) {
+	dir := t.TempDir()
+	userFile := filepath.Join(dir, "user")
+	if err := os.WriteFile(userFile, []byte("file-user\r\n"), 0o600); err != nil {
+		t.Fatalf("秘密情報のファイルの作成に失敗: %v", err)
+	}
+	t.Setenv("TEST_MQTT_PASS", "env-pass")
+	t.Setenv("TEST_BROKER_HOST", "broker.example.com")
+	t.Setenv("TEST_CA_CERT", "/etc/ssl/ca.pem")
+
+	path := writeTempConfig(t, `
+mqtt:
+  broker_url: "tcp://broker:1883"
+  username: "${file:`+userFile+`}"
+  password: "${env:TEST_MQTT_PASS}"
+  ca_cert_path: "${env:TEST_CA_CERT}"
+topics:
+  sensors:
+    name: "sensors/${env:TEST_BROKER_HOST}"
+    description: "${env:TEST_BROKER_HOST} のセンサー"
+`)
+
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+	if cfg.MQTT.Username != "file-user" {
+		t.Errorf("Username = %q、期待値は file-user", cfg.MQTT.Username)
+	}
+	if cfg.MQTT.Password != "env-pass" {
+		t.Errorf("Password = %q、期待値は env-pass", cfg.MQTT.Password)
+	}
+	if cfg.MQTT.CACertPath != "/etc/ssl/ca.pem" {
+		t.Errorf("CACertPath = %q、期待値は /etc/ssl/ca.pem", cfg.MQTT.CACertPath)
+	}
+	// 認証情報以外の項目の参照は解決しない
+	sensors := cfg.Topics["sensors"]
+	if sensors.Name != "sensors/${env:TEST_BROKER_HOST}" {
+		t.Errorf("sensors.Name = %s、参照がそのまま残ることを期待", sensors.Name)
+	}
+	if sensors.Description != "${env:TEST_BROKER_HOST} のセンサー" {
+		t.Errorf("sensors.Description = %s、参照がそのまま残ることを期待", sensors.Description)
+	}
+}
+
+func TestLoadConfigPasswordFile(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "mqtt")
+	if err := os.WriteFile(secret, []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatalf("パスワードファイルの作成に失敗: %v", err)
+	}
+
+	cfg, err := LoadConfig(writeTempConfig(t, "mqtt:\n  password_file: "+secret+"\n"))
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+	if cfg.MQTT.Password != "s3cret" {
+		t.Errorf("Password = %q、期待値は s3cret", cfg.MQTT.Password)
+	}
+
+	// passwordと同時に指定した場合はエラー
+	_, err = LoadConfig(writeTempConfig(t, "mqtt:\n  password: x\n  password_file: "+secret+"\n"))
+	var fe *FieldError
+	if !errors.As(err, &fe) || fe.Path != "mqtt.password_file" {
+		t.Errorf("エラー = %v、mqtt.password_file の FieldError を期待", err)
+	}
+}
+
+func TestLoadConfigSecretErrors(t *testing.T) {
+	path := writeTempConfig(t, `
+mqtt:
+  username: "${vault:secret/mqtt#user}"
+  password: "${env:TEST_UNDEFINED_SECRET}"
+`)
+
+	_, err := LoadConfig(path)
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("エラー = %v、ValidationError を期待", err)
+	}
+	var paths []string
+	for _, fe := range verr.Errors {
+		paths = append(paths, fe.Path)
+	}
+	if got := strings.Join(paths, ","); got != "mqtt.username,mqtt.password" {
+		t.Errorf("エラーのキーパス = %s、期待値は mqtt.username,mqtt.password", got)
+	}
+}
+
+func TestWithSecretProvider(t *testing.T) {
+	vault := SecretProviderFunc(func(ref string) (string, error) {
+		if ref == "secret/mqtt#password" {
+			return "from-vault", nil
+		}
+		return "", errors.New("見つかりません")
+	})
+	path := writeTempConfig(t, "mqtt:\n  password: \"${vault:secret/mqtt#password}\"\n")
+
+	cfg, err := LoadConfig(path, WithSecretProvider("vault", vault))
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+	if cfg.MQTT.Password != "from-vault" {
+		t.Errorf("Password = %q、期待値は from-vault", cfg.MQTT.Password)
+	}
+}
+
+func TestRedactedAndDump(t *testing.T) {
+	qos := uint8(0)
+	cfg := &AppConfig{
+		MQTT: MQTTConfig{BrokerURL: "tcp://localhost:1883", Username: "user", Password: "s3cret", QoS: 1},
+		Topics: map[string]TopicInfo{
+			"logs": {Name: "system/logs", QoS: &qos},
+		},
+	}
+
+	red := cfg.Redacted()
+	if red.MQTT.Password != redactedValue || red.MQTT.Username != "user" {
+		t.Errorf("Redacted = %+v、パスワードのみ伏せられることを期待", red.MQTT)
+	}
+	// 元の設定は変更されない
+	if cfg.MQTT.Password != "s3cret" {
+		t.Errorf("元の設定のPassword = %s、期待値は s3cret", cfg.MQTT.Password)
+	}
+	// 空のパスワードは伏せない
+	if (&AppConfig{}).Redacted().MQTT.Password != "" {
+		t.Error("空のパスワードが伏せられました")
+	}
+
+	var buf bytes.Buffer
+	if err := cfg.Dump(&buf); err != nil {
+		t.Fatalf("Dump() 失敗: %v", err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "s3cret") {
+		t.Errorf("Dump の出力に秘密情報が含まれています:\n%s", out)
+	}
+	for _, want := range []string{"password: '******'", "broker_url: tcp://localhost:1883", "logs:", "qos: 0"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Dump の出力に %q が含まれていません:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// Sources は設定キーごとに値の由来を保持する
+// 値は "flag --mqtt.qos"、"env GOMQTT_MQTT_QOS"、"file ./config.yaml"、"default" などの説明
+type Sources map[string]string
+
+// sourceUnset はどこからも指定されずゼロ値のままの項目の由来
+const sourceUnset = "unset"
+
+// LoadConfigWithSources はLoadConfigと同様に設定を読み込み、各項目の値の由来とともに返す
+// 優先順位は フラグ > 環境変数 > 設定ファイル（後に重ねたものが優先）> デフォルト値
+func LoadConfigWithSources(configPath string, opts ...LoadOption) (*AppConfig, Sources, error) {
+	return load(configPath, newLoadOptions(opts))
+}
+
+// configSources は読み込んだ設定の各項目の由来を調べる
+// originsは設定キーごとにその値を最後に指定した設定ファイル
+// トピックのQoSを補完する前のconfigを渡す
+func configSources(config *AppConfig, o *loadOptions, origins map[string]string) Sources {
+	sources := make(Sources)
+	for key := range flattenConfig(configMap(reflect.ValueOf(config).Elem()), "") {
+		sources[key] = keySource(key, o, origins)
+	}
+
+	for _, name := range append([]string{DefaultConnection}, sortedKeys(config.Connections)...) {
+		if mc, _ := config.Connection(name); mc.PasswordFile != "" {
+			sources[connectionKey(name)+".password"] = "password_file " + mc.PasswordFile
+		}
+	}
+	for name, info := range config.Topics {
+		prefix := "topics." + name
+		conn := connectionKey(info.Connection)
+		if info.QoS == nil {
+			sources[joinKey(prefix, "qos")] = conn + ".qos (inherited)"
+		}
+		if info.Retained == nil {
+			sources[joinKey(prefix, "retained")] = conn + ".retained (inherited)"
+		}
+	}
+	return sources
+}
+
+// keySource は設定キーの値の由来を優先順位の高い順に調べる
+func keySource(key string, o *loadOptions, origins map[string]string) string {
+	if _, ok := o.overrides[key]; ok {
+		return "flag --" + key
+	}
+	// bindEnvと同じ順で参照し、空の環境変数は無視する（viperと同じ扱い）
+	for _, name := range []string{EnvPrefix + "_" + envName(key), envName(key)} {
+		if os.Getenv(name) != "" {
+			return "env " + name
+		}
+	}
+	if path, ok := origins[key]; ok {
+		return "file " + path
+	}
+	if _, ok := defaults[defaultKey(key)]; ok {
+		return "default"
+	}
+	return sourceUnset
+}
+
+// DumpSources は設定の各項目を値と由来とともに設定キーの順に書き出す
+// 秘密情報はRedactedと同様に伏せられる
+func (c *AppConfig) DumpSources(w io.Writer, sources Sources) error {
+	values := flattenConfig(configMap(reflect.ValueOf(c.Redacted()).Elem()), "")
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "KEY\tVALUE\tSOURCE")
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		source, ok := sources[key]
+		if !ok {
+			source = sourceUnset
+		}
+		val := values[key]
+		if s, ok := val.(string); ok {
+			val = fmt.Sprintf("%q", s)
+		}
+		fmt.Fprintf(tw, "%s\t%v\t%s\n", key, val, source)
+	}
+	return tw.Flush()
+}
+
+// flattenConfig は入れ子のマップを "mqtt.qos" のような設定キーのマップに変換する
+func flattenConfig(m map[string]any, prefix string) map[string]any {
+	flat := make(map[string]any)
+	for key, val := range m {
+		key = strings.ToLower(joinKey(prefix, key))
+		if sub, ok := val.(map[string]any); ok {
+			maps.Copy(flat, flattenConfig(sub, key))
+			continue
+		}
+		flat[key] = val
+	}
+	return flat
+}
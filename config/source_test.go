@@ -0,0 +1,128 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigWithSources(t *testing.T) {
+	path := writeConfigFiles(t, map[string]string{
+		"config.yaml": `
+mqtt:
+  client_id: "file-client"
+  username: "file-user"
+  password: "secret"
+topics:
+  sensors:
+    name: "sensors/data"
+  logs:
+    name: "system/logs"
+    qos: 0
+`,
+		"config.prod.yaml": "mqtt:\n  client_id: \"prod-client\"\n",
+	})
+	dir := filepath.Dir(path)
+	t.Setenv("GOMQTT_MQTT_USERNAME", "env-user")
+	t.Setenv("MQTT_RETAINED", "true")
+
+	cfg, sources, err := LoadConfigWithSources(path,
+		WithProfiles("prod"),
+		WithOverrides(map[string]string{"mqtt.qos": "2"}),
+	)
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+	if cfg.MQTT.ClientID != "prod-client" || cfg.MQTT.QoS != 2 {
+		t.Errorf("MQTT = %+v", cfg.MQTT)
+	}
+
+	want := Sources{
+		"mqtt.broker_url":            "default",
+		"mqtt.client_id":             "file " + filepath.Join(dir, "config.prod.yaml"),
+		"mqtt.username":              "env GOMQTT_MQTT_USERNAME",
+		"mqtt.password":              "file " + path,
+		"mqtt.password_file":         sourceUnset,
+		"mqtt.use_ssl":               sourceUnset,
+		"mqtt.ca_cert_path":          sourceUnset,
+		"mqtt.qos":                   "flag --mqtt.qos",
+		"mqtt.retained":              "env MQTT_RETAINED",
+		"topics.sensors.name":        "file " + path,
+		"topics.sensors.description": sourceUnset,
+		"topics.sensors.qos":         "mqtt.qos (inherited)",
+		"topics.sensors.filter":      sourceUnset,
+		"topics.logs.name":           "file " + path,
+		"topics.logs.description":    sourceUnset,
+		"topics.logs.qos":            "file " + path,
+		"topics.logs.filter":         sourceUnset,
+		"topics.logs.retained":       "mqtt.retained (inherited)",
+		"topics.logs.handler":        sourceUnset,
+	}
+	for key, source := range want {
+		if sources[key] != source {
+			t.Errorf("sources[%s] = %q、期待値は %q", key, sources[key], source)
+		}
+	}
+	// 設定のすべての項目の由来が含まれる
+	for key := range flattenConfig(configMap(reflect.ValueOf(cfg).Elem()), "") {
+		if _, ok := sources[key]; !ok {
+			t.Errorf("設定キー %s の由来がありません", key)
+		}
+	}
+}
+
+func TestDumpSources(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "mqtt")
+	if err := os.WriteFile(secret, []byte("file-secret\n"), 0o600); err != nil {
+		t.Fatalf("パスワードファイルの作成に失敗: %v", err)
+	}
+	path := writeTempConfig(t, `
+mqtt:
+  password_file: "`+secret+`"
+topics:
+  sensors:
+    name: "sensors/data"
+`)
+
+	cfg, sources, err := LoadConfigWithSources(path)
+	if err != nil {
+		t.Fatalf("設定の読み込みに失敗: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := cfg.DumpSources(&buf, sources); err != nil {
+		t.Fatalf("出力に失敗: %v", err)
+	}
+	out := buf.String()
+
+	if strings.Contains(out, "file-secret") {
+		t.Errorf("秘密情報が出力されています:\n%s", out)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if fields := strings.Fields(lines[0]); !reflect.DeepEqual(fields, []string{"KEY", "VALUE", "SOURCE"}) {
+		t.Errorf("見出し = %q", lines[0])
+	}
+	wantLines := map[string][]string{
+		"mqtt.broker_url":    {`"tcp://localhost:1883"`, "default"},
+		"mqtt.password":      {`"******"`, "password_file", secret},
+		"mqtt.qos":           {"1", "default"},
+		"topics.sensors.qos": {"1", "mqtt.qos", "(inherited)"},
+	}
+	var keys []string
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		keys = append(keys, fields[0])
+		if want, ok := wantLines[fields[0]]; ok && !reflect.DeepEqual(fields[1:], want) {
+			t.Errorf("%s の行 = %q、期待値は %q", fields[0], fields[1:], want)
+		}
+	}
+	// キーの順に出力される
+	for i := 1; i < len(keys); i++ {
+		if keys[i-1] >= keys[i] {
+			t.Errorf("キーが順に並んでいません: %v", keys)
+			break
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"go-mqtt/filterexpr"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// brokerSchemes はブローカーURLに使用できるスキーム
+var brokerSchemes = []string{"tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss"}
+
+// topicDirections はトピックの方向に指定できる値
+var topicDirections = []string{DirectionPublish, DirectionSubscribe, DirectionBoth}
+
+// payloadCodecs はペイロードの形式に指定できる値
+var payloadCodecs = []string{CodecJSON, CodecText, CodecBinary}
+
+// maxTopicLength はMQTTのトピック名の最大長（バイト）
+const maxTopicLength = 65535
+
+// FieldError は設定項目ごとの検証エラー
+type FieldError struct {
+	Path    string // 設定キーのパス（例: "mqtt.qos", "topics.sensors.name"）
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError は検証で見つかったすべての問題をまとめたエラー
+// errors.Asで個々の*FieldErrorを取り出せる
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "設定の検証に失敗（%d件）", len(e.Errors))
+	for _, fe := range e.Errors {
+		sb.WriteString("\n  - ")
+		sb.WriteString(fe.Error())
+	}
+	return sb.String()
+}
+
+// Unwrap は個々の検証エラーを返す
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, fe := range e.Errors {
+		errs[i] = fe
+	}
+	return errs
+}
+
+// mergeValidationErrors は検証エラーerrにスキーマの検証エラーschemaErrを合わせる
+// 同じキーパスのエラーはerrのものを残す。errが*ValidationError以外の場合はそのまま返す
+func mergeValidationErrors(err, schemaErr error) error {
+	var ve *ValidationError
+	if err != nil && !errors.As(err, &ve) {
+		return err
+	}
+	var se *ValidationError
+	if !errors.As(schemaErr, &se) {
+		return err
+	}
+	if ve == nil {
+		return se
+	}
+	merged := &ValidationError{Errors: slices.Clone(ve.Errors)}
+	for _, fe := range se.Errors {
+		if !slices.ContainsFunc(ve.Errors, func(e *FieldError) bool { return e.Path == fe.Path }) {
+			merged.Errors = append(merged.Errors, fe)
+		}
+	}
+	return merged
+}
+
+// validator は検証エラーを収集する
+type validator struct {
+	errs []*FieldError
+}
+
+func (v *validator) addf(path, format string, args ...any) {
+	v.errs = append(v.errs, &FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// Validate は設定値を検証し、すべての問題を*ValidationErrorとして返す
+// 問題がない場合はnilを返す
+// トピックのQoSは指定されている（nilでない）場合のみ検証する。LoadConfigはトピックを接続の設定で補完する前に検証する
+func (c *AppConfig) Validate() error {
+	var v validator
+
+	v.connection("mqtt", c.MQTT)
+	// エラーの順序を安定させるためキーの順に検証する
+	for _, name := range sortedKeys(c.Connections) {
+		if name == DefaultConnection {
+			v.addf("connections."+name, "接続名 %s は mqtt セクションの接続の名前として予約されています", DefaultConnection)
+			continue
+		}
+		v.connection(connectionKey(name), c.Connections[name])
+	}
+
+	for _, key := range sortedKeys(c.Topics) {
+		info := c.Topics[key]
+		prefix := "topics." + key
+		v.topicFilter(prefix+".name", info.Name)
+		if _, ok := c.Connection(info.Connection); !ok {
+			v.addf(prefix+".connection", "接続 %s は connections に定義されていません", info.Connection)
+		}
+		if info.QoS != nil {
+			v.qos(prefix+".qos", *info.QoS)
+		}
+		if info.Filter != "" {
+			v.filterExpr(prefix+".filter", info.Filter)
+		}
+		if info.Direction != "" {
+			v.oneOf(prefix+".direction", info.Direction, topicDirections)
+		}
+		if info.Codec != "" {
+			v.oneOf(prefix+".codec", info.Codec, payloadCodecs)
+		}
+		// 公開するトピックにはワイルドカードを指定できない
+		if info.Publishes() && strings.ContainsAny(info.Name, "+#") {
+			v.addf(prefix+".name", "公開するトピック %q にワイルドカードは指定できません", info.Name)
+		}
+	}
+
+	if len(v.errs) > 0 {
+		return &ValidationError{Errors: v.errs}
+	}
+	return nil
+}
+
+// connection は接続の設定を検証する（prefixは "mqtt" または "connections.<name>"）
+func (v *validator) connection(prefix string, mc MQTTConfig) {
+	v.brokerURL(prefix+".broker_url", mc.BrokerURL)
+	v.qos(prefix+".qos", mc.QoS)
+	if mc.UseSSL && mc.CACertPath != "" {
+		v.file(prefix+".ca_cert_path", mc.CACertPath)
+	}
+}
+
+// sortedKeys はマップのキーを順に返す
+func sortedKeys[V any](m map[string]V) []string {
+	return slices.Sorted(maps.Keys(m))
+}
+
+// brokerURL はブローカーURLのスキームとホストを検証する
+func (v *validator) brokerURL(path, raw string) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		v.addf(path, "URL %q を解析できません: %v", raw, errors.Unwrap(err))
+		return
+	}
+	if !slices.Contains(brokerSchemes, strings.ToLower(u.Scheme)) {
+		v.addf(path, "スキーム %q はサポートされていません（%s のいずれかを指定）", u.Scheme, strings.Join(brokerSchemes, ", "))
+	}
+	if u.Hostname() == "" {
+		v.addf(path, "URL %q にホストが指定されていません", raw)
+	}
+}
+
+// qos はQoSが0〜2の範囲かを検証する
+func (v *validator) qos(path string, qos uint8) {
+	if qos > 2 {
+		v.addf(path, "QoS %d は範囲外です（0〜2）", qos)
+	}
+}
+
+// oneOf は値が候補のいずれかであることを検証する
+func (v *validator) oneOf(path, value string, allowed []string) {
+	if !slices.Contains(allowed, value) {
+		v.addf(path, "%q は指定できません（%s のいずれかを指定）", value, strings.Join(allowed, ", "))
+	}
+}
+
+// file はファイルが存在し、ディレクトリでないことを検証する
+func (v *validator) file(path, name string) {
+	info, err := os.Stat(name)
+	switch {
+	case err != nil:
+		v.addf(path, "ファイル %s を参照できません: %v", name, errors.Unwrap(err))
+	case info.IsDir():
+		v.addf(path, "%s はディレクトリです", name)
+	}
+}
+
+// filterExpr はメッセージのフィルター式を解析できるかを検証する
+func (v *validator) filterExpr(path, expr string) {
+	if _, err := filterexpr.Parse(expr); err != nil {
+		v.addf(path, "%v", err)
+	}
+}
+
+// topicFilter はサブスクライブ用のトピックフィルターの構文を検証する
+func (v *validator) topicFilter(path, filter string) {
+	if err := validateTopicFilter(filter); err != nil {
+		v.addf(path, "%v", err)
+	}
+}
+
+// validateTopicFilter はMQTTのトピックフィルターの構文を検証する
+// + はレベル全体、# は末尾のレベル全体にのみ指定できる
+func validateTopicFilter(filter string) error {
+	switch {
+	case filter == "":
+		return errors.New("トピック名が空です")
+	case len(filter) > maxTopicLength:
+		return fmt.Errorf("トピック名が長すぎます（%dバイト、上限は%dバイト）", len(filter), maxTopicLength)
+	case !utf8.ValidString(filter):
+		return fmt.Errorf("トピック %q は有効なUTF-8ではありません", filter)
+	case strings.ContainsRune(filter, 0):
+		return fmt.Errorf("トピック %q にNUL文字が含まれています", filter)
+	}
+
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		switch {
+		case level == "#":
+			if i != len(levels)-1 {
+				return fmt.Errorf("トピック %q: # は末尾のレベルにのみ指定できます", filter)
+			}
+		case level == "+":
+		case strings.ContainsAny(level, "+#"):
+			return fmt.Errorf("トピック %q: ワイルドカードはレベル全体に指定する必要があります（%q）", filter, level)
+		}
+	}
+	return nil
+}
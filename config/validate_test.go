@@ -0,0 +1,148 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func validConfig() *AppConfig {
+	qos := uint8(1)
+	return &AppConfig{
+		MQTT: MQTTConfig{
+			BrokerURL: "tcp://localhost:1883",
+			QoS:       1,
+		},
+		Topics: map[string]TopicInfo{
+			"sensors": {Name: "sensors/+/data", QoS: &qos},
+			"all":     {Name: "devices/#"},
+		},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	if err := os.WriteFile(caFile, []byte("dummy"), 0o600); err != nil {
+		t.Fatalf("CA証明書ファイルの作成に失敗: %v", err)
+	}
+	badQoS := uint8(3)
+
+	tests := []struct {
+		name   string
+		modify func(c *AppConfig)
+		paths  []string // 期待するエラーのキーパス（nilはエラーなし）
+	}{
+		{"正常", func(c *AppConfig) {}, nil},
+		{"SSLとCA証明書", func(c *AppConfig) {
+			c.MQTT.BrokerURL = "ssl://broker.example.com:8883"
+			c.MQTT.UseSSL = true
+			c.MQTT.CACertPath = caFile
+		}, nil},
+		{"不正なスキーム", func(c *AppConfig) { c.MQTT.BrokerURL = "http://localhost:1883" }, []string{"mqtt.broker_url"}},
+		{"ホストなし", func(c *AppConfig) { c.MQTT.BrokerURL = "tcp://:1883" }, []string{"mqtt.broker_url"}},
+		{"解析できないURL", func(c *AppConfig) { c.MQTT.BrokerURL = "tcp://local host:%zz" }, []string{"mqtt.broker_url"}},
+		{"QoS範囲外", func(c *AppConfig) { c.MQTT.QoS = 3 }, []string{"mqtt.qos"}},
+		{"トピックのQoS範囲外", func(c *AppConfig) {
+			c.Topics["sensors"] = TopicInfo{Name: "sensors/data", QoS: &badQoS}
+		}, []string{"topics.sensors.qos"}},
+		{"トピックの方向と形式", func(c *AppConfig) {
+			c.Topics["sensors"] = TopicInfo{Name: "sensors/data", Direction: DirectionBoth, Codec: CodecText}
+			c.Topics["all"] = TopicInfo{Name: "devices/#", Direction: DirectionSubscribe, Codec: CodecBinary}
+		}, nil},
+		{"不正な方向と形式", func(c *AppConfig) {
+			c.Topics["sensors"] = TopicInfo{Name: "sensors/data", Direction: "inbound", Codec: "xml"}
+		}, []string{"topics.sensors.direction", "topics.sensors.codec"}},
+		{"フィルター式", func(c *AppConfig) {
+			c.Topics["sensors"] = TopicInfo{Name: "sensors/data", Filter: "value > 50 && device_id in ['a']"}
+		}, nil},
+		{"不正なフィルター式", func(c *AppConfig) {
+			c.Topics["sensors"] = TopicInfo{Name: "sensors/data", Filter: "value >"}
+		}, []string{"topics.sensors.filter"}},
+		{"公開するトピックのワイルドカード", func(c *AppConfig) {
+			c.Topics["all"] = TopicInfo{Name: "devices/#", Direction: DirectionPublish}
+		}, []string{"topics.all.name"}},
+		{"無効なトピックのワイルドカード", func(c *AppConfig) {
+			disabled := false
+			c.Topics["all"] = TopicInfo{Name: "devices/#", Direction: DirectionPublish, Enabled: &disabled}
+		}, nil},
+		{"CA証明書なし", func(c *AppConfig) {
+			c.MQTT.UseSSL = true
+			c.MQTT.CACertPath = filepath.Join(t.TempDir(), "missing.crt")
+		}, []string{"mqtt.ca_cert_path"}},
+		{"CA証明書がディレクトリ", func(c *AppConfig) {
+			c.MQTT.UseSSL = true
+			c.MQTT.CACertPath = t.TempDir()
+		}, []string{"mqtt.ca_cert_path"}},
+		{"SSL無効時はCA証明書を確認しない", func(c *AppConfig) {
+			c.MQTT.CACertPath = "/nonexistent/ca.crt"
+		}, nil},
+		{"複数の問題", func(c *AppConfig) {
+			c.MQTT.BrokerURL = "ftp://"
+			c.MQTT.QoS = 5
+			c.Topics["empty"] = TopicInfo{}
+			c.Topics["wild"] = TopicInfo{Name: "a/b#"}
+		}, []string{"mqtt.broker_url", "mqtt.broker_url", "mqtt.qos", "topics.empty.name", "topics.wild.name"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			tt.modify(c)
+			err := c.Validate()
+
+			var got []string
+			var verr *ValidationError
+			if errors.As(err, &verr) {
+				for _, fe := range verr.Errors {
+					got = append(got, fe.Path)
+				}
+			} else if err != nil {
+				t.Fatalf("Validate のエラー = %v、ValidationError を期待", err)
+			}
+			if !slices.Equal(got, tt.paths) {
+				t.Errorf("エラーのキーパス = %v、期待値は %v（%v）", got, tt.paths, err)
+			}
+		})
+	}
+}
+
+func TestValidationErrorMessage(t *testing.T) {
+	c := validConfig()
+	c.MQTT.QoS = 3
+	c.Topics["bad"] = TopicInfo{Name: "a/#/b"}
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("エラーが返されませんでした")
+	}
+	msg := err.Error()
+	for _, want := range []string{"2件", "mqtt.qos", "topics.bad.name"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("エラーメッセージ %q に %q が含まれていません", msg, want)
+		}
+	}
+
+	var fe *FieldError
+	if !errors.As(err, &fe) || fe.Path != "mqtt.qos" {
+		t.Errorf("errors.As で最初の FieldError を取り出せません: %v", fe)
+	}
+}
+
+func TestValidateTopicFilter(t *testing.T) {
+	valid := []string{"a", "a/b", "a/+/c", "+", "#", "a/#", "+/+/#", "/a", "a//b", "$SYS/#"}
+	for _, f := range valid {
+		if err := validateTopicFilter(f); err != nil {
+			t.Errorf("validateTopicFilter(%q) = %v、期待値は nil", f, err)
+		}
+	}
+
+	invalid := []string{"", "a/#/b", "a#", "a/b+", "+a/b", "a/\x00", "\xff", strings.Repeat("a", maxTopicLength+1)}
+	for _, f := range invalid {
+		if err := validateTopicFilter(f); err == nil {
+			t.Errorf("validateTopicFilter(%.20q) でエラーが返されませんでした", f)
+		}
+	}
+}
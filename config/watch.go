@@ -0,0 +1,109 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Watch は設定ファイルを監視し、変更されるたびにoptsを指定したLoadConfigで読み込み直す
+//
+// 読み込みと検証に成功した場合はonChangeに新しい設定を、失敗した場合はonErrorにエラーを渡す
+// 失敗した場合、呼び出し側は以前の設定を使い続けることを想定している
+// コールバックは監視用のゴルーチンから1つずつ呼び出される
+//
+// エディタが一時ファイルを置き換える保存や、Kubernetesのconfigmapのようなシンボリックリンクの
+// 付け替えにも対応するため、ファイルではなくファイルのあるディレクトリを監視する
+// conf.dに後から追加されたファイルは監視の対象にならないため、基本の設定ファイルの変更時に読み込まれる
+//
+// 返された関数を呼び出すと監視を停止し、監視用のゴルーチンが終了するまで待つ
+// 返された関数をコールバックの中から呼び出してはならない
+func Watch(configPath string, onChange func(*AppConfig), onError func(error), opts ...LoadOption) (stop func()) {
+	report := func(err error) {
+		if onError != nil {
+			onError(err)
+		}
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		report(fmt.Errorf("設定ファイルの監視を開始できません: %w", err))
+		return func() {}
+	}
+
+	// 基本の設定ファイルに加えて、開始時に存在するconf.dの断片とプロファイルのファイルを監視する
+	files := []string{configPath}
+	o := newLoadOptions(opts)
+	if all, err := configFiles(configPath, &o); err == nil {
+		files = all
+	}
+	realPaths := make(map[string]string, len(files))
+	dirs := make(map[string]bool)
+	for _, path := range files {
+		path = filepath.Clean(path)
+		realPaths[path], _ = filepath.EvalSymlinks(path)
+		dir := filepath.Dir(path)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+		if err := watcher.Add(dir); err != nil {
+			report(fmt.Errorf("ディレクトリ %s の監視に失敗: %w", dir, err))
+		}
+	}
+
+	// changed はイベントが監視対象のファイルの変更かどうかを返す
+	changed := func(event fsnotify.Event) bool {
+		name := filepath.Clean(event.Name)
+		hit := false
+		for path, real := range realPaths {
+			if name == path && event.Has(fsnotify.Write|fsnotify.Create) {
+				hit = true
+			}
+			// シンボリックリンクの参照先が付け替えられた
+			if cur, err := filepath.EvalSymlinks(path); err == nil && cur != real {
+				realPaths[path] = cur
+				hit = true
+			}
+		}
+		return hit
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if !changed(event) {
+					continue
+				}
+				// 環境変数の対応付けやデフォルト値を含めて、起動時と同じ手順で読み込む
+				cfg, err := LoadConfig(configPath, opts...)
+				if err != nil {
+					report(err)
+					continue
+				}
+				onChange(cfg)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				report(fmt.Errorf("設定ファイルの監視に失敗: %w", err))
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			watcher.Close()
+			<-done
+		})
+	}
+}
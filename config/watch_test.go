@@ -0,0 +1,104 @@
+package config
+
+import (
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	path := writeTempConfig(t, `
+topics:
+  sensors:
+    name: "sensors/data"
+`)
+
+	changes := make(chan *AppConfig, 10)
+	errs := make(chan error, 10)
+	stop := Watch(path, func(cfg *AppConfig) { changes <- cfg }, func(err error) { errs <- err })
+	defer stop()
+
+	// 不正な設定は検証エラーとして通知される
+	if err := os.WriteFile(path, []byte("mqtt:\n  qos: 5\n"), 0o600); err != nil {
+		t.Fatalf("設定ファイルの書き込みに失敗: %v", err)
+	}
+	// 書き込みの途中（空のファイル）で通知される場合があるため、期待する通知まで待つ
+	timeout := time.After(3 * time.Second)
+	for done := false; !done; {
+		select {
+		case err := <-errs:
+			if _, ok := err.(*ValidationError); !ok {
+				t.Fatalf("エラー = %v、ValidationError を期待", err)
+			}
+			done = true
+		case cfg := <-changes:
+			if cfg.MQTT.QoS == 5 {
+				t.Fatalf("不正な設定が通知されました: %+v", cfg)
+			}
+		case <-timeout:
+			t.Fatal("設定ファイルの変更が検出されませんでした")
+		}
+	}
+
+	if err := os.WriteFile(path, []byte(`
+topics:
+  alerts:
+    name: "alerts/#"
+    qos: 2
+`), 0o600); err != nil {
+		t.Fatalf("設定ファイルの書き込みに失敗: %v", err)
+	}
+	timeout = time.After(3 * time.Second)
+	for done := false; !done; {
+		select {
+		case cfg := <-changes:
+			if info, ok := cfg.Topics["alerts"]; ok {
+				if *info.QoS != 2 {
+					t.Errorf("alerts.QoS = %d、期待値は 2", *info.QoS)
+				}
+				done = true
+			}
+		case <-errs:
+		case <-timeout:
+			t.Fatal("設定ファイルの変更が検出されませんでした")
+		}
+	}
+
+	// 停止後は通知されない
+	stop()
+	for len(changes) > 0 {
+		<-changes
+	}
+	if err := os.WriteFile(path, []byte("mqtt:\n  qos: 0\n"), 0o600); err != nil {
+		t.Fatalf("設定ファイルの書き込みに失敗: %v", err)
+	}
+	select {
+	case cfg := <-changes:
+		t.Errorf("停止後に通知されました: %+v", cfg)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestWatchStop(t *testing.T) {
+	path := writeTempConfig(t, `
+topics:
+  sensors:
+    name: "sensors/data"
+`)
+
+	// 停止すると監視用のゴルーチンが終了する
+	before := runtime.NumGoroutine()
+	for range 5 {
+		stop := Watch(path, func(*AppConfig) {}, nil)
+		stop()
+		stop() // 複数回呼び出してもよい
+	}
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("ゴルーチン数 = %d、停止前は %d", runtime.NumGoroutine(), before)
+		}
+		runtime.Gosched()
+	}
+}
@@ -0,0 +1,404 @@
+// Package filterexpr はJSONペイロードに対する宣言的なフィルター式を解析・評価する
+//
+// 式の書式:
+//   - 比較:     value > 50, device_id == "dev-1", meta.active != false
+//   - 集合:     device_id in ["dev-1", "dev-2"]
+//   - 論理演算: && (and), || (or), ! (not), 括弧
+//
+// フィールドはドット区切りでネストしたオブジェクトを参照する
+// JSONとして解析できないペイロードや存在しないフィールドとの比較は演算子にかかわらずfalseになる
+// フィールドが存在する場合、!= は常に == の否定になる（型の異なる値や null とは等しくない）
+// 大小比較は数値どうし、文字列どうしでのみ成立する
+// 「存在しない、または等しくない」は !(field == value) と書く
+//
+// mqttutil.ParseFilterがサブスクリプションのフィルターとして使用し、
+// configは設定の読み込み時に式を検証するために使用する
+package filterexpr
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Expr は解析済みのフィルター式
+type Expr struct {
+	node filterNode
+}
+
+// Parse はフィルター式を解析する
+func Parse(expr string) (*Expr, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, fmt.Errorf("フィルター式 %q の解析に失敗: %w", expr, err)
+	}
+	p := &filterParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err == nil && !p.done() {
+		err = fmt.Errorf("予期しないトークン %q", p.peek().text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("フィルター式 %q の解析に失敗: %w", expr, err)
+	}
+	return &Expr{node: node}, nil
+}
+
+// Match はJSONペイロードが式に一致するかを返す
+func (e *Expr) Match(payload []byte) bool {
+	var doc map[string]any
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return false
+	}
+	return e.node.eval(doc)
+}
+
+// filterNode はフィルター式の構文木のノード
+type filterNode interface {
+	eval(doc map[string]any) bool
+}
+
+type andNode struct{ left, right filterNode }
+
+func (n andNode) eval(doc map[string]any) bool { return n.left.eval(doc) && n.right.eval(doc) }
+
+type orNode struct{ left, right filterNode }
+
+func (n orNode) eval(doc map[string]any) bool { return n.left.eval(doc) || n.right.eval(doc) }
+
+type notNode struct{ inner filterNode }
+
+func (n notNode) eval(doc map[string]any) bool { return !n.inner.eval(doc) }
+
+// compareNode は field op value の比較
+type compareNode struct {
+	field string
+	op    string
+	value any
+}
+
+func (n compareNode) eval(doc map[string]any) bool {
+	v, ok := lookupField(doc, n.field)
+	if !ok {
+		return false
+	}
+	return compareValues(v, n.op, n.value)
+}
+
+// inNode は field in [values...] の集合判定
+type inNode struct {
+	field  string
+	values []any
+}
+
+func (n inNode) eval(doc map[string]any) bool {
+	v, ok := lookupField(doc, n.field)
+	if !ok {
+		return false
+	}
+	for _, want := range n.values {
+		if compareValues(v, "==", want) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupField はドット区切りのフィールドパスで値を取り出す
+func lookupField(doc map[string]any, path string) (any, bool) {
+	var cur any = doc
+	for _, key := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// compareValues はJSONの値とリテラルを比較する
+// 数値と文字列は大小比較、それ以外は等値比較のみ可能
+// != は == の否定で、型の異なる値どうしの大小比較はfalseになる
+func compareValues(actual any, op string, want any) bool {
+	if op == "!=" {
+		return !compareValues(actual, "==", want)
+	}
+	switch a := actual.(type) {
+	case float64:
+		w, ok := want.(float64)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "==":
+			return a == w
+		case ">":
+			return a > w
+		case ">=":
+			return a >= w
+		case "<":
+			return a < w
+		case "<=":
+			return a <= w
+		}
+	case string:
+		w, ok := want.(string)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "==":
+			return a == w
+		case ">":
+			return a > w
+		case ">=":
+			return a >= w
+		case "<":
+			return a < w
+		case "<=":
+			return a <= w
+		}
+	case bool:
+		w, ok := want.(bool)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "==":
+			return a == w
+		}
+	case nil:
+		return want == nil && op == "=="
+	}
+	return false
+}
+
+// filterToken はフィルター式の字句
+type filterToken struct {
+	kind string // ident, number, string, op, punct
+	text string
+}
+
+// tokenizeFilter はフィルター式を字句に分割する
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+	r := []rune(expr)
+	for i := 0; i < len(r); {
+		c := r[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(' || c == ')' || c == '[' || c == ']' || c == ',':
+			tokens = append(tokens, filterToken{kind: "punct", text: string(c)})
+			i++
+		case c == '&' || c == '|':
+			if i+1 >= len(r) || r[i+1] != c {
+				return nil, fmt.Errorf("不正な演算子 %q", string(c))
+			}
+			tokens = append(tokens, filterToken{kind: "op", text: string([]rune{c, c})})
+			i += 2
+		case c == '=' || c == '!' || c == '<' || c == '>':
+			if i+1 < len(r) && r[i+1] == '=' {
+				tokens = append(tokens, filterToken{kind: "op", text: string([]rune{c, '='})})
+				i += 2
+				continue
+			}
+			if c == '=' {
+				return nil, fmt.Errorf("不正な演算子 %q（== を使用してください）", "=")
+			}
+			tokens = append(tokens, filterToken{kind: "op", text: string(c)})
+			i++
+		case c == '"' || c == '\'':
+			j := i + 1
+			var sb strings.Builder
+			for ; j < len(r) && r[j] != c; j++ {
+				if r[j] == '\\' && j+1 < len(r) {
+					j++
+				}
+				sb.WriteRune(r[j])
+			}
+			if j >= len(r) {
+				return nil, fmt.Errorf("文字列リテラルが閉じられていません")
+			}
+			tokens = append(tokens, filterToken{kind: "string", text: sb.String()})
+			i = j + 1
+		case c == '-' || unicode.IsDigit(c):
+			j := i + 1
+			for j < len(r) && (unicode.IsDigit(r[j]) || strings.ContainsRune(".eE+-", r[j])) {
+				j++
+			}
+			tokens = append(tokens, filterToken{kind: "number", text: string(r[i:j])})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i + 1
+			for j < len(r) && (unicode.IsLetter(r[j]) || unicode.IsDigit(r[j]) || r[j] == '_' || r[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, filterToken{kind: "ident", text: string(r[i:j])})
+			i = j
+		default:
+			return nil, fmt.Errorf("不正な文字 %q", string(c))
+		}
+	}
+	return tokens, nil
+}
+
+// filterParser はフィルター式の再帰下降パーサー
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) done() bool { return p.pos >= len(p.tokens) }
+
+func (p *filterParser) peek() filterToken {
+	if p.done() {
+		return filterToken{}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() filterToken {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// accept は次のトークンがいずれかのテキストに一致すれば読み進める
+func (p *filterParser) accept(texts ...string) bool {
+	t := p.peek()
+	if t.kind == "string" || t.kind == "number" {
+		return false
+	}
+	for _, text := range texts {
+		if t.text == text {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *filterParser) expect(text string) error {
+	if !p.accept(text) {
+		return fmt.Errorf("%q が必要です", text)
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||", "or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&", "and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.accept("!", "not") {
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner: inner}, nil
+	}
+	if p.accept("(") {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return node, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	field := p.next()
+	if field.kind != "ident" {
+		return nil, fmt.Errorf("フィールド名が必要です（%q）", field.text)
+	}
+
+	if p.accept("in") {
+		if err := p.expect("["); err != nil {
+			return nil, err
+		}
+		var values []any
+		for {
+			v, err := p.parseLiteral()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+			if p.accept("]") {
+				break
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		return inNode{field: field.text, values: values}, nil
+	}
+
+	op := p.next()
+	if op.kind != "op" || op.text == "&&" || op.text == "||" || op.text == "!" {
+		return nil, fmt.Errorf("フィールド %s の後に比較演算子が必要です", field.text)
+	}
+	v, err := p.parseLiteral()
+	if err != nil {
+		return nil, err
+	}
+	return compareNode{field: field.text, op: op.text, value: v}, nil
+}
+
+func (p *filterParser) parseLiteral() (any, error) {
+	t := p.next()
+	switch t.kind {
+	case "number":
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("不正な数値 %q", t.text)
+		}
+		return f, nil
+	case "string":
+		return t.text, nil
+	case "ident":
+		switch t.text {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("値が必要です（%q）", t.text)
+}
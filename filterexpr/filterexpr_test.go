@@ -0,0 +1,161 @@
+package filterexpr
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExprMatch(t *testing.T) {
+	payload := []byte(`{
+		"device_id": "dev-1",
+		"value": 72.5,
+		"count": 3,
+		"code": "3",
+		"active": true,
+		"note": null,
+		"quote": "say \"hi\"",
+		"path": "C:\\tmp",
+		"meta": {"site": "plant-a", "level": 3, "tags": ["a"], "inner": {"ok": true}}
+	}`)
+
+	tests := []struct {
+		name string
+		expr string
+		want bool
+	}{
+		// 比較
+		{"数値の大小", "value > 50", true},
+		{"数値の境界", "count >= 3 && count <= 3", true},
+		{"数値の等値", "value == 72.5", true},
+		{"負の数", "value > -1", true},
+		{"指数表記", "value < 1e2", true},
+		{"文字列の等値", `device_id == "dev-1"`, true},
+		{"単引用符の文字列", `device_id == 'dev-1'`, true},
+		{"文字列の大小", `device_id < "dev-2"`, true},
+		{"真偽値", "active == true", true},
+		{"真偽値の不等", "active != false", true},
+		{"null", "note == null", true},
+
+		// 集合
+		{"集合に含まれる", `device_id in ["dev-1", "dev-2"]`, true},
+		{"集合に含まれない", `device_id in ['dev-3']`, false},
+		{"数値の集合", "count in [1, 2, 3]", true},
+		{"型の混在した集合", `count in ["3", true, 3]`, true},
+		{"null を含む集合", "note in [1, null]", true},
+		{"集合の否定", `!(device_id in ["dev-2"])`, true},
+
+		// ドット区切りのフィールド
+		{"ネストしたフィールド", `meta.site == "plant-a"`, true},
+		{"2段のネスト", "meta.inner.ok == true", true},
+		{"オブジェクトでない値の子", "value.x == 1", false},
+		{"存在しないネスト", "meta.missing.x != 1", false},
+		{"配列との比較", `meta.tags == "a"`, false},
+		{"配列との不等", `meta.tags != "a"`, true},
+
+		// 優先順位（! > && > ||）
+		{"&& が || より優先", "active == false && count == 0 || value > 50", true},
+		{"|| の右辺の &&", "value > 50 || active == false && count == 0", true},
+		{"&& の左辺の ||", "(value > 50 || active == false) && count == 0", false},
+		{"! は比較に結合する", "!active == false && count == 3", true},
+		{"! は && より優先", "!(count == 3) && value > 50", false},
+		{"キーワードの演算子", "value > 50 and meta.level < 3 or active == true", true},
+		{"not キーワード", "not active == false", true},
+
+		// 入れ子の括弧
+		{"入れ子の括弧", "((value > 100 || value < 0) || (count == 3 && (active == true)))", true},
+		{"否定の入れ子", "!(!(count == 3))", true},
+		{"括弧の否定", "!((value > 100 || value < 0) && active == true)", true},
+
+		// 文字列のエスケープ
+		{"二重引用符のエスケープ", `quote == "say \"hi\""`, true},
+		{"バックスラッシュのエスケープ", `path == "C:\\tmp"`, true},
+		{"単引用符内の二重引用符", `quote == 'say "hi"'`, true},
+
+		// 数値と文字列は等しくない
+		{"数値と文字列の等値", `count == "3"`, false},
+		{"数値と文字列の不等", `count != "3"`, true},
+		{"文字列と数値の等値", "code == 3", false},
+		{"文字列と数値の不等", "code != 3", true},
+		{"数値と文字列の大小", `value > "50"`, false},
+		{"文字列と数値の大小", "code < 10", false},
+
+		// フィールドが存在する場合、!= は == の否定
+		{"型の異なる真偽値", "active != 1", true},
+		{"null との不等", "device_id != null", true},
+		{"null と数値の不等", "note != 0", true},
+		{"null どうしの不等", "note != null", false},
+		{"null の大小", "note > 0", false},
+		{"真偽値の大小", "active > false", false},
+
+		// 存在しないフィールドとの比較は演算子にかかわらずfalse
+		{"存在しないフィールドの等値", "missing == 0", false},
+		{"存在しないフィールドの不等", "missing != 0", false},
+		{"存在しないフィールドの集合", "missing in [0]", false},
+		{"存在しないフィールドの否定", "!(missing == 0)", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := Parse(tt.expr)
+			if err != nil {
+				t.Fatalf("Parse(%q) 失敗: %v", tt.expr, err)
+			}
+			if got := e.Match(payload); got != tt.want {
+				t.Errorf("Parse(%q).Match() = %t、期待値は %t", tt.expr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExprMatchInvalidPayload(t *testing.T) {
+	e, err := Parse("!(value == 1)")
+	if err != nil {
+		t.Fatalf("Parse() 失敗: %v", err)
+	}
+	for _, payload := range []string{"", "not json", "[1, 2]", `"value"`} {
+		if e.Match([]byte(payload)) {
+			t.Errorf("Match(%q) = true、JSONオブジェクト以外はfalseを期待", payload)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+		want string // エラーメッセージに含まれる文字列
+	}{
+		// 字句のエラー
+		{"単独の &", "value > 1 & active == true", `不正な演算子 "&"`},
+		{"単独の |", "value > 1 | active == true", `不正な演算子 "|"`},
+		{"単独の =", "value = 1", "== を使用してください"},
+		{"閉じられていない文字列", `device_id == "dev-1`, "文字列リテラルが閉じられていません"},
+		{"閉じられていない単引用符", `device_id == 'dev-1`, "文字列リテラルが閉じられていません"},
+		{"不正な文字", "value > 1 ; count < 2", `不正な文字 ";"`},
+		{"不正な数値", "value > 1.2.3", "1.2.3"},
+
+		// 構文のエラー
+		{"空の式", "", ""},
+		{"値の欠落", "value >", ""},
+		{"閉じられていない括弧", "(value > 1", `")" が必要です`},
+		{"余分な閉じ括弧", "value > 1)", "予期しないトークン"},
+		{"閉じられていない集合", `device_id in ["dev-1"`, ""},
+		{"区切りのない集合", `device_id in ["dev-1" "dev-2"]`, ""},
+		{"空の集合", "count in []", "値が必要です"},
+		{"集合以外の in", "device_id in 1", ""},
+		{"演算子の欠落", "value 1", ""},
+		{"右辺の欠落", "value > 1 &&", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.expr)
+			if err == nil {
+				t.Fatalf("Parse(%q) がエラーを返さなかった", tt.expr)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse(%q) のエラー = %v、%q を含むことを期待", tt.expr, err, tt.want)
+			}
+		})
+	}
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"cmp"
 	"encoding/json"
 	"flag"
+	"fmt"
 	"go-mqtt/config"
 	"go-mqtt/mqttutil"
 	"log"
@@ -12,6 +14,8 @@ import (
 	"time"
 )
 
+//go:generate sh -c "go run . schema > config.schema.json"
+
 type SensorData struct {
 	DeviceID  string    `json:"device_id"`
 	Value     float64   `json:"value"`
@@ -20,70 +24,121 @@ type SensorData struct {
 
 func main() {
 	// コマンドラインフラグ
+	// --mqtt.qos=2 や --topics.sensors.qos=0 のような設定キーのフラグは環境変数や設定ファイルより優先される
 	configPath := flag.String("config", "./config.yaml", "設定ファイルのパス")
-	flag.Parse()
+	strict := flag.Bool("strict", false, "設定ファイルの不明な項目を警告ではなくエラーにする")
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "使い方: %s [フラグ] [print-config | schema]\n\n", os.Args[0])
+		fmt.Fprintln(out, "  print-config\n    \t設定の値と由来を表示して終了する")
+		fmt.Fprintln(out, "  schema\n    \t設定ファイルのJSON Schemaを出力して終了する")
+		flag.PrintDefaults()
+		fmt.Fprintln(out, "  --<設定キー>=<値>\n    \t設定値を上書きする（例: --mqtt.broker_url=tcp://host:1883 --topics.sensors.qos=0）")
+	}
+	overrides, args, err := config.ParseFlags(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(flag.CommandLine.Output(), err)
+		flag.Usage()
+		os.Exit(2)
+	}
+	flag.CommandLine.Parse(args)
+	loadOpts := []config.LoadOption{config.WithOverrides(overrides)}
+	if *strict {
+		loadOpts = append(loadOpts, config.WithStrictSchema())
+	}
+
+	// print-config: 実際に使用される設定と各項目の由来を表示する
+	if flag.Arg(0) == "print-config" {
+		cfg, sources, err := config.LoadConfigWithSources(*configPath, loadOpts...)
+		if err != nil {
+			log.Fatalf("設定の読み込みに失敗: %v", err)
+		}
+		if err := cfg.DumpSources(os.Stdout, sources); err != nil {
+			log.Fatalf("設定の出力に失敗: %v", err)
+		}
+		return
+	}
+
+	// schema: 設定ファイルのJSON Schemaを出力する（config.schema.json の生成に使用）
+	if flag.Arg(0) == "schema" {
+		if err := config.WriteJSONSchema(os.Stdout); err != nil {
+			log.Fatalf("スキーマの出力に失敗: %v", err)
+		}
+		return
+	}
 
 	// 設定を読み込み
-	cfg, err := config.LoadConfig(*configPath)
+	cfg, err := config.LoadConfig(*configPath, loadOpts...)
 	if err != nil {
 		log.Fatalf("設定の読み込みに失敗: %v", err)
 	}
 
-	// MQTTクライアントを作成
-	client := mqttutil.NewClientFromConfig(cfg.MQTT)
-
-	// MQTTサービスを作成
-	service := mqttutil.NewService(client)
+	// 接続（mqtt セクションと connections）ごとにMQTTクライアントとサービスを作成
+	conns := mqttutil.NewConnections(cfg)
 
-	// 設定ファイルからトピックを処理
-	for _, topicInfo := range cfg.Topics {
-		log.Printf("トピックをサブスクライブ: %s (%s)", topicInfo.Name, topicInfo.Description)
-
-		// トピック固有のQoS設定があれば適用
-		if topicInfo.QoS != nil {
-			client.SetQoS(byte(*topicInfo.QoS))
+	// 設定ファイルのトピックの handler に指定する名前でハンドラーを登録
+	handlers := mqttutil.NewHandlerRegistry()
+	for name, h := range map[string]mqttutil.MessageHandler{
+		"sensor_data": handleSensorData,
+		"log":         handleLog,
+	} {
+		if err := handlers.Register(name, h); err != nil {
+			log.Fatalf("ハンドラーの登録に失敗: %v", err)
 		}
+	}
 
-		// トピックをサブスクライブ
-		err := service.Subscribe(topicInfo.Name, func(topic string, payload []byte) {
-			var data SensorData
-			if err := json.Unmarshal(payload, &data); err != nil {
-				log.Printf("メッセージのアンマーシャルエラー: %v", err)
-				return
-			}
-			log.Printf("%s でメッセージを受信: DeviceID=%s, Value=%.2f, Time=%s",
-				topic, data.DeviceID, data.Value, data.Timestamp.Format(time.RFC3339))
-		})
-
-		if err != nil {
-			log.Printf("トピック %s のサブスクライブに失敗: %v", topicInfo.Name, err)
+	// 設定ファイルからトピックを処理（トピック固有のフィルター・QoS・形式も適用される）
+	applier := conns.Applier(cfg, handlers)
+	for key, topicInfo := range cfg.Topics {
+		if topicInfo.Subscribes() {
+			log.Printf("トピックをサブスクライブ: %s (%s) → %s [%s]", topicInfo.Name, key, topicInfo.Handler, cmp.Or(topicInfo.Connection, config.DefaultConnection))
 		}
-
-		// グローバルQoS設定に戻す
-		client.SetQoS(byte(cfg.MQTT.QoS))
+	}
+	if err := applier.SubscribeAll(); err != nil {
+		log.Fatalf("トピックのサブスクライブに失敗: %v", err)
 	}
 
 	// サービスを開始
-	log.Printf("MQTTブローカーに接続: %s", cfg.MQTT.BrokerURL)
-	if err := service.Start(); err != nil {
+	for _, name := range conns.Names() {
+		mc, _ := cfg.Connection(name)
+		log.Printf("MQTTブローカーに接続: %s (%s)", mc.BrokerURL, name)
+	}
+	if err := conns.Start(); err != nil {
 		log.Fatalf("MQTTサービスの開始に失敗: %v", err)
 	}
-	defer service.Stop()
+	defer conns.Stop()
 
-	// テストメッセージを公開
-	sensorsTopic := cfg.Topics["sensors"].Name
-	if sensorsTopic != "" {
+	// テストメッセージを公開（sensors が公開用に設定されている場合）
+	if cfg.Topics["sensors"].Publishes() {
 		data := SensorData{
 			DeviceID:  "device-001",
 			Value:     23.5,
 			Timestamp: time.Now(),
 		}
-		log.Printf("%s にテストメッセージを公開", sensorsTopic)
-		if err := service.PublishJSON(sensorsTopic, data); err != nil {
+		log.Printf("%s にテストメッセージを公開", cfg.Topics["sensors"].Name)
+		if err := applier.Publish("sensors", data); err != nil {
 			log.Printf("メッセージの公開に失敗: %v", err)
 		}
 	}
 
+	// 設定ファイルの変更を実行中のサービスに適用
+	stopWatch := config.Watch(*configPath, func(next *config.AppConfig) {
+		diff, err := applier.Apply(next)
+		if err != nil {
+			log.Printf("設定の変更の適用に失敗: %v", err)
+		}
+		if diff.Empty() {
+			return
+		}
+		log.Printf("設定を再読み込み: 追加=%v 削除=%v 変更=%v", diff.Added, diff.Removed, diff.Updated)
+		if len(diff.Restart) > 0 {
+			log.Printf("次の設定の変更を反映するには再起動が必要です: %v", diff.Restart)
+		}
+	}, func(err error) {
+		log.Printf("設定の再読み込みに失敗したため、以前の設定を使用します: %v", err)
+	}, loadOpts...)
+	defer stopWatch()
+
 	// 割り込み信号を待機
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
@@ -91,3 +146,19 @@ func main() {
 
 	log.Println("シャットダウン中...")
 }
+
+// handleSensorData はセンサーデータのメッセージをログに出力する
+func handleSensorData(topic string, payload []byte) {
+	var data SensorData
+	if err := json.Unmarshal(payload, &data); err != nil {
+		log.Printf("メッセージのアンマーシャルエラー: %v", err)
+		return
+	}
+	log.Printf("%s でメッセージを受信: DeviceID=%s, Value=%.2f, Time=%s",
+		topic, data.DeviceID, data.Value, data.Timestamp.Format(time.RFC3339))
+}
+
+// handleLog はメッセージをテキストとしてログに出力する
+func handleLog(topic string, payload []byte) {
+	log.Printf("%s: %s", topic, payload)
+}
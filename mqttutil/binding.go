@@ -0,0 +1,136 @@
+package mqttutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-mqtt/config"
+	"slices"
+	"sync"
+	"unicode/utf8"
+)
+
+// HandlerResolver は設定のトピック（keyは設定ファイル上のキー）に対応するハンドラーを返す
+type HandlerResolver interface {
+	Resolve(key string, info config.TopicInfo) (MessageHandler, error)
+}
+
+// Resolve はTopicHandlerFuncをHandlerResolverとして使用する
+func (f TopicHandlerFunc) Resolve(key string, info config.TopicInfo) (MessageHandler, error) {
+	return f(key, info), nil
+}
+
+// HandlerRegistry は名前でハンドラーを登録し、設定のトピックの handler に指定された名前で対応付ける
+//
+// 設定ファイルでは次のように指定する:
+//
+//	topics:
+//	  sensors:
+//	    name: "sensors/data"
+//	    handler: "sensor_data"
+type HandlerRegistry struct {
+	mu       sync.RWMutex
+	handlers map[string]TopicHandlerFunc
+}
+
+// NewHandlerRegistry は空のHandlerRegistryを作成
+func NewHandlerRegistry() *HandlerRegistry {
+	return &HandlerRegistry{
+		handlers: make(map[string]TopicHandlerFunc),
+	}
+}
+
+// Register はnameでハンドラーを登録する
+func (r *HandlerRegistry) Register(name string, handler MessageHandler) error {
+	return r.RegisterFunc(name, func(string, config.TopicInfo) MessageHandler {
+		return handler
+	})
+}
+
+// RegisterFunc はnameで、トピックの設定からハンドラーを作成する関数を登録する
+// トピックごとに設定（スキーマの参照など）を使用するハンドラーに使う
+func (r *HandlerRegistry) RegisterFunc(name string, factory TopicHandlerFunc) error {
+	if name == "" {
+		return fmt.Errorf("ハンドラーの名前が空です")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.handlers[name]; exists {
+		return fmt.Errorf("ハンドラー %s は既に登録されています", name)
+	}
+	r.handlers[name] = factory
+	return nil
+}
+
+// Names は登録済みのハンドラーの名前を順に返す
+func (r *HandlerRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.handlers))
+	for name := range r.handlers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Resolve はトピックの handler に指定された名前のハンドラーを返す
+// 名前が指定されていない場合や登録されていない場合はエラーを返す
+func (r *HandlerRegistry) Resolve(key string, info config.TopicInfo) (MessageHandler, error) {
+	if info.Handler == "" {
+		return nil, fmt.Errorf("トピック %s にハンドラーが指定されていません", key)
+	}
+	r.mu.RLock()
+	factory, ok := r.handlers[info.Handler]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("トピック %s のハンドラー %s は登録されていません（登録済み: %v）", key, info.Handler, r.Names())
+	}
+	return factory(key, info), nil
+}
+
+// codecFilter はペイロードが形式codecとして不正なメッセージを除外するフィルターを返す
+// 形式を確認しない場合（binary）はnilを返す
+func codecFilter(codec string) Filter {
+	switch codec {
+	case config.CodecJSON:
+		return func(_ string, payload []byte) bool { return json.Valid(payload) }
+	case config.CodecText:
+		return func(_ string, payload []byte) bool { return utf8.Valid(payload) }
+	default:
+		return nil
+	}
+}
+
+// EncodePayload はdataを形式codecのペイロードにエンコードする
+//
+//   - json: json.Marshalでエンコードする
+//   - text: string、[]byte、fmt.Stringerはそのまま、それ以外はfmt.Sprintで文字列にする
+//   - binary: string と []byte のみ使用できる
+func EncodePayload(codec string, data any) ([]byte, error) {
+	switch codec {
+	case config.CodecJSON, "":
+		return json.Marshal(data)
+	case config.CodecText:
+		switch v := data.(type) {
+		case string:
+			return []byte(v), nil
+		case []byte:
+			return v, nil
+		case fmt.Stringer:
+			return []byte(v.String()), nil
+		default:
+			return []byte(fmt.Sprint(v)), nil
+		}
+	case config.CodecBinary:
+		switch v := data.(type) {
+		case string:
+			return []byte(v), nil
+		case []byte:
+			return v, nil
+		default:
+			return nil, fmt.Errorf("形式 binary では %T を公開できません（[]byte または string を指定）", data)
+		}
+	default:
+		return nil, fmt.Errorf("ペイロードの形式 %s はサポートされていません", codec)
+	}
+}
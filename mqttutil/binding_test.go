@@ -0,0 +1,226 @@
+package mqttutil
+
+import (
+	"go-mqtt/config"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func boolPtr(b bool) *bool { return &b }
+
+func TestHandlerRegistry(t *testing.T) {
+	r := NewHandlerRegistry()
+	if err := r.Register("log", func(string, []byte) {}); err != nil {
+		t.Fatalf("Register() 失敗: %v", err)
+	}
+	var gotSchema string
+	if err := r.RegisterFunc("validated", func(_ string, info config.TopicInfo) MessageHandler {
+		gotSchema = info.Schema
+		return func(string, []byte) {}
+	}); err != nil {
+		t.Fatalf("RegisterFunc() 失敗: %v", err)
+	}
+
+	if err := r.Register("log", func(string, []byte) {}); err == nil {
+		t.Error("同じ名前の登録でエラーが返されませんでした")
+	}
+	if err := r.Register("", func(string, []byte) {}); err == nil {
+		t.Error("空の名前の登録でエラーが返されませんでした")
+	}
+	if want := []string{"log", "validated"}; !slices.Equal(r.Names(), want) {
+		t.Errorf("Names() = %v、期待値は %v", r.Names(), want)
+	}
+
+	// トピックの設定がハンドラーの作成関数に渡される
+	h, err := r.Resolve("sensors", config.TopicInfo{Handler: "validated", Schema: "schemas/sensor.json"})
+	if err != nil || h == nil {
+		t.Fatalf("Resolve() = %v, %v", h, err)
+	}
+	if gotSchema != "schemas/sensor.json" {
+		t.Errorf("スキーマの参照 = %q、期待値は schemas/sensor.json", gotSchema)
+	}
+
+	if _, err := r.Resolve("sensors", config.TopicInfo{}); err == nil {
+		t.Error("ハンドラー未指定でエラーが返されませんでした")
+	}
+	if _, err := r.Resolve("sensors", config.TopicInfo{Handler: "missing"}); err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Errorf("未登録のハンドラーのエラー = %v", err)
+	}
+}
+
+func TestEncodePayload(t *testing.T) {
+	tests := []struct {
+		codec   string
+		data    any
+		want    string
+		wantErr bool
+	}{
+		{config.CodecJSON, map[string]int{"value": 1}, `{"value":1}`, false},
+		{"", "text", `"text"`, false}, // 未指定の場合はJSON
+		{config.CodecText, "hello", "hello", false},
+		{config.CodecText, []byte("bytes"), "bytes", false},
+		{config.CodecText, 42, "42", false},
+		{config.CodecText, time.Duration(time.Second), "1s", false}, // fmt.Stringer
+		{config.CodecBinary, []byte{0xff, 0x00}, "\xff\x00", false},
+		{config.CodecBinary, 42, "", true},
+		{"xml", "x", "", true},
+	}
+	for _, tt := range tests {
+		got, err := EncodePayload(tt.codec, tt.data)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("EncodePayload(%q, %v) のエラー = %v", tt.codec, tt.data, err)
+			continue
+		}
+		if !tt.wantErr && string(got) != tt.want {
+			t.Errorf("EncodePayload(%q, %v) = %q、期待値は %q", tt.codec, tt.data, got, tt.want)
+		}
+	}
+}
+
+// bindingConfig は方向・形式・ハンドラーを指定したトピックの設定
+func bindingConfig() *config.AppConfig {
+	return &config.AppConfig{
+		MQTT: config.MQTTConfig{BrokerURL: "tcp://localhost:1883", QoS: 1},
+		Topics: map[string]config.TopicInfo{
+			"sensors":  {Name: "sensors/data", Direction: config.DirectionBoth, Handler: "record", QoS: qosPtr(2)},
+			"logs":     {Name: "system/logs", Codec: config.CodecText, Handler: "record"},
+			"raw":      {Name: "raw/data", Codec: config.CodecBinary, Handler: "record"},
+			"control":  {Name: "devices/control", Direction: config.DirectionPublish, Retained: boolPtr(true)},
+			"disabled": {Name: "disabled/topic", Handler: "record", Enabled: boolPtr(false)},
+		},
+	}
+}
+
+func TestConfigApplierBindings(t *testing.T) {
+	client := NewMockClient()
+	service := NewService(client)
+
+	var mu sync.Mutex
+	received := make(map[string]int)
+	handlers := NewHandlerRegistry()
+	handlers.Register("record", func(topic string, _ []byte) {
+		mu.Lock()
+		received[topic]++
+		mu.Unlock()
+	})
+
+	applier := NewConfigApplier(service, bindingConfig(), handlers)
+	if err := applier.SubscribeAll(); err != nil {
+		t.Fatalf("SubscribeAll() 失敗: %v", err)
+	}
+	if err := service.Start(); err != nil {
+		t.Fatalf("Start() 失敗: %v", err)
+	}
+	defer service.Stop()
+
+	// 公開のみのトピックと無効なトピックはサブスクライブしない
+	for topic, want := range map[string]bool{
+		"sensors/data": true, "system/logs": true, "raw/data": true,
+		"devices/control": false, "disabled/topic": false,
+	} {
+		if _, ok := client.GetSubscriptionQoS(topic); ok != want {
+			t.Errorf("%s のサブスクライブ = %t、期待値は %t", topic, ok, want)
+		}
+	}
+
+	// 形式として不正なペイロードはハンドラーに渡されない
+	client.SimulateMessage("sensors/data", []byte(`{"value": 1}`))
+	client.SimulateMessage("sensors/data", []byte(`not json`))
+	client.SimulateMessage("system/logs", []byte("ログ"))
+	client.SimulateMessage("system/logs", []byte{0xff, 0xfe})
+	client.SimulateMessage("raw/data", []byte{0xff, 0xfe})
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	want := map[string]int{"sensors/data": 1, "system/logs": 1, "raw/data": 1}
+	for topic, n := range want {
+		if received[topic] != n {
+			t.Errorf("%s の受信数 = %d、期待値は %d", topic, received[topic], n)
+		}
+	}
+	mu.Unlock()
+	// 形式の誤りはフィルターの統計ではなく形式エラーとして数える
+	status := service.Status()
+	for topic, want := range map[string]uint64{"sensors/data": 1, "system/logs": 1, "raw/data": 0} {
+		if got := status.Subscriptions[topic].CodecErrors; got != want {
+			t.Errorf("%s の形式エラー数 = %d、期待値は %d", topic, got, want)
+		}
+		if fs := status.Subscriptions[topic].Filter; fs != (FilterStats{}) {
+			t.Errorf("%s のフィルター統計 = %+v、フィルターなしのため0を期待", topic, fs)
+		}
+	}
+}
+
+func TestConfigApplierPublish(t *testing.T) {
+	client := NewMockClient()
+	service := NewService(client)
+	applier := NewConfigApplier(service, bindingConfig(), NewHandlerRegistry())
+	if err := service.Start(); err != nil {
+		t.Fatalf("Start() 失敗: %v", err)
+	}
+	defer service.Stop()
+
+	// トピックのQoSと保持メッセージ設定が使用される
+	if err := applier.Publish("sensors", map[string]float64{"value": 1.5}); err != nil {
+		t.Fatalf("Publish() 失敗: %v", err)
+	}
+	if got := string(client.GetLastPublishedMessage("sensors/data")); got != `{"value":1.5}` {
+		t.Errorf("ペイロード = %s", got)
+	}
+	if opts, _ := client.GetLastPublishOptions("sensors/data"); opts != (PublishOptions{QoS: 2, Retained: false}) {
+		t.Errorf("sensors の公開設定 = %+v、期待値は QoS 2", opts)
+	}
+	if err := applier.Publish("control", map[string]string{"cmd": "reboot"}); err != nil {
+		t.Fatalf("Publish() 失敗: %v", err)
+	}
+	if opts, _ := client.GetLastPublishOptions("devices/control"); opts != (PublishOptions{QoS: 1, Retained: true}) {
+		t.Errorf("control の公開設定 = %+v、期待値はグローバルのQoS 1 と Retained", opts)
+	}
+
+	// サブスクライブのみ・無効・未設定のトピックには公開できない
+	for _, key := range []string{"logs", "disabled", "missing"} {
+		if err := applier.Publish(key, "x"); err == nil {
+			t.Errorf("トピック %s への公開でエラーが返されませんでした", key)
+		}
+	}
+}
+
+func TestConfigApplierToggleTopic(t *testing.T) {
+	client := NewMockClient()
+	service := NewService(client)
+	handlers := NewHandlerRegistry()
+	handlers.Register("record", func(string, []byte) {})
+	applier := NewConfigApplier(service, bindingConfig(), handlers)
+	if err := applier.SubscribeAll(); err != nil {
+		t.Fatalf("SubscribeAll() 失敗: %v", err)
+	}
+	if err := service.Start(); err != nil {
+		t.Fatalf("Start() 失敗: %v", err)
+	}
+	defer service.Stop()
+
+	// 無効にしたトピックは解除され、有効にしたトピックや方向を変えたトピックはサブスクライブされる
+	next := bindingConfig()
+	next.Topics["sensors"] = config.TopicInfo{Name: "sensors/data", Handler: "record", QoS: qosPtr(2), Enabled: boolPtr(false)}
+	next.Topics["disabled"] = config.TopicInfo{Name: "disabled/topic", Handler: "record"}
+	next.Topics["control"] = config.TopicInfo{Name: "devices/control", Direction: config.DirectionBoth, Handler: "record", Retained: boolPtr(true)}
+	next.Topics["logs"] = config.TopicInfo{Name: "system/logs", Codec: config.CodecText, Handler: "unknown"}
+
+	diff, err := applier.Apply(next)
+	if err == nil || !strings.Contains(err.Error(), "unknown") {
+		t.Errorf("未登録のハンドラーのエラー = %v", err)
+	}
+	if want := []string{"control", "disabled", "logs", "sensors"}; !slices.Equal(diff.Updated, want) {
+		t.Errorf("Updated = %v、期待値は %v", diff.Updated, want)
+	}
+	for topic, want := range map[string]bool{
+		"sensors/data": false, "disabled/topic": true, "devices/control": true, "system/logs": false,
+	} {
+		if _, ok := client.GetSubscriptionQoS(topic); ok != want {
+			t.Errorf("%s のサブスクライブ = %t、期待値は %t", topic, ok, want)
+		}
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"fmt"
 	"go-mqtt/config"
 	"log"
+	"net/url"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	paho "github.com/eclipse/paho.mqtt.golang"
@@ -26,13 +29,21 @@ type Config struct {
 // MessageHandler はメッセージ処理関数のシグネチャを定義
 type MessageHandler func(topic string, payload []byte)
 
+// PublishOptions はメッセージごとに指定する公開設定
+type PublishOptions struct {
+	QoS      byte
+	Retained bool
+}
+
 // Client はMQTT操作のインターフェース
 type Client interface {
 	Connect() error
 	Disconnect()
 	IsConnected() bool
 	Publish(topic string, payload []byte) error
+	PublishWithOptions(topic string, payload []byte, opts PublishOptions) error
 	Subscribe(topic string, handler MessageHandler) error
+	SubscribeWithQoS(topic string, qos byte, handler MessageHandler) error
 	Unsubscribe(topic string) error
 	SetQoS(qos byte)
 	SetRetained(retained bool)
@@ -45,6 +56,11 @@ const defaultConnectionTimeout = 10 * time.Second
 type pahoClient struct {
 	config Config
 	client paho.Client
+
+	mu        sync.Mutex    // config.QoS/Retainedと接続先の情報を保護
+	attempted string        // 最後に接続を試行したブローカー
+	broker    string        // 接続中のブローカー
+	connects  atomic.Uint64 // 接続成功回数（再接続を含む）
 }
 
 // NewClient は新しいMQTTクライアントを作成
@@ -100,6 +116,20 @@ func (c *pahoClient) Connect() error {
 		log.Printf("MQTT接続が切断されました: %v", err)
 	})
 
+	// 接続先ブローカーと再接続回数の記録
+	opts.SetConnectionAttemptHandler(func(broker *url.URL, tlsCfg *tls.Config) *tls.Config {
+		c.mu.Lock()
+		c.attempted = broker.String()
+		c.mu.Unlock()
+		return tlsCfg
+	})
+	opts.SetOnConnectHandler(func(_ paho.Client) {
+		c.mu.Lock()
+		c.broker = c.attempted
+		c.mu.Unlock()
+		c.connects.Add(1)
+	})
+
 	// MQTTクライアント作成
 	c.client = paho.NewClient(opts)
 
@@ -130,7 +160,19 @@ func (c *pahoClient) Publish(topic string, payload []byte) error {
 		return errors.New("MQTTブローカーに接続されていません")
 	}
 
-	token := c.client.Publish(topic, c.config.QoS, c.config.Retained, payload)
+	c.mu.Lock()
+	opts := PublishOptions{QoS: c.config.QoS, Retained: c.config.Retained}
+	c.mu.Unlock()
+	return c.PublishWithOptions(topic, payload, opts)
+}
+
+// PublishWithOptions はクライアントの設定の代わりにoptsのQoSとリテイン設定でメッセージを送信
+func (c *pahoClient) PublishWithOptions(topic string, payload []byte, opts PublishOptions) error {
+	if !c.IsConnected() {
+		return errors.New("MQTTブローカーに接続されていません")
+	}
+
+	token := c.client.Publish(topic, opts.QoS, opts.Retained, payload)
 	if token.Wait() && token.Error() != nil {
 		return fmt.Errorf("メッセージの公開に失敗: %w", token.Error())
 	}
@@ -140,11 +182,20 @@ func (c *pahoClient) Publish(topic string, payload []byte) error {
 
 // Subscribe はトピックのメッセージを受信するサブスクリプションを追加
 func (c *pahoClient) Subscribe(topic string, handler MessageHandler) error {
+	c.mu.Lock()
+	qos := c.config.QoS
+	c.mu.Unlock()
+	return c.SubscribeWithQoS(topic, qos, handler)
+}
+
+// SubscribeWithQoS はクライアントの設定の代わりにqosでサブスクリプションを追加
+// 既にサブスクライブしているトピックでは、QoSとハンドラーが置き換えられる
+func (c *pahoClient) SubscribeWithQoS(topic string, qos byte, handler MessageHandler) error {
 	if !c.IsConnected() {
 		return errors.New("MQTTブローカーに接続されていません")
 	}
 
-	token := c.client.Subscribe(topic, c.config.QoS, func(_ paho.Client, msg paho.Message) {
+	token := c.client.Subscribe(topic, qos, func(_ paho.Client, msg paho.Message) {
 		handler(msg.Topic(), msg.Payload())
 	})
 
@@ -169,12 +220,31 @@ func (c *pahoClient) Unsubscribe(topic string) error {
 	return nil
 }
 
+// CurrentBroker は接続中（または最後に接続した）ブローカーのURLを返す
+func (c *pahoClient) CurrentBroker() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.broker
+}
+
+// ReconnectCount は初回接続後に再接続に成功した回数を返す
+func (c *pahoClient) ReconnectCount() uint64 {
+	if n := c.connects.Load(); n > 1 {
+		return n - 1
+	}
+	return 0
+}
+
 // SetQoS はQoS値を設定
 func (c *pahoClient) SetQoS(qos byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.config.QoS = qos
 }
 
 // SetRetained はリテイン設定を変更
 func (c *pahoClient) SetRetained(retained bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.config.Retained = retained
 }
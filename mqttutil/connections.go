@@ -0,0 +1,108 @@
+package mqttutil
+
+import (
+	"errors"
+	"fmt"
+	"go-mqtt/config"
+)
+
+// Connections は設定の接続ごとに作成したクライアントとServiceを保持する
+//
+// 複数のブローカーの間でデータを中継する場合に、接続ごとのServiceを名前で取り出して使う
+// Connectionsから作成したConfigApplierは、トピックの connection に従って各Serviceにサブスクライブする
+type Connections struct {
+	names    []string
+	services map[string]*Service
+}
+
+// ConnectionsOption はNewConnectionsのオプション設定を行う関数
+type ConnectionsOption func(*connectionsOptions)
+
+type connectionsOptions struct {
+	newClient   func(name string, mc config.MQTTConfig) Client
+	serviceOpts []ServiceOption
+}
+
+// WithClientFactory は接続ごとのクライアントの作成方法を指定する（テストでMockClientを使う場合など）
+// 指定しない場合はNewClientFromConfigを使用する
+func WithClientFactory(newClient func(name string, mc config.MQTTConfig) Client) ConnectionsOption {
+	return func(o *connectionsOptions) {
+		o.newClient = newClient
+	}
+}
+
+// WithServiceOptions はすべての接続のServiceに適用するオプションを指定する
+func WithServiceOptions(opts ...ServiceOption) ConnectionsOption {
+	return func(o *connectionsOptions) {
+		o.serviceOpts = append(o.serviceOpts, opts...)
+	}
+}
+
+// NewConnections は設定cfgの使用する接続（cfg.ConnectionNames）ごとにクライアントとServiceを作成する
+// 接続を開始するにはStartを呼び出す
+func NewConnections(cfg *config.AppConfig, opts ...ConnectionsOption) *Connections {
+	o := connectionsOptions{
+		newClient: func(_ string, mc config.MQTTConfig) Client {
+			return NewClientFromConfig(mc)
+		},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	c := &Connections{
+		names:    cfg.ConnectionNames(),
+		services: make(map[string]*Service),
+	}
+	for _, name := range c.names {
+		mc, _ := cfg.Connection(name)
+		c.services[name] = NewService(o.newClient(name, mc), o.serviceOpts...)
+	}
+	return c
+}
+
+// Names は接続の名前を順に返す
+func (c *Connections) Names() []string {
+	return append([]string(nil), c.names...)
+}
+
+// Service は名前の接続のServiceを返す
+// 空文字列はconfig.DefaultConnection（mqtt セクションの接続）を表す
+func (c *Connections) Service(name string) (*Service, bool) {
+	if name == "" {
+		name = config.DefaultConnection
+	}
+	s, ok := c.services[name]
+	return s, ok
+}
+
+// Start はすべての接続のServiceを開始する
+// 1つでも開始に失敗した場合は、開始済みのServiceを停止してエラーを返す
+func (c *Connections) Start() error {
+	for i, name := range c.names {
+		if err := c.services[name].Start(); err != nil {
+			for _, started := range c.names[:i] {
+				c.services[started].Stop()
+			}
+			return fmt.Errorf("接続 %s の開始に失敗: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Stop はすべての接続のServiceを停止する
+func (c *Connections) Stop() {
+	for _, name := range c.names {
+		c.services[name].Stop()
+	}
+}
+
+// Applier はトピックの connection に従って各接続のServiceにサブスクライブするConfigApplierを作成する
+func (c *Connections) Applier(cfg *config.AppConfig, handler HandlerResolver) *ConfigApplier {
+	a := NewConfigApplier(nil, cfg, handler)
+	a.connections = c
+	return a
+}
+
+// errNoConnection は接続のServiceが作成されていない場合のエラー
+var errNoConnection = errors.New("接続のServiceが作成されていません")
@@ -0,0 +1,158 @@
+package mqttutil
+
+import (
+	"errors"
+	"go-mqtt/config"
+	"slices"
+	"testing"
+)
+
+// bridgeConfig はオンサイト（mqtt セクション）とクラウドの2つの接続を使用する設定
+func bridgeConfig() *config.AppConfig {
+	return &config.AppConfig{
+		MQTT: config.MQTTConfig{BrokerURL: "tcp://onsite:1883", QoS: 1},
+		Connections: map[string]config.MQTTConfig{
+			"cloud": {BrokerURL: "ssl://cloud:8883", QoS: 0},
+		},
+		Topics: map[string]config.TopicInfo{
+			"local":    {Name: "sensors/data", Handler: "record"},
+			"upstream": {Name: "site-a/sensors", Direction: config.DirectionBoth, Connection: "cloud", Handler: "record"},
+		},
+	}
+}
+
+// newMockConnections はMockClientを使用するConnectionsと、接続ごとのMockClientを返す
+func newMockConnections(cfg *config.AppConfig) (*Connections, map[string]*MockClient) {
+	clients := make(map[string]*MockClient)
+	conns := NewConnections(cfg, WithClientFactory(func(name string, mc config.MQTTConfig) Client {
+		client := NewMockClient()
+		client.SetQoS(mc.QoS)
+		clients[name] = client
+		return client
+	}))
+	return conns, clients
+}
+
+func TestConnections(t *testing.T) {
+	conns, clients := newMockConnections(bridgeConfig())
+	if want := []string{config.DefaultConnection, "cloud"}; !slices.Equal(conns.Names(), want) {
+		t.Errorf("Names() = %v、期待値は %v", conns.Names(), want)
+	}
+	if len(clients) != 2 {
+		t.Fatalf("作成されたクライアント数 = %d、期待値は 2", len(clients))
+	}
+	def, _ := conns.Service("")
+	if s, _ := conns.Service(config.DefaultConnection); s != def || s.client != clients[config.DefaultConnection] {
+		t.Error("空文字列の接続名が mqtt セクションの接続になっていません")
+	}
+	if _, ok := conns.Service("missing"); ok {
+		t.Error("存在しない接続のServiceが返されました")
+	}
+
+	if err := conns.Start(); err != nil {
+		t.Fatalf("Start() 失敗: %v", err)
+	}
+	for name, client := range clients {
+		if !client.IsConnected() {
+			t.Errorf("接続 %s が開始されていません", name)
+		}
+	}
+	conns.Stop()
+	for name, client := range clients {
+		if client.IsConnected() {
+			t.Errorf("接続 %s が停止されていません", name)
+		}
+	}
+}
+
+func TestConnectionsStartError(t *testing.T) {
+	conns, clients := newMockConnections(bridgeConfig())
+	clients["cloud"].SetConnectError(errors.New("接続拒否"))
+
+	if err := conns.Start(); err == nil {
+		t.Fatal("接続の失敗でエラーが返されませんでした")
+	}
+	// 開始済みの接続は停止される
+	if clients[config.DefaultConnection].IsConnected() {
+		t.Error("開始に失敗したときに他の接続が停止されていません")
+	}
+}
+
+func TestConnectionsApplier(t *testing.T) {
+	cfg := bridgeConfig()
+	conns, clients := newMockConnections(cfg)
+	handlers := NewHandlerRegistry()
+	handlers.Register("record", func(string, []byte) {})
+
+	applier := conns.Applier(cfg, handlers)
+	if err := applier.SubscribeAll(); err != nil {
+		t.Fatalf("SubscribeAll() 失敗: %v", err)
+	}
+	if err := conns.Start(); err != nil {
+		t.Fatalf("Start() 失敗: %v", err)
+	}
+	defer conns.Stop()
+
+	// トピックはそれぞれの接続でサブスクライブされる
+	onsite, cloud := clients[config.DefaultConnection], clients["cloud"]
+	if _, ok := onsite.GetSubscriptionQoS("sensors/data"); !ok {
+		t.Error("local がオンサイトの接続でサブスクライブされていません")
+	}
+	if _, ok := cloud.GetSubscriptionQoS("site-a/sensors"); !ok {
+		t.Error("upstream がクラウドの接続でサブスクライブされていません")
+	}
+	if _, ok := onsite.GetSubscriptionQoS("site-a/sensors"); ok {
+		t.Error("upstream がオンサイトの接続でサブスクライブされています")
+	}
+
+	// 公開はトピックの接続で、接続のQoSを使用する
+	if err := applier.Publish("upstream", map[string]int{"value": 1}); err != nil {
+		t.Fatalf("Publish() 失敗: %v", err)
+	}
+	if opts, ok := cloud.GetLastPublishOptions("site-a/sensors"); !ok || opts.QoS != 0 {
+		t.Errorf("クラウドへの公開 = %+v (%t)、期待値は QoS 0", opts, ok)
+	}
+	if onsite.GetLastPublishedMessage("site-a/sensors") != nil {
+		t.Error("オンサイトの接続に公開されました")
+	}
+
+	// トピックの接続を変更すると、新しい接続でサブスクライブし直す
+	next := bridgeConfig()
+	next.Connections["cloud"] = config.MQTTConfig{BrokerURL: "ssl://cloud:8883", QoS: 2}
+	next.Topics["local"] = config.TopicInfo{Name: "sensors/data", Connection: "cloud", Handler: "record"}
+	diff, err := applier.Apply(next)
+	if err != nil {
+		t.Fatalf("Apply() 失敗: %v", err)
+	}
+	if want := []string{"local"}; !slices.Equal(diff.Updated, want) {
+		t.Errorf("Updated = %v、期待値は %v", diff.Updated, want)
+	}
+	if _, ok := onsite.GetSubscriptionQoS("sensors/data"); ok {
+		t.Error("変更前の接続のサブスクリプションが残っています")
+	}
+	if _, ok := cloud.GetSubscriptionQoS("sensors/data"); !ok {
+		t.Error("変更後の接続でサブスクライブされていません")
+	}
+	// 接続のQoSの変更はその接続のクライアントに反映される
+	if cloud.GetQoS() != 2 || onsite.GetQoS() != 1 {
+		t.Errorf("QoS = cloud %d, onsite %d、期待値は 2, 1", cloud.GetQoS(), onsite.GetQoS())
+	}
+}
+
+func TestDiffConfigConnections(t *testing.T) {
+	old := bridgeConfig()
+	next := bridgeConfig()
+	next.Connections["cloud"] = config.MQTTConfig{BrokerURL: "ssl://cloud2:8883"}
+	next.Connections["backup"] = config.MQTTConfig{BrokerURL: "tcp://backup:1883"}
+
+	d := DiffConfig(old, next)
+	if want := []string{"connections.backup", "connections.cloud.broker_url"}; !slices.Equal(d.Restart, want) {
+		t.Errorf("Restart = %v、期待値は %v", d.Restart, want)
+	}
+
+	delete(next.Connections, "cloud")
+	d = DiffConfig(old, next)
+	if !slices.Contains(d.Restart, "connections.cloud") {
+		t.Errorf("削除した接続が Restart に含まれていません: %v", d.Restart)
+	}
+}
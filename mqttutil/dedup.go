@@ -0,0 +1,102 @@
+package mqttutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"go-mqtt/cache"
+	"sync"
+	"time"
+)
+
+// KeyFunc はメッセージから重複判定用のキーを取り出す関数
+// falseを返したメッセージは重複判定の対象外として常にハンドラーへ渡される
+type KeyFunc func(topic string, payload []byte) (string, bool)
+
+// PayloadHashKey はトピックとペイロードのSHA-256ハッシュをキーとして返す
+func PayloadHashKey(topic string, payload []byte) (string, bool) {
+	h := sha256.New()
+	h.Write([]byte(topic))
+	h.Write([]byte{0})
+	h.Write(payload)
+	return hex.EncodeToString(h.Sum(nil)), true
+}
+
+// seenEntry は受信順に記録したキーと受信時刻
+type seenEntry struct {
+	key string
+	at  time.Time
+}
+
+// Deduplicator は一定時間内に同じキーで届いたメッセージを重複として検出する
+// QoS 1 の再配信で同じメッセージが複数回ハンドラーに渡るのを防ぐために使用する
+type Deduplicator struct {
+	window  time.Duration
+	keyFunc KeyFunc
+	seen    *cache.Cache[time.Time]
+	order   []seenEntry // 古い順に並んだ受信記録（期限切れキーの掃除に使用）
+	mu      sync.Mutex
+	now     func() time.Time
+}
+
+// NewDeduplicator は新しいDeduplicatorを作成
+// keyFuncがnilの場合はPayloadHashKeyを使用する
+func NewDeduplicator(window time.Duration, keyFunc KeyFunc) *Deduplicator {
+	if keyFunc == nil {
+		keyFunc = PayloadHashKey
+	}
+	return &Deduplicator{
+		window:  window,
+		keyFunc: keyFunc,
+		seen:    cache.New[time.Time](),
+		now:     time.Now,
+	}
+}
+
+// IsDuplicate はメッセージがウィンドウ内で既に受信済みかどうかを返す
+// 初めて見たメッセージは受信済みとして記録される
+func (d *Deduplicator) IsDuplicate(topic string, payload []byte) bool {
+	return d.isDuplicateIn("", topic, payload)
+}
+
+// isDuplicateIn はscopeごとに独立して重複判定を行う
+// Serviceはサブスクリプションのフィルターをscopeとして使用する
+func (d *Deduplicator) isDuplicateIn(scope, topic string, payload []byte) bool {
+	key, ok := d.keyFunc(topic, payload)
+	if !ok {
+		return false
+	}
+	if scope != "" {
+		key = scope + "\x00" + key
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	d.prune(now)
+
+	if at, exists := d.seen.Get(key); exists && now.Sub(at) < d.window {
+		return true
+	}
+
+	d.seen.Set(key, now)
+	d.order = append(d.order, seenEntry{key: key, at: now})
+	return false
+}
+
+// prune はウィンドウを過ぎた受信記録をキャッシュから削除
+// ロックが既に取得された状態で呼び出される内部メソッド
+func (d *Deduplicator) prune(now time.Time) {
+	n := 0
+	for _, e := range d.order {
+		if now.Sub(e.at) < d.window {
+			break
+		}
+		// 同じキーが後から再記録されている場合は削除しない
+		if at, ok := d.seen.Get(e.key); ok && at.Equal(e.at) {
+			d.seen.Delete(e.key)
+		}
+		n++
+	}
+	d.order = d.order[n:]
+}
@@ -0,0 +1,103 @@
+package mqttutil
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeduplicatorPayloadHash(t *testing.T) {
+	d := NewDeduplicator(time.Minute, nil)
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	if d.IsDuplicate("sensors/data", []byte("a")) {
+		t.Error("初回のメッセージが重複と判定された")
+	}
+	if !d.IsDuplicate("sensors/data", []byte("a")) {
+		t.Error("同じメッセージが重複と判定されなかった")
+	}
+	if d.IsDuplicate("sensors/data", []byte("b")) {
+		t.Error("異なるペイロードが重複と判定された")
+	}
+	if d.IsDuplicate("sensors/other", []byte("a")) {
+		t.Error("異なるトピックの同じペイロードが重複と判定された")
+	}
+}
+
+func TestDeduplicatorWindow(t *testing.T) {
+	d := NewDeduplicator(time.Second, nil)
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	d.IsDuplicate("t", []byte("a"))
+
+	// ウィンドウ内は重複
+	now = now.Add(500 * time.Millisecond)
+	if !d.IsDuplicate("t", []byte("a")) {
+		t.Error("ウィンドウ内のメッセージが重複と判定されなかった")
+	}
+
+	// ウィンドウを過ぎると新しいメッセージとして扱う
+	now = now.Add(time.Second)
+	if d.IsDuplicate("t", []byte("a")) {
+		t.Error("ウィンドウ経過後のメッセージが重複と判定された")
+	}
+
+	// 期限切れの記録は掃除されている
+	if len(d.order) != 1 {
+		t.Errorf("受信記録数 = %d、期待値は 1", len(d.order))
+	}
+}
+
+func TestDeduplicatorKeyFunc(t *testing.T) {
+	// ペイロード内のIDで重複判定する
+	d := NewDeduplicator(time.Minute, func(_ string, payload []byte) (string, bool) {
+		var msg struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal(payload, &msg); err != nil || msg.ID == "" {
+			return "", false
+		}
+		return msg.ID, true
+	})
+
+	if d.IsDuplicate("t", []byte(`{"id":"1","value":1}`)) {
+		t.Error("初回のメッセージが重複と判定された")
+	}
+	if !d.IsDuplicate("t", []byte(`{"id":"1","value":2}`)) {
+		t.Error("同じIDのメッセージが重複と判定されなかった")
+	}
+	// キーを取り出せないメッセージは常に通す
+	if d.IsDuplicate("t", []byte("not json")) || d.IsDuplicate("t", []byte("not json")) {
+		t.Error("キーのないメッセージが重複と判定された")
+	}
+}
+
+func TestServiceDeduplication(t *testing.T) {
+	client := NewMockClient()
+	service := NewService(client, WithDeduplicator(NewDeduplicator(time.Minute, nil)))
+
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() 失敗: %v", err)
+	}
+
+	var count atomic.Int32
+	topic := "test/dedup"
+	if err := service.Subscribe(topic, func(_ string, _ []byte) {
+		count.Add(1)
+	}); err != nil {
+		t.Fatalf("Subscribe() 失敗: %v", err)
+	}
+
+	// 同じメッセージを再配信
+	client.SimulateMessage(topic, []byte("payload"))
+	client.SimulateMessage(topic, []byte("payload"))
+	client.SimulateMessage(topic, []byte("other"))
+
+	time.Sleep(50 * time.Millisecond)
+	if got := count.Load(); got != 2 {
+		t.Errorf("ハンドラー呼び出し回数 = %d、期待値は 2", got)
+	}
+}
@@ -0,0 +1,27 @@
+package mqttutil
+
+import "go-mqtt/filterexpr"
+
+// Filter はメッセージをハンドラーに渡すかどうかを判定する述語
+// falseを返したメッセージはハンドラーに渡されない
+type Filter func(topic string, payload []byte) bool
+
+// ParseFilter はJSONペイロードに対する宣言的なフィルター式を解析する
+//
+// 式の書式:
+//   - 比較:     value > 50, device_id == "dev-1", meta.active != false
+//   - 集合:     device_id in ["dev-1", "dev-2"]
+//   - 論理演算: && (and), || (or), ! (not), 括弧
+//
+// JSONとして解析できないペイロードや存在しないフィールドとの比較は（!= を含め）falseになる
+// フィールドが存在する場合、!= は == の否定になる
+// 式の詳細はfilterexprパッケージを参照
+func ParseFilter(expr string) (Filter, error) {
+	e, err := filterexpr.Parse(expr)
+	if err != nil {
+		return nil, err
+	}
+	return func(_ string, payload []byte) bool {
+		return e.Match(payload)
+	}, nil
+}
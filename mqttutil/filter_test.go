@@ -0,0 +1,123 @@
+package mqttutil
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseFilter(t *testing.T) {
+	payload := []byte(`{"device_id":"dev-1","value":72.5,"active":true,"meta":{"site":"plant-a","level":3},"note":null}`)
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{"value > 50", true},
+		{"value <= 50", false},
+		{"value == 72.5", true},
+		{"value != 72.5", false},
+		{`device_id == "dev-1"`, true},
+		{`device_id in ["dev-1", "dev-2"]`, true},
+		{`device_id in ['dev-3']`, false},
+		{"active == true", true},
+		{"note == null", true},
+		{`meta.site == "plant-a"`, true},
+		{"meta.level >= 3", true},
+		{"value > 50 && meta.level < 3", false},
+		{"value > 50 and meta.level < 3 or active == true", true},
+		{"!(value > 50)", false},
+		{"not active == false", true},
+		{"(value > 100 || value < 0) && active == true", false},
+		{"missing > 0", false},
+		{"missing != 0", false},
+		{`value == "72.5"`, false},
+		{"meta == true", false},
+	}
+
+	for _, tt := range tests {
+		f, err := ParseFilter(tt.expr)
+		if err != nil {
+			t.Errorf("ParseFilter(%q) 失敗: %v", tt.expr, err)
+			continue
+		}
+		if got := f("t", payload); got != tt.want {
+			t.Errorf("ParseFilter(%q) = %t、期待値は %t", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseFilterInvalidPayload(t *testing.T) {
+	f, err := ParseFilter("value > 0")
+	if err != nil {
+		t.Fatalf("ParseFilter() 失敗: %v", err)
+	}
+	if f("t", []byte("not json")) {
+		t.Error("JSONでないペイロードがフィルターを通過した")
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	exprs := []string{
+		"",
+		"value >",
+		"value = 1",
+		"value > 1 &&",
+		"(value > 1",
+		"device_id in [",
+		`device_id in ["a" "b"]`,
+		`name == "unterminated`,
+		"value > 1 extra",
+		"value & 1",
+		"> 1",
+	}
+	for _, expr := range exprs {
+		if _, err := ParseFilter(expr); err == nil {
+			t.Errorf("ParseFilter(%q) がエラーを返さなかった", expr)
+		}
+	}
+}
+
+func TestServiceSubscribeWithFilter(t *testing.T) {
+	client := NewMockClient()
+	service := NewService(client)
+
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() 失敗: %v", err)
+	}
+
+	filter, err := ParseFilter("value > 50")
+	if err != nil {
+		t.Fatalf("ParseFilter() 失敗: %v", err)
+	}
+
+	var filtered, unfiltered atomic.Int32
+	topic := "test/filter"
+	if err := service.Subscribe(topic, func(_ string, _ []byte) {
+		filtered.Add(1)
+	}, filter); err != nil {
+		t.Fatalf("Subscribe() 失敗: %v", err)
+	}
+	if err := service.Subscribe(topic, func(_ string, _ []byte) {
+		unfiltered.Add(1)
+	}); err != nil {
+		t.Fatalf("Subscribe() 失敗: %v", err)
+	}
+
+	client.SimulateMessage(topic, []byte(`{"value":80}`))
+	client.SimulateMessage(topic, []byte(`{"value":20}`))
+	client.SimulateMessage(topic, []byte(`{"value":51}`))
+
+	time.Sleep(50 * time.Millisecond)
+	if got := filtered.Load(); got != 2 {
+		t.Errorf("フィルター付きハンドラー呼び出し回数 = %d、期待値は 2", got)
+	}
+	if got := unfiltered.Load(); got != 3 {
+		t.Errorf("フィルターなしハンドラー呼び出し回数 = %d、期待値は 3", got)
+	}
+
+	stats := service.FilterStats(topic)
+	if stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("FilterStats() = %+v、期待値は Hits=2 Misses=1", stats)
+	}
+}
@@ -0,0 +1,77 @@
+package mqttutil
+
+import (
+	"bytes"
+	"go-mqtt/cache"
+	"sort"
+	"time"
+)
+
+// Message は受信したメッセージ
+type Message struct {
+	Topic      string
+	Payload    []byte
+	ReceivedAt time.Time
+}
+
+// WithLastValueCache は具体的なトピックごとに最後に受信したメッセージをcに保存する
+// 保存したメッセージはLastとLastMatchingで参照できる
+func WithLastValueCache(c cache.CacheInterface[Message]) ServiceOption {
+	return func(s *Service) {
+		s.lastValues = c
+	}
+}
+
+// Last はトピックで最後に受信したメッセージを返す
+// WithLastValueCacheを指定していない場合は常にfalseを返す
+func (s *Service) Last(topic string) (Message, bool) {
+	if s.lastValues == nil {
+		return Message{}, false
+	}
+	return s.lastValues.Get(topic)
+}
+
+// topicMatcher はトピックの階層による索引でフィルターに一致するエントリを返すキャッシュ
+// （cache.Cache、cache.Sharded）
+type topicMatcher interface {
+	Match(filter string) map[string]Message
+}
+
+// LastMatching はトピックフィルター（+ / # ワイルドカードを含む）に一致する
+// すべてのトピックの最後のメッセージをトピック名順に返す
+// キャッシュがMatchを持つ場合は索引を使用し、持たない場合は全件を走査する
+func (s *Service) LastMatching(filter string) []Message {
+	if s.lastValues == nil {
+		return nil
+	}
+
+	var msgs []Message
+	if m, ok := s.lastValues.(topicMatcher); ok {
+		for _, msg := range m.Match(filter) {
+			msgs = append(msgs, msg)
+		}
+	} else {
+		s.lastValues.Range(func(topic string, msg Message) bool {
+			if TopicMatches(filter, topic) {
+				msgs = append(msgs, msg)
+			}
+			return true
+		})
+	}
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].Topic < msgs[j].Topic
+	})
+	return msgs
+}
+
+// storeLastValue は受信したメッセージを最後の値として保存する
+func (s *Service) storeLastValue(topic string, payload []byte) {
+	if s.lastValues == nil {
+		return
+	}
+	s.lastValues.Set(topic, Message{
+		Topic:      topic,
+		Payload:    bytes.Clone(payload), // ハンドラーによる変更の影響を受けないようにコピーする
+		ReceivedAt: time.Now(),
+	})
+}
@@ -0,0 +1,124 @@
+package mqttutil
+
+import (
+	"go-mqtt/cache"
+	"slices"
+	"testing"
+)
+
+func TestServiceLastValue(t *testing.T) {
+	client := NewMockClient()
+	service := NewService(client, WithLastValueCache(cache.New[Message]()))
+
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() 失敗: %v", err)
+	}
+	if err := service.Subscribe("sensors/#", func(_ string, payload []byte) {
+		// ハンドラーがペイロードを変更しても保存された値は変わらない
+		if len(payload) > 0 {
+			payload[0] = 'X'
+		}
+	}); err != nil {
+		t.Fatalf("Subscribe() 失敗: %v", err)
+	}
+
+	if _, ok := service.Last("sensors/a/temp"); ok {
+		t.Error("受信前にLast()がokを返した")
+	}
+
+	client.SimulateMessage("sensors/a/temp", []byte("20"))
+	client.SimulateMessage("sensors/a/temp", []byte("21"))
+	client.SimulateMessage("sensors/b/temp", []byte("30"))
+	client.SimulateMessage("sensors/b/humidity", []byte("55"))
+
+	msg, ok := service.Last("sensors/a/temp")
+	if !ok {
+		t.Fatal("Last() がメッセージを返さなかった")
+	}
+	if string(msg.Payload) != "21" || msg.Topic != "sensors/a/temp" || msg.ReceivedAt.IsZero() {
+		t.Errorf("Last() = %+v、期待値は sensors/a/temp の 21", msg)
+	}
+
+	msgs := service.LastMatching("sensors/+/temp")
+	if len(msgs) != 2 {
+		t.Fatalf("LastMatching() の件数 = %d、期待値は 2", len(msgs))
+	}
+	if msgs[0].Topic != "sensors/a/temp" || msgs[1].Topic != "sensors/b/temp" {
+		t.Errorf("LastMatching() = [%s %s]、期待値は [sensors/a/temp sensors/b/temp]", msgs[0].Topic, msgs[1].Topic)
+	}
+	if n := len(service.LastMatching("sensors/#")); n != 3 {
+		t.Errorf("LastMatching(sensors/#) の件数 = %d、期待値は 3", n)
+	}
+}
+
+// countingCache はRangeの呼び出し回数を数える、Matchを持たないキャッシュ
+type countingCache struct {
+	cache.CacheInterface[Message]
+	ranges int
+}
+
+func (c *countingCache) Range(fn func(string, Message) bool) {
+	c.ranges++
+	c.CacheInterface.Range(fn)
+}
+
+// matchingCache はMatchも公開するcountingCache
+type matchingCache struct {
+	*countingCache
+	match func(string) map[string]Message
+}
+
+func (c matchingCache) Match(filter string) map[string]Message { return c.match(filter) }
+
+func TestServiceLastMatchingIndex(t *testing.T) {
+	store := cache.New[Message]()
+	indexed := matchingCache{countingCache: &countingCache{CacheInterface: store}, match: store.Match}
+	scanned := &countingCache{CacheInterface: cache.New[Message]()}
+
+	for _, c := range []cache.CacheInterface[Message]{indexed, scanned} {
+		for _, topic := range []string{"sensors/a/temp", "sensors/b/temp", "sensors/b/humidity", "$SYS/uptime"} {
+			c.Set(topic, Message{Topic: topic})
+		}
+	}
+
+	// 索引を使用する場合も走査する場合も同じ結果になる
+	for _, filter := range []string{"sensors/+/temp", "sensors/#", "#", "+/uptime", "$SYS/#", "other"} {
+		var got [2][]string
+		for i, c := range []cache.CacheInterface[Message]{indexed, scanned} {
+			for _, msg := range NewService(NewMockClient(), WithLastValueCache(c)).LastMatching(filter) {
+				got[i] = append(got[i], msg.Topic)
+			}
+		}
+		if !slices.Equal(got[0], got[1]) {
+			t.Errorf("LastMatching(%q) = %v（索引）、%v（走査）", filter, got[0], got[1])
+		}
+	}
+
+	// Matchを持つキャッシュでは全件を走査しない
+	if indexed.ranges != 0 {
+		t.Errorf("索引を使用できるキャッシュでRangeが %d 回呼び出されました", indexed.ranges)
+	}
+	if scanned.ranges == 0 {
+		t.Error("Matchを持たないキャッシュでRangeが呼び出されませんでした")
+	}
+}
+
+func TestServiceLastValueDisabled(t *testing.T) {
+	client := NewMockClient()
+	service := NewService(client)
+
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() 失敗: %v", err)
+	}
+	if err := service.Subscribe("t", func(string, []byte) {}); err != nil {
+		t.Fatalf("Subscribe() 失敗: %v", err)
+	}
+	client.SimulateMessage("t", []byte("x"))
+
+	if _, ok := service.Last("t"); ok {
+		t.Error("無効時にLast()がokを返した")
+	}
+	if msgs := service.LastMatching("#"); msgs != nil {
+		t.Errorf("無効時のLastMatching() = %v、期待値は nil", msgs)
+	}
+}
@@ -1,8 +1,11 @@
 package mqttutil
 
 import (
+	"bytes"
 	"errors"
 	"log"
+	"slices"
+	"strings"
 	"sync"
 )
 
@@ -10,7 +13,9 @@ import (
 type MockClient struct {
 	connected        bool
 	publishedMsgs    map[string][]byte
+	publishedOpts    map[string]PublishOptions
 	subscriptions    map[string]MessageHandler
+	subscriptionQoS  map[string]byte
 	mu               sync.RWMutex
 	connectError     error
 	publishError     error
@@ -18,14 +23,18 @@ type MockClient struct {
 	unsubscribeError error
 	qos              byte
 	retained         bool
+	reconnects       uint64
+	broker           *MockBroker // nilの場合は公開したメッセージを配信しない
 }
 
 // NewMockClient は新しいモックMQTTクライアントを作成
 func NewMockClient() *MockClient {
 	return &MockClient{
-		publishedMsgs: make(map[string][]byte),
-		subscriptions: make(map[string]MessageHandler),
-		qos:           1, // デフォルトQoS
+		publishedMsgs:   make(map[string][]byte),
+		publishedOpts:   make(map[string]PublishOptions),
+		subscriptions:   make(map[string]MessageHandler),
+		subscriptionQoS: make(map[string]byte),
+		qos:             1, // デフォルトQoS
 	}
 }
 
@@ -56,26 +65,50 @@ func (m *MockClient) IsConnected() bool {
 
 // Publish モック実装
 func (m *MockClient) Publish(topic string, payload []byte) error {
+	m.mu.RLock()
+	opts := PublishOptions{QoS: m.qos, Retained: m.retained}
+	m.mu.RUnlock()
+	return m.PublishWithOptions(topic, payload, opts)
+}
+
+// PublishWithOptions モック実装
+// MockBrokerから作成したクライアントでは、同じブローカーのクライアントにメッセージを配信する
+func (m *MockClient) PublishWithOptions(topic string, payload []byte, opts PublishOptions) error {
 	m.mu.Lock()
-	defer m.mu.Unlock()
 	if m.publishError != nil {
+		m.mu.Unlock()
 		return m.publishError
 	}
 	if !m.connected {
+		m.mu.Unlock()
 		return errors.New("MQTTブローカーに接続されていません")
 	}
 
-	// この時点でQoSとRetainedの値をログに出力したり
-	// 検証用に保存したりすることもできます
+	// QoSとRetainedの値はログに出力し、検証用に保存する
 	log.Printf("トピック: %s にメッセージを公開 (QoS: %d, Retained: %t)",
-		topic, m.qos, m.retained)
+		topic, opts.QoS, opts.Retained)
 
 	m.publishedMsgs[topic] = payload
+	m.publishedOpts[topic] = opts
+	broker := m.broker
+	m.mu.Unlock()
+
+	if broker != nil {
+		broker.publish(topic, payload, opts.Retained)
+	}
 	return nil
 }
 
 // Subscribe モック実装
 func (m *MockClient) Subscribe(topic string, handler MessageHandler) error {
+	m.mu.RLock()
+	qos := m.qos
+	m.mu.RUnlock()
+	return m.SubscribeWithQoS(topic, qos, handler)
+}
+
+// SubscribeWithQoS モック実装
+func (m *MockClient) SubscribeWithQoS(topic string, qos byte, handler MessageHandler) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	if m.subscribeError != nil {
@@ -85,6 +118,18 @@ func (m *MockClient) Subscribe(topic string, handler MessageHandler) error {
 		return errors.New("MQTTブローカーに接続されていません")
 	}
 	m.subscriptions[topic] = handler
+	m.subscriptionQoS[topic] = qos
+
+	// 実際のブローカーと同様に、一致するリテインメッセージを非同期に配信する
+	if m.broker != nil {
+		if retained := m.broker.retainedFor(topic); len(retained) > 0 {
+			go func() {
+				for _, msg := range retained {
+					handler(msg.topic, msg.payload)
+				}
+			}()
+		}
+	}
 	return nil
 }
 
@@ -99,6 +144,7 @@ func (m *MockClient) Unsubscribe(topic string) error {
 		return errors.New("MQTTブローカーに接続されていません")
 	}
 	delete(m.subscriptions, topic)
+	delete(m.subscriptionQoS, topic)
 	return nil
 }
 
@@ -130,6 +176,14 @@ func (m *MockClient) SetUnsubscribeError(err error) {
 	m.unsubscribeError = err
 }
 
+// GetSubscriptionQoS はテスト用にトピックをサブスクライブしたQoSを取得
+func (m *MockClient) GetSubscriptionQoS(topic string) (byte, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	qos, ok := m.subscriptionQoS[topic]
+	return qos, ok
+}
+
 // GetLastPublishedMessage はトピックに公開された最後のメッセージを返す
 func (m *MockClient) GetLastPublishedMessage(topic string) []byte {
 	m.mu.RLock()
@@ -137,17 +191,56 @@ func (m *MockClient) GetLastPublishedMessage(topic string) []byte {
 	return m.publishedMsgs[topic]
 }
 
+// GetLastPublishOptions はトピックに最後に公開したときのQoSとRetainedを返す
+func (m *MockClient) GetLastPublishOptions(topic string) (PublishOptions, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	opts, ok := m.publishedOpts[topic]
+	return opts, ok
+}
+
 // SimulateMessage はブローカーからの受信メッセージをシミュレート
+// トピックに一致するすべてのサブスクリプション（ワイルドカードを含む）のハンドラーが呼び出される
 func (m *MockClient) SimulateMessage(topic string, payload []byte) {
 	m.mu.RLock()
-	handler, exists := m.subscriptions[topic]
+	var handlers []MessageHandler
+	for filter, handler := range m.subscriptions {
+		if TopicMatches(filter, topic) {
+			handlers = append(handlers, handler)
+		}
+	}
 	m.mu.RUnlock()
 
-	if exists {
+	for _, handler := range handlers {
 		handler(topic, payload)
 	}
 }
 
+// CurrentBroker モック実装
+func (m *MockClient) CurrentBroker() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if !m.connected {
+		return ""
+	}
+	return "mock://localhost"
+}
+
+// ReconnectCount モック実装
+func (m *MockClient) ReconnectCount() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.reconnects
+}
+
+// SimulateReconnect はブローカーへの再接続をシミュレート
+func (m *MockClient) SimulateReconnect() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.connected = true
+	m.reconnects++
+}
+
 // SetQoS モック実装
 func (m *MockClient) SetQoS(qos byte) {
 	m.mu.Lock()
@@ -175,3 +268,74 @@ func (m *MockClient) GetRetained() bool {
 	defer m.mu.RUnlock()
 	return m.retained
 }
+
+// MockBroker は複数のMockClientの間でメッセージを中継するテスト用のブローカー
+// 公開されたメッセージは接続中のすべてのクライアント（公開元を含む）に配信され、
+// リテインメッセージはサブスクライブ時に配信される
+type MockBroker struct {
+	mu       sync.Mutex
+	clients  []*MockClient
+	retained map[string][]byte
+}
+
+// mockMessage はMockBrokerが保持するリテインメッセージ
+type mockMessage struct {
+	topic   string
+	payload []byte
+}
+
+// NewMockBroker は新しいモックブローカーを作成
+func NewMockBroker() *MockBroker {
+	return &MockBroker{
+		retained: make(map[string][]byte),
+	}
+}
+
+// NewClient はこのブローカーに接続するモッククライアントを作成
+func (b *MockBroker) NewClient() *MockClient {
+	c := NewMockClient()
+	c.broker = b
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clients = append(b.clients, c)
+	return c
+}
+
+// publish はメッセージを接続中のクライアントに配信する
+// 空のペイロードのリテインメッセージは保持しているリテインメッセージを削除する
+func (b *MockBroker) publish(topic string, payload []byte, retained bool) {
+	b.mu.Lock()
+	if retained {
+		if len(payload) == 0 {
+			delete(b.retained, topic)
+		} else {
+			b.retained[topic] = bytes.Clone(payload)
+		}
+	}
+	clients := slices.Clone(b.clients)
+	b.mu.Unlock()
+
+	for _, c := range clients {
+		if c.IsConnected() {
+			c.SimulateMessage(topic, payload)
+		}
+	}
+}
+
+// retainedFor はトピックフィルターに一致するリテインメッセージをトピック順に返す
+func (b *MockBroker) retainedFor(filter string) []mockMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var msgs []mockMessage
+	for topic, payload := range b.retained {
+		if TopicMatches(filter, topic) {
+			msgs = append(msgs, mockMessage{topic: topic, payload: payload})
+		}
+	}
+	slices.SortFunc(msgs, func(a, b mockMessage) int {
+		return strings.Compare(a.topic, b.topic)
+	})
+	return msgs
+}
@@ -0,0 +1,408 @@
+package mqttutil
+
+import (
+	"errors"
+	"fmt"
+	"go-mqtt/config"
+	"maps"
+	"slices"
+	"sync"
+)
+
+// TopicHandlerFunc は設定のトピック（keyは設定ファイル上のキー）に対応するハンドラーを返す
+type TopicHandlerFunc func(key string, info config.TopicInfo) MessageHandler
+
+// ConfigDiff は2つの設定の差分
+// トピックは設定ファイル上のキーで識別し、各スライスはキーの順に並ぶ
+type ConfigDiff struct {
+	Added   []string // 追加されたトピック
+	Removed []string // 削除されたトピック
+	Updated []string // 説明（Description）以外の項目が変更されたトピック
+	Restart []string // 実行中には適用できず、再起動が必要な設定キー（例: "mqtt.broker_url", "connections.cloud"）
+
+	publish []string // QoSまたはリテイン設定が変更された接続の名前
+}
+
+// Empty は適用すべき変更も再起動が必要な変更もない場合にtrueを返す
+func (d ConfigDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Updated) == 0 && len(d.Restart) == 0 && len(d.publish) == 0
+}
+
+// DiffConfig は設定oldからnextへの差分を返す
+func DiffConfig(old, next *config.AppConfig) ConfigDiff {
+	var d ConfigDiff
+
+	// 接続に関する設定は再接続が必要なため、実行中には適用しない
+	// 接続の追加と削除も同様に "connections.<name>" として再起動が必要な変更とする
+	d.diffConnection(config.DefaultConnection, "mqtt", old.MQTT, next.MQTT)
+	for _, name := range sortedKeys(next.Connections) {
+		prefix := "connections." + name
+		if o, ok := old.Connections[name]; ok {
+			d.diffConnection(name, prefix, o, next.Connections[name])
+		} else {
+			d.Restart = append(d.Restart, prefix)
+		}
+	}
+	for _, name := range sortedKeys(old.Connections) {
+		if _, ok := next.Connections[name]; !ok {
+			d.Restart = append(d.Restart, "connections."+name)
+		}
+	}
+	slices.Sort(d.Restart)
+
+	for key, info := range next.Topics {
+		prev, exists := old.Topics[key]
+		switch {
+		case !exists:
+			d.Added = append(d.Added, key)
+		case topicChanged(prev, info):
+			d.Updated = append(d.Updated, key)
+		}
+	}
+	for key := range old.Topics {
+		if _, exists := next.Topics[key]; !exists {
+			d.Removed = append(d.Removed, key)
+		}
+	}
+
+	slices.Sort(d.Added)
+	slices.Sort(d.Removed)
+	slices.Sort(d.Updated)
+	return d
+}
+
+// diffConnection は接続nameの設定oからnへの差分を追加する（prefixは接続の設定キー）
+func (d *ConfigDiff) diffConnection(name, prefix string, o, n config.MQTTConfig) {
+	for _, f := range []struct {
+		key     string
+		changed bool
+	}{
+		{"broker_url", o.BrokerURL != n.BrokerURL},
+		{"client_id", o.ClientID != n.ClientID},
+		{"username", o.Username != n.Username},
+		{"password", o.Password != n.Password},
+		{"use_ssl", o.UseSSL != n.UseSSL},
+		{"ca_cert_path", o.CACertPath != n.CACertPath},
+	} {
+		if f.changed {
+			d.Restart = append(d.Restart, prefix+"."+f.key)
+		}
+	}
+	if o.QoS != n.QoS || o.Retained != n.Retained {
+		d.publish = append(d.publish, name)
+	}
+}
+
+// topicChanged はサブスクリプションまたは公開に影響する項目が変更されたかを返す
+// 説明（Description）の変更は影響しない
+func topicChanged(a, b config.TopicInfo) bool {
+	return subscriptionChanged(a, b) || topicQoS(a) != topicQoS(b) ||
+		a.TopicDirection() != b.TopicDirection() || a.IsEnabled() != b.IsEnabled() ||
+		!equalPtr(a.Retained, b.Retained)
+}
+
+// subscriptionChanged はサブスクライブし直す必要がある項目が変更されたかを返す
+// QoSはSetTopicQoSで変更できるため含まない
+func subscriptionChanged(a, b config.TopicInfo) bool {
+	return a.Name != b.Name || a.Filter != b.Filter || a.Handler != b.Handler ||
+		a.PayloadCodec() != b.PayloadCodec() || a.Schema != b.Schema || connectionName(a) != connectionName(b)
+}
+
+// connectionName はトピックの接続の名前を返す（省略した場合はconfig.DefaultConnection）
+func connectionName(info config.TopicInfo) string {
+	if info.Connection == "" {
+		return config.DefaultConnection
+	}
+	return info.Connection
+}
+
+// equalPtr はどちらもnilか、同じ値を指す場合にtrueを返す
+func equalPtr[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// topicQoS はトピックのQoSを返す（LoadConfigで補完されていない場合は-1）
+func topicQoS(info config.TopicInfo) int {
+	if info.QoS == nil {
+		return -1
+	}
+	return int(*info.QoS)
+}
+
+// ConfigApplier は設定ファイルのトピックをServiceにサブスクライブし、
+// 再読み込みした設定との差分を実行中のServiceに適用する
+//
+// サブスクライブするのは有効（enabled）で direction が subscribe または both のトピックのみで、
+// ハンドラーにはトピックの形式（codec）として不正なペイロードは渡されない
+// 公開用のトピックにはPublishで設定のQoS・保持メッセージ設定・形式に従って公開する
+type ConfigApplier struct {
+	service     *Service     // すべてのトピックに使用するService（connectionsがnilの場合）
+	connections *Connections // トピックの connection ごとのService（Connections.Applierで作成した場合）
+	handler     HandlerResolver
+
+	mu      sync.Mutex
+	current *config.AppConfig       // 適用済みの設定（接続の設定は実行中の値）
+	subs    map[string]subscription // トピックのキーごとに追加したハンドラー
+	failed  map[string]bool         // 前回のApplyで適用に失敗したトピックのキー
+}
+
+// subscription はConfigApplierがトピックのキーごとにServiceへ追加したハンドラー
+// 同じトピック名を他のキーやRouterがサブスクライブしている場合も、このハンドラーのみを解除する
+type subscription struct {
+	service *Service
+	topic   string
+	id      uint64
+}
+
+// NewConfigApplier は設定cfgを適用済みの状態とするConfigApplierを作成
+// トピックの connection にかかわらず、すべてのトピックをserviceにサブスクライブする
+// 接続ごとにServiceを使い分ける場合はConnections.Applierを使用する
+// handlerにはTopicHandlerFuncまたはHandlerRegistryを指定する
+// cfgのトピックをサブスクライブするにはSubscribeAllを呼び出す
+func NewConfigApplier(service *Service, cfg *config.AppConfig, handler HandlerResolver) *ConfigApplier {
+	return &ConfigApplier{
+		service: service,
+		handler: handler,
+		current: cfg,
+		subs:    make(map[string]subscription),
+		failed:  make(map[string]bool),
+	}
+}
+
+// SubscribeAll は現在の設定のすべてのトピックをサブスクライブする
+// 失敗したトピックは次回のApplyでサブスクライブし直す
+func (a *ConfigApplier) SubscribeAll() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var errs []error
+	for _, key := range sortedKeys(a.current.Topics) {
+		if info := a.current.Topics[key]; info.Subscribes() {
+			if err := a.subscribe(key, info); err != nil {
+				a.failed[key] = true
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Apply は設定nextとの差分を実行中のServiceに適用し、差分を返す
+//
+// 追加されたトピックや有効になったトピックをサブスクライブし、
+// 削除されたトピックや無効になったトピックのサブスクリプションを解除する
+// QoSだけが変更されたトピックは同じハンドラーのままサブスクライブし直し、
+// トピック名・フィルター・ハンドラー・形式・スキーマ・接続が変更されたトピックは解除してからサブスクライブする
+// グローバルのQoSとリテイン設定は公開時の設定としてクライアントに反映する
+// 接続に関する設定の変更はdiff.Restartとして返すのみで適用しない
+// 適用しなかった接続の設定は実行中の値のまま保持するため、再起動するまで次回以降の差分にも含まれる
+//
+// 一部の変更に失敗した場合も残りの変更は適用し、すべてのエラーをまとめて返す
+// 失敗したトピックは設定が変わらなくても次回のApplyで解除してからサブスクライブし直し、
+// 差分のUpdated（設定から削除された場合はRemoved）に含める
+func (a *ConfigApplier) Apply(next *config.AppConfig) (ConfigDiff, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	old := a.current
+	diff := DiffConfig(old, next)
+	retry := a.failed
+	a.failed = make(map[string]bool)
+	for _, key := range sortedKeys(retry) {
+		if slices.Contains(diff.Added, key) || slices.Contains(diff.Removed, key) || slices.Contains(diff.Updated, key) {
+			continue
+		}
+		if _, ok := next.Topics[key]; ok {
+			diff.Updated = append(diff.Updated, key)
+		} else {
+			diff.Removed = append(diff.Removed, key)
+		}
+	}
+	slices.Sort(diff.Updated)
+	slices.Sort(diff.Removed)
+
+	var errs []error
+	fail := func(key string, err error) {
+		a.failed[key] = true
+		errs = append(errs, err)
+	}
+
+	for _, key := range diff.Removed {
+		if !old.Topics[key].Subscribes() && !retry[key] {
+			continue
+		}
+		if err := a.unsubscribe(key); err != nil {
+			fail(key, err)
+		}
+	}
+	for _, key := range diff.Updated {
+		prev, info := old.Topics[key], next.Topics[key]
+		if prev.Subscribes() && info.Subscribes() && !subscriptionChanged(prev, info) && !retry[key] {
+			if info.QoS != nil && topicQoS(prev) != topicQoS(info) {
+				service, err := a.serviceFor(key, info)
+				if err == nil {
+					err = service.SetTopicQoS(info.Name, *info.QoS)
+				}
+				if err != nil {
+					fail(key, fmt.Errorf("トピック %s のQoSの変更に失敗: %w", key, err))
+				}
+			}
+			continue
+		}
+		// 前回失敗したトピックは、残っているサブスクリプションを解除してからやり直す
+		if prev.Subscribes() || retry[key] {
+			if err := a.unsubscribe(key); err != nil {
+				fail(key, err)
+				continue
+			}
+		}
+		if info.Subscribes() {
+			if err := a.subscribe(key, info); err != nil {
+				fail(key, err)
+			}
+		}
+	}
+	for _, key := range diff.Added {
+		if info := next.Topics[key]; info.Subscribes() {
+			if err := a.subscribe(key, info); err != nil {
+				fail(key, err)
+			}
+		}
+	}
+	for _, name := range diff.publish {
+		mc, _ := next.Connection(name)
+		service := a.service
+		if a.connections != nil {
+			var ok bool
+			if service, ok = a.connections.Service(name); !ok {
+				continue // 新しい接続は再起動するまで使用しない
+			}
+		} else if name != config.DefaultConnection {
+			continue
+		}
+		service.client.SetQoS(mc.QoS)
+		service.client.SetRetained(mc.Retained)
+	}
+
+	a.current = runningConfig(old, next)
+	return diff, errors.Join(errs...)
+}
+
+// Publish は設定のトピックkeyに、dataをトピックの形式でエンコードして公開する
+// QoSと保持メッセージ設定はトピックの設定（未指定の場合はグローバル設定）に従う
+func (a *ConfigApplier) Publish(key string, data any) error {
+	a.mu.Lock()
+	info, ok := a.current.Topics[key]
+	mc, _ := a.current.Connection(info.Connection)
+	a.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("トピック %s は設定されていません", key)
+	}
+	if !info.Publishes() {
+		return fmt.Errorf("トピック %s は公開用に設定されていません（direction: %s, enabled: %t）", key, info.TopicDirection(), info.IsEnabled())
+	}
+	payload, err := EncodePayload(info.PayloadCodec(), data)
+	if err != nil {
+		return fmt.Errorf("トピック %s のペイロードのエンコードに失敗: %w", key, err)
+	}
+	opts := PublishOptions{QoS: mc.QoS, Retained: mc.Retained}
+	if info.QoS != nil {
+		opts.QoS = *info.QoS
+	}
+	if info.Retained != nil {
+		opts.Retained = *info.Retained
+	}
+	service, err := a.serviceFor(key, info)
+	if err != nil {
+		return err
+	}
+	return service.client.PublishWithOptions(info.Name, payload, opts)
+}
+
+// serviceFor はトピックの接続のServiceを返す
+func (a *ConfigApplier) serviceFor(key string, info config.TopicInfo) (*Service, error) {
+	if a.connections == nil {
+		return a.service, nil
+	}
+	service, ok := a.connections.Service(info.Connection)
+	if !ok {
+		return nil, fmt.Errorf("トピック %s の接続 %s: %w", key, connectionName(info), errNoConnection)
+	}
+	return service, nil
+}
+
+// runningConfig は設定nextのうち、再起動が必要な接続の設定を実行中の値（old）に戻したコピーを返す
+// 公開時のQoSとリテイン設定は適用済みのためnextの値を使う。追加された接続は含めず、削除された接続は残す
+func runningConfig(old, next *config.AppConfig) *config.AppConfig {
+	cfg := *next
+	cfg.MQTT = runningConnection(old.MQTT, next.MQTT)
+	cfg.Connections = nil
+	if old.Connections != nil {
+		cfg.Connections = make(map[string]config.MQTTConfig, len(old.Connections))
+		for name, o := range old.Connections {
+			if n, ok := next.Connections[name]; ok {
+				o = runningConnection(o, n)
+			}
+			cfg.Connections[name] = o
+		}
+	}
+	return &cfg
+}
+
+// runningConnection は実行中の接続の設定oに、実行中に適用できるnの項目を反映した設定を返す
+func runningConnection(o, n config.MQTTConfig) config.MQTTConfig {
+	o.QoS, o.Retained = n.QoS, n.Retained
+	return o
+}
+
+// unsubscribe は設定のトピックkeyが追加したハンドラーを削除する
+// トピックの最後のハンドラーだった場合のみ、ブローカーのサブスクリプションを解除する
+func (a *ConfigApplier) unsubscribe(key string) error {
+	sub, ok := a.subs[key]
+	if !ok {
+		return nil
+	}
+	if err := sub.service.removeSubscriber(sub.topic, sub.id); err != nil {
+		return fmt.Errorf("トピック %s のサブスクリプション解除に失敗: %w", key, err)
+	}
+	delete(a.subs, key)
+	return nil
+}
+
+// subscribe は設定のトピックをフィルターとQoSを指定してサブスクライブする
+// 形式として不正なペイロードはフィルターの前に除外され、フィルターの統計には含まれない
+func (a *ConfigApplier) subscribe(key string, info config.TopicInfo) error {
+	service, err := a.serviceFor(key, info)
+	if err != nil {
+		return err
+	}
+	handler, err := a.handler.Resolve(key, info)
+	if err != nil {
+		return err
+	}
+
+	var filters []Filter
+	if info.Filter != "" {
+		filter, err := ParseFilter(info.Filter)
+		if err != nil {
+			return fmt.Errorf("トピック %s のフィルター設定が不正: %w", key, err)
+		}
+		filters = append(filters, filter)
+	}
+
+	id, err := service.subscribe(info.Name, info.QoS, handler, codecFilter(info.PayloadCodec()), filters)
+	if err != nil {
+		return fmt.Errorf("トピック %s のサブスクライブに失敗: %w", key, err)
+	}
+	a.subs[key] = subscription{service: service, topic: info.Name, id: id}
+	return nil
+}
+
+// sortedKeys はマップのキーを順に返す
+func sortedKeys[V any](m map[string]V) []string {
+	return slices.Sorted(maps.Keys(m))
+}
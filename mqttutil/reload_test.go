@@ -0,0 +1,313 @@
+package mqttutil
+
+import (
+	"errors"
+	"go-mqtt/config"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func qosPtr(q uint8) *uint8 { return &q }
+
+func baseConfig() *config.AppConfig {
+	return &config.AppConfig{
+		MQTT: config.MQTTConfig{BrokerURL: "tcp://localhost:1883", QoS: 1},
+		Topics: map[string]config.TopicInfo{
+			"sensors": {Name: "sensors/data", QoS: qosPtr(1)},
+			"control": {Name: "devices/control", QoS: qosPtr(1)},
+			"logs":    {Name: "system/logs", QoS: qosPtr(0)},
+		},
+	}
+}
+
+func TestDiffConfig(t *testing.T) {
+	old := baseConfig()
+	next := baseConfig()
+	next.MQTT.BrokerURL = "tcp://other:1883"
+	next.MQTT.Password = "changed"
+	delete(next.Topics, "control")
+	next.Topics["alerts"] = config.TopicInfo{Name: "alerts/#", QoS: qosPtr(2)}
+	next.Topics["logs"] = config.TopicInfo{Name: "system/logs", QoS: qosPtr(1)}
+	next.Topics["sensors"] = config.TopicInfo{Name: "sensors/data", QoS: qosPtr(1), Description: "説明のみ変更"}
+
+	d := DiffConfig(old, next)
+	if want := []string{"alerts"}; !slices.Equal(d.Added, want) {
+		t.Errorf("Added = %v、期待値は %v", d.Added, want)
+	}
+	if want := []string{"control"}; !slices.Equal(d.Removed, want) {
+		t.Errorf("Removed = %v、期待値は %v", d.Removed, want)
+	}
+	if want := []string{"logs"}; !slices.Equal(d.Updated, want) {
+		t.Errorf("Updated = %v、期待値は %v", d.Updated, want)
+	}
+	if want := []string{"mqtt.broker_url", "mqtt.password"}; !slices.Equal(d.Restart, want) {
+		t.Errorf("Restart = %v、期待値は %v", d.Restart, want)
+	}
+
+	if d := DiffConfig(old, baseConfig()); !d.Empty() {
+		t.Errorf("同じ設定の差分が空ではありません: %+v", d)
+	}
+	qosOnly := baseConfig()
+	qosOnly.MQTT.QoS = 0
+	if d := DiffConfig(old, qosOnly); d.Empty() {
+		t.Error("グローバルQoSの変更が差分に含まれていません")
+	}
+	// スキーマの参照が変わるとハンドラーを作り直すため再サブスクライブする
+	schema := baseConfig()
+	schema.Topics["sensors"] = config.TopicInfo{Name: "sensors/data", QoS: qosPtr(1), Schema: "schemas/v2.json"}
+	if d := DiffConfig(old, schema); !slices.Equal(d.Updated, []string{"sensors"}) {
+		t.Errorf("スキーマ変更の Updated = %v、期待値は [sensors]", d.Updated)
+	}
+}
+
+func TestConfigApplierApply(t *testing.T) {
+	client := NewMockClient()
+	service := NewService(client)
+
+	var mu sync.Mutex
+	received := make(map[string]int)
+	applier := NewConfigApplier(service, baseConfig(), TopicHandlerFunc(func(key string, _ config.TopicInfo) MessageHandler {
+		return func(_ string, _ []byte) {
+			mu.Lock()
+			received[key]++
+			mu.Unlock()
+		}
+	}))
+	if err := applier.SubscribeAll(); err != nil {
+		t.Fatalf("SubscribeAll() 失敗: %v", err)
+	}
+	if err := service.Start(); err != nil {
+		t.Fatalf("Start() 失敗: %v", err)
+	}
+	defer service.Stop()
+
+	next := baseConfig()
+	next.MQTT.QoS = 2
+	next.MQTT.BrokerURL = "tcp://other:1883"
+	delete(next.Topics, "control")
+	next.Topics["alerts"] = config.TopicInfo{Name: "alerts/#", QoS: qosPtr(2)}
+	next.Topics["logs"] = config.TopicInfo{Name: "system/logs", QoS: qosPtr(1)}
+	next.Topics["sensors"] = config.TopicInfo{Name: "sensors/data", QoS: qosPtr(1), Filter: "value > 50"}
+
+	diff, err := applier.Apply(next)
+	if err != nil {
+		t.Fatalf("Apply() 失敗: %v", err)
+	}
+	if want := []string{"mqtt.broker_url"}; !slices.Equal(diff.Restart, want) {
+		t.Errorf("Restart = %v、期待値は %v", diff.Restart, want)
+	}
+
+	// 削除されたトピックは解除され、追加されたトピックはQoSを指定してサブスクライブされる
+	if _, ok := client.GetSubscriptionQoS("devices/control"); ok {
+		t.Error("削除したトピックのサブスクリプションが残っています")
+	}
+	if qos, ok := client.GetSubscriptionQoS("alerts/#"); !ok || qos != 2 {
+		t.Errorf("alerts/# のQoS = %d (%t)、期待値は 2", qos, ok)
+	}
+	if qos, _ := client.GetSubscriptionQoS("system/logs"); qos != 1 {
+		t.Errorf("system/logs のQoS = %d、期待値は 1", qos)
+	}
+	// グローバルのQoSは公開時の設定として反映される
+	if qos := client.GetQoS(); qos != 2 {
+		t.Errorf("クライアントのQoS = %d、期待値は 2", qos)
+	}
+
+	// 変更したフィルターが適用される
+	client.SimulateMessage("sensors/data", []byte(`{"value": 10}`))
+	client.SimulateMessage("sensors/data", []byte(`{"value": 60}`))
+	client.SimulateMessage("alerts/fire", []byte(`{}`))
+	client.SimulateMessage("system/logs", []byte(`{}`))
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := map[string]int{"sensors": 1, "alerts": 1, "logs": 1}
+	for key, n := range want {
+		if received[key] != n {
+			t.Errorf("%s の受信数 = %d、期待値は %d", key, received[key], n)
+		}
+	}
+	if received["control"] != 0 {
+		t.Errorf("削除したトピックで %d 件受信しました", received["control"])
+	}
+}
+
+func TestConfigApplierInvalidFilter(t *testing.T) {
+	service := NewService(NewMockClient())
+	applier := NewConfigApplier(service, baseConfig(), TopicHandlerFunc(func(string, config.TopicInfo) MessageHandler {
+		return func(string, []byte) {}
+	}))
+
+	next := baseConfig()
+	next.Topics["bad"] = config.TopicInfo{Name: "bad/topic", Filter: "value >"}
+	next.Topics["good"] = config.TopicInfo{Name: "good/topic"}
+
+	diff, err := applier.Apply(next)
+	if err == nil {
+		t.Fatal("不正なフィルターでエラーが返されませんでした")
+	}
+	if want := []string{"bad", "good"}; !slices.Equal(diff.Added, want) {
+		t.Errorf("Added = %v、期待値は %v", diff.Added, want)
+	}
+	// 失敗したトピック以外の変更は適用される
+	status := service.Status()
+	if _, ok := status.Subscriptions["good/topic"]; !ok {
+		t.Error("good/topic がサブスクライブされていません")
+	}
+	if _, ok := status.Subscriptions["bad/topic"]; ok {
+		t.Error("不正なフィルターのトピックがサブスクライブされています")
+	}
+}
+
+func TestConfigApplierSharedTopic(t *testing.T) {
+	client := NewMockClient()
+	service := NewService(client)
+
+	var mu sync.Mutex
+	received := make(map[string]int)
+	record := func(key string) MessageHandler {
+		return func(string, []byte) {
+			mu.Lock()
+			received[key]++
+			mu.Unlock()
+		}
+	}
+	cfg := baseConfig()
+	cfg.Topics["audit"] = config.TopicInfo{Name: "sensors/data", QoS: qosPtr(1)}
+	applier := NewConfigApplier(service, cfg, TopicHandlerFunc(func(key string, _ config.TopicInfo) MessageHandler {
+		return record(key)
+	}))
+	if err := applier.SubscribeAll(); err != nil {
+		t.Fatalf("SubscribeAll() 失敗: %v", err)
+	}
+	// 設定ファイル以外で同じトピックに追加したハンドラー
+	if err := service.Subscribe("system/logs", record("manual")); err != nil {
+		t.Fatalf("Subscribe() 失敗: %v", err)
+	}
+	if err := service.Start(); err != nil {
+		t.Fatalf("Start() 失敗: %v", err)
+	}
+	defer service.Stop()
+
+	// 同じトピック名の他のキーや手動のハンドラーは解除されない
+	next := baseConfig()
+	delete(next.Topics, "sensors")
+	delete(next.Topics, "logs")
+	next.Topics["audit"] = cfg.Topics["audit"]
+	if _, err := applier.Apply(next); err != nil {
+		t.Fatalf("Apply() 失敗: %v", err)
+	}
+	for _, topic := range []string{"sensors/data", "system/logs"} {
+		if _, ok := client.GetSubscriptionQoS(topic); !ok {
+			t.Errorf("%s のサブスクリプションが解除されました", topic)
+		}
+	}
+
+	client.SimulateMessage("sensors/data", []byte(`{}`))
+	client.SimulateMessage("system/logs", []byte(`{}`))
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	for key, n := range map[string]int{"audit": 1, "manual": 1, "sensors": 0, "logs": 0} {
+		if received[key] != n {
+			t.Errorf("%s の受信数 = %d、期待値は %d", key, received[key], n)
+		}
+	}
+	mu.Unlock()
+
+	// 最後のハンドラーを削除するとブローカーのサブスクリプションも解除される
+	last := baseConfig()
+	delete(last.Topics, "sensors")
+	if _, err := applier.Apply(last); err != nil {
+		t.Fatalf("Apply() 失敗: %v", err)
+	}
+	if _, ok := client.GetSubscriptionQoS("sensors/data"); ok {
+		t.Error("sensors/data のサブスクリプションが残っています")
+	}
+}
+
+func TestConfigApplierRetryFailed(t *testing.T) {
+	client := NewMockClient()
+	service := NewService(client)
+	applier := NewConfigApplier(service, baseConfig(), TopicHandlerFunc(func(string, config.TopicInfo) MessageHandler {
+		return func(string, []byte) {}
+	}))
+	if err := applier.SubscribeAll(); err != nil {
+		t.Fatalf("SubscribeAll() 失敗: %v", err)
+	}
+	if err := service.Start(); err != nil {
+		t.Fatalf("Start() 失敗: %v", err)
+	}
+	defer service.Stop()
+
+	// サブスクライブと解除に失敗する
+	next := baseConfig()
+	delete(next.Topics, "logs")
+	next.Topics["alerts"] = config.TopicInfo{Name: "alerts/#", QoS: qosPtr(2)}
+	client.SetSubscribeError(errors.New("subscribe failed"))
+	client.SetUnsubscribeError(errors.New("unsubscribe failed"))
+	if _, err := applier.Apply(next); err == nil {
+		t.Fatal("サブスクライブの失敗でエラーが返されませんでした")
+	}
+	if _, ok := client.GetSubscriptionQoS("alerts/#"); ok {
+		t.Error("失敗したトピックがサブスクライブされています")
+	}
+	if _, ok := client.GetSubscriptionQoS("system/logs"); !ok {
+		t.Error("解除に失敗したトピックのサブスクリプションがありません")
+	}
+
+	// 設定が同じでも、失敗したトピックは次回のApplyで適用し直す
+	client.SetSubscribeError(nil)
+	client.SetUnsubscribeError(nil)
+	diff, err := applier.Apply(next)
+	if err != nil {
+		t.Fatalf("Apply() 失敗: %v", err)
+	}
+	if !slices.Equal(diff.Updated, []string{"alerts"}) || !slices.Equal(diff.Removed, []string{"logs"}) {
+		t.Errorf("Updated = %v, Removed = %v、期待値は [alerts], [logs]", diff.Updated, diff.Removed)
+	}
+	if qos, ok := client.GetSubscriptionQoS("alerts/#"); !ok || qos != 2 {
+		t.Errorf("alerts/# のQoS = %d (%t)、期待値は 2", qos, ok)
+	}
+	if _, ok := client.GetSubscriptionQoS("system/logs"); ok {
+		t.Error("system/logs のサブスクリプションが残っています")
+	}
+
+	// 成功した後は差分に含まれない
+	if diff, err := applier.Apply(next); err != nil || !diff.Empty() {
+		t.Errorf("Apply() = %+v, %v、空の差分を期待", diff, err)
+	}
+}
+
+func TestConfigApplierPendingRestart(t *testing.T) {
+	service := NewService(NewMockClient())
+	applier := NewConfigApplier(service, baseConfig(), TopicHandlerFunc(func(string, config.TopicInfo) MessageHandler {
+		return func(string, []byte) {}
+	}))
+
+	next := baseConfig()
+	next.MQTT.BrokerURL = "tcp://other:1883"
+	next.MQTT.QoS = 2
+	if diff, _ := applier.Apply(next); !slices.Equal(diff.Restart, []string{"mqtt.broker_url"}) {
+		t.Fatalf("Restart = %v、期待値は [mqtt.broker_url]", diff.Restart)
+	}
+
+	// 再起動するまで、適用していない接続の設定の変更は次回以降も報告される
+	again := baseConfig()
+	again.MQTT.BrokerURL = "tcp://other:1883"
+	again.MQTT.QoS = 2
+	diff, _ := applier.Apply(again)
+	if want := []string{"mqtt.broker_url"}; !slices.Equal(diff.Restart, want) {
+		t.Errorf("2回目の Restart = %v、期待値は %v", diff.Restart, want)
+	}
+	// 適用済みのQoSは差分に含まれない
+	if !slices.Equal(diff.publish, nil) {
+		t.Errorf("publish = %v、適用済みのQoSは含まれないことを期待", diff.publish)
+	}
+
+	// 元の値に戻すと再起動は不要になる
+	if diff, _ := applier.Apply(baseConfig()); len(diff.Restart) != 0 {
+		t.Errorf("元に戻した後の Restart = %v", diff.Restart)
+	}
+}
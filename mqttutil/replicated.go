@@ -0,0 +1,388 @@
+package mqttutil
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-mqtt/cache"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReplicationConfig はReplicatedCacheの設定
+type ReplicationConfig struct {
+	Topic            string        // 操作とスナップショットを公開するトピックの接頭辞（例: "replicas/devices"）
+	NodeID           string        // インスタンスの識別子（空の場合はランダムに生成）
+	QoS              byte          // 公開時のQoS（操作の欠落を避けるため1以上を推奨）
+	SnapshotInterval time.Duration // リテインされたスナップショットを公開する間隔（0以下は定期公開しない）
+	TombstoneTTL     time.Duration // 削除したキーの版を保持する期間（0以下はdefaultTombstoneTTL）
+}
+
+// defaultTombstoneTTL は削除したキーの版（トゥームストーン）を保持するデフォルトの期間
+const defaultTombstoneTTL = time.Hour
+
+// ReplicatedCache はSet/Deleteの操作をMQTTで他のインスタンスに複製するキャッシュ
+//
+// 操作は "<Topic>/ops" に公開され、同じトピックを使用するすべてのインスタンスに適用される
+// 競合は操作のタイムスタンプ（同じ場合はノードID）が新しい方を採用する（last-writer-wins）
+// 削除したキーは版を記録した状態（トゥームストーン）で保持し、古い操作による復活を防ぐ
+// トゥームストーンはTombstoneTTLを過ぎると破棄されるため、それより遅れて届いた古い操作ではキーが復活しうる
+// 破棄はスナップショットの作成時（またはPrune）に行い、ローカルから消えたキーの版も同時に破棄する
+//
+// 各インスタンスは "<Topic>/snapshot/<NodeID>" にリテインされたスナップショットを公開する
+// 後から参加したインスタンスはサブスクライブ時に受信するスナップショットから状態を復元する
+// 作成からTombstoneTTLを過ぎたスナップショットは、破棄済みのトゥームストーンで削除したキーを
+// 復活させうるため無視する。SnapshotIntervalはTombstoneTTLより短くすること
+// 終了するインスタンスはCloseでリテインされたスナップショットを削除する
+//
+// 値はJSONでエンコードされるため、TはJSONに変換できる型である必要がある
+// ローカルのキャッシュを直接変更した場合、その変更は複製されない
+type ReplicatedCache[T any] struct {
+	local   *cache.Cache[T]
+	service *Service
+	cfg     ReplicationConfig
+	now     func() time.Time
+
+	mu       sync.Mutex
+	versions map[string]keyVersion // キーごとに最後に適用した操作の版（削除済みのキーを含む）
+	clock    int64                 // 発行または観測した最大のタイムスタンプ
+
+	pubMu  sync.Mutex  // スナップショットの公開とCloseを排他にする
+	closed atomic.Bool // Closeが呼び出されたか
+	subIDs [2]uint64   // 操作とスナップショットのサブスクリプションの識別子
+}
+
+// version は操作の版
+type version struct {
+	Time int64  `json:"ts"`
+	Node string `json:"node"`
+}
+
+// keyVersion はキーに最後に適用した操作の版
+type keyVersion struct {
+	version
+	deleted bool // 削除済み（トゥームストーン）かどうか
+}
+
+// newerThan は版vがoより新しいかを返す
+func (v version) newerThan(o version) bool {
+	if v.Time != o.Time {
+		return v.Time > o.Time
+	}
+	return v.Node > o.Node
+}
+
+// replicationOp はトピックに公開される操作
+type replicationOp struct {
+	Op    string          `json:"op"` // "set" または "delete"
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value,omitempty"`
+	version
+}
+
+// replicationSnapshot はリテインされるスナップショット
+type replicationSnapshot struct {
+	Node    string          `json:"node"`
+	Time    int64           `json:"ts"` // 作成した時刻（UnixNano）
+	Entries []replicationOp `json:"entries"`
+}
+
+const (
+	opSet    = "set"
+	opDelete = "delete"
+)
+
+// NewReplicatedCache はserviceを通じて操作を複製するキャッシュを作成
+// localがnilの場合は新しいキャッシュを作成する
+func NewReplicatedCache[T any](service *Service, local *cache.Cache[T], cfg ReplicationConfig) (*ReplicatedCache[T], error) {
+	if cfg.Topic == "" || strings.ContainsAny(cfg.Topic, "+#") {
+		return nil, fmt.Errorf("複製用のトピック %q が不正です", cfg.Topic)
+	}
+	if strings.ContainsAny(cfg.NodeID, "/+#") {
+		return nil, fmt.Errorf("ノードID %q にトピックの区切り文字やワイルドカードは使用できません", cfg.NodeID)
+	}
+	if cfg.NodeID == "" {
+		cfg.NodeID = rand.Text()
+	}
+	if cfg.TombstoneTTL <= 0 {
+		cfg.TombstoneTTL = defaultTombstoneTTL
+	}
+	if local == nil {
+		local = cache.New[T]()
+	}
+
+	r := &ReplicatedCache[T]{
+		local:    local,
+		service:  service,
+		cfg:      cfg,
+		now:      time.Now,
+		versions: make(map[string]keyVersion),
+	}
+
+	var err error
+	if r.subIDs[0], err = service.subscribe(r.opsTopic(), nil, r.handleOp, nil, nil); err != nil {
+		return nil, err
+	}
+	if r.subIDs[1], err = service.subscribe(r.snapshotFilter(), nil, r.handleSnapshot, nil, nil); err != nil {
+		return nil, err
+	}
+	if cfg.SnapshotInterval > 0 {
+		// Closeの後にスナップショットを公開し直さないよう、Producerの中でPublishSnapshotと同様に公開する
+		if err := service.Schedule(ScheduledPublisher{
+			Topic:    r.snapshotTopic(),
+			Schedule: Every(cfg.SnapshotInterval),
+			Producer: func(context.Context) ([]byte, error) {
+				if err := r.PublishSnapshot(); err != nil && !r.closed.Load() {
+					return nil, err
+				}
+				return nil, ErrSkipPublish
+			},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// NodeID はこのインスタンスの識別子を返す
+func (r *ReplicatedCache[T]) NodeID() string {
+	return r.cfg.NodeID
+}
+
+// Local は複製された値を保持するローカルのキャッシュを返す
+func (r *ReplicatedCache[T]) Local() *cache.Cache[T] {
+	return r.local
+}
+
+// Get はローカルのキャッシュから値を返す
+func (r *ReplicatedCache[T]) Get(key string) (T, bool) {
+	return r.local.Get(key)
+}
+
+// Set は値を保存し、操作を他のインスタンスに公開する
+// 公開に失敗した場合もローカルには保存される
+func (r *ReplicatedCache[T]) Set(key string, val T) error {
+	data, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Errorf("キー %s の値のエンコードに失敗: %w", key, err)
+	}
+
+	r.mu.Lock()
+	op := replicationOp{Op: opSet, Key: key, Value: data, version: r.tick()}
+	r.versions[key] = keyVersion{version: op.version}
+	r.local.Set(key, val)
+	r.mu.Unlock()
+
+	return r.publishOp(op)
+}
+
+// Delete は値を削除し、操作を他のインスタンスに公開する
+// 公開に失敗した場合もローカルからは削除される
+func (r *ReplicatedCache[T]) Delete(key string) error {
+	r.mu.Lock()
+	op := replicationOp{Op: opDelete, Key: key, version: r.tick()}
+	r.versions[key] = keyVersion{version: op.version, deleted: true}
+	r.local.Delete(key)
+	r.mu.Unlock()
+
+	return r.publishOp(op)
+}
+
+// errReplicationClosed はClose後の複製の操作で返されるエラー
+var errReplicationClosed = errors.New("複製は終了しています")
+
+// PublishSnapshot は現在の状態をリテインされたスナップショットとして公開する
+func (r *ReplicatedCache[T]) PublishSnapshot() error {
+	r.pubMu.Lock()
+	defer r.pubMu.Unlock()
+	if r.closed.Load() {
+		return errReplicationClosed
+	}
+
+	payload, err := r.snapshot()
+	if err != nil {
+		return err
+	}
+	return r.service.client.PublishWithOptions(r.snapshotTopic(), payload, PublishOptions{QoS: r.cfg.QoS, Retained: true})
+}
+
+// Close は複製を終了し、リテインされたこのインスタンスのスナップショットを削除する
+// 以降は他のインスタンスの操作を受信せず、Set/Deleteはローカルのキャッシュのみを変更してエラーを返す
+// 削除しないまま終了すると、スナップショットはTombstoneTTLを過ぎるまで新しいインスタンスに適用される
+func (r *ReplicatedCache[T]) Close() error {
+	r.pubMu.Lock()
+	defer r.pubMu.Unlock()
+	if r.closed.Swap(true) {
+		return nil
+	}
+
+	errs := []error{
+		r.service.removeSubscriber(r.opsTopic(), r.subIDs[0]),
+		r.service.removeSubscriber(r.snapshotFilter(), r.subIDs[1]),
+	}
+	// 空のペイロードのリテインメッセージでブローカーが保持するスナップショットを削除する
+	if err := r.service.client.PublishWithOptions(r.snapshotTopic(), nil, PublishOptions{QoS: r.cfg.QoS, Retained: true}); err != nil {
+		errs = append(errs, fmt.Errorf("スナップショットの削除に失敗: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+func (r *ReplicatedCache[T]) opsTopic() string {
+	return r.cfg.Topic + "/ops"
+}
+
+func (r *ReplicatedCache[T]) snapshotFilter() string {
+	return r.cfg.Topic + "/snapshot/+"
+}
+
+func (r *ReplicatedCache[T]) snapshotTopic() string {
+	return r.cfg.Topic + "/snapshot/" + r.cfg.NodeID
+}
+
+// tick はローカルの操作に付ける版を発行する
+// 観測済みのどの版よりも新しくなるように、時計が戻った場合も単調に増加させる
+// ロックが既に取得された状態で呼び出される内部メソッド
+func (r *ReplicatedCache[T]) tick() version {
+	ts := r.now().UnixNano()
+	if ts <= r.clock {
+		ts = r.clock + 1
+	}
+	r.clock = ts
+	return version{Time: ts, Node: r.cfg.NodeID}
+}
+
+// publishOp は操作を公開する
+func (r *ReplicatedCache[T]) publishOp(op replicationOp) error {
+	if r.closed.Load() {
+		return fmt.Errorf("キー %s の操作を複製できません: %w", op.Key, errReplicationClosed)
+	}
+	payload, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+	if err := r.service.client.PublishWithOptions(r.opsTopic(), payload, PublishOptions{QoS: r.cfg.QoS}); err != nil {
+		return fmt.Errorf("キー %s の操作の複製に失敗: %w", op.Key, err)
+	}
+	return nil
+}
+
+// handleOp は受信した操作を適用する
+func (r *ReplicatedCache[T]) handleOp(topic string, payload []byte) {
+	var op replicationOp
+	if err := json.Unmarshal(payload, &op); err != nil {
+		log.Printf("トピック %s の複製操作の解析に失敗: %v", topic, err)
+		return
+	}
+	if err := r.apply(op); err != nil {
+		log.Printf("トピック %s の複製操作の適用に失敗: %v", topic, err)
+	}
+}
+
+// handleSnapshot は受信したスナップショットの各エントリを適用する
+func (r *ReplicatedCache[T]) handleSnapshot(topic string, payload []byte) {
+	// リテインメッセージの削除（空のペイロード）は無視する
+	if len(payload) == 0 {
+		return
+	}
+	var snap replicationSnapshot
+	if err := json.Unmarshal(payload, &snap); err != nil {
+		log.Printf("トピック %s のスナップショットの解析に失敗: %v", topic, err)
+		return
+	}
+	// 破棄済みのトゥームストーンで削除したキーを復活させないよう、古いスナップショットは適用しない
+	if age := time.Duration(r.now().UnixNano() - snap.Time); age > r.cfg.TombstoneTTL {
+		log.Printf("トピック %s のスナップショットは作成から %v 経過しているため無視します", topic, age.Truncate(time.Second))
+		return
+	}
+	for _, op := range snap.Entries {
+		if err := r.apply(op); err != nil {
+			log.Printf("トピック %s のスナップショットの適用に失敗: %v", topic, err)
+		}
+	}
+}
+
+// apply は操作が適用済みの版より新しい場合にローカルのキャッシュへ反映する
+// 自身が公開した操作は既に適用済みのため無視される
+func (r *ReplicatedCache[T]) apply(op replicationOp) error {
+	if op.Key == "" {
+		return errors.New("キーが指定されていません")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.clock = max(r.clock, op.Time)
+	if cur, ok := r.versions[op.Key]; ok && !op.newerThan(cur.version) {
+		return nil
+	}
+
+	switch op.Op {
+	case opSet:
+		var val T
+		if err := json.Unmarshal(op.Value, &val); err != nil {
+			return fmt.Errorf("キー %s の値のデコードに失敗: %w", op.Key, err)
+		}
+		r.local.Set(op.Key, val)
+	case opDelete:
+		r.local.Delete(op.Key)
+	default:
+		return fmt.Errorf("キー %s の操作 %q は不明です", op.Key, op.Op)
+	}
+	r.versions[op.Key] = keyVersion{version: op.version, deleted: op.Op == opDelete}
+	return nil
+}
+
+// Prune は期限を過ぎたトゥームストーンと、有効期限切れなどでローカルから消えたキーの版を破棄する
+// スナップショットの作成時にも行われるため、SnapshotIntervalを指定しない場合に定期的に呼び出す
+func (r *ReplicatedCache[T]) Prune() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pruneLocked()
+}
+
+// pruneLocked はPruneの内部実装
+// ロックが既に取得された状態で呼び出される内部メソッド
+func (r *ReplicatedCache[T]) pruneLocked() {
+	live := make(map[string]bool)
+	for _, key := range r.local.Keys() {
+		live[key] = true
+	}
+	expired := r.now().Add(-r.cfg.TombstoneTTL).UnixNano()
+	for key, v := range r.versions {
+		if (v.deleted && v.Time <= expired) || (!v.deleted && !live[key]) {
+			delete(r.versions, key)
+		}
+	}
+}
+
+// snapshot はローカルの状態と削除済みのキーの版をエンコードする
+// 期限を過ぎたトゥームストーンとローカルから消えたキーの版は破棄し、含めない
+func (r *ReplicatedCache[T]) snapshot() ([]byte, error) {
+	r.mu.Lock()
+	r.pruneLocked()
+	snap := replicationSnapshot{Node: r.cfg.NodeID, Time: r.now().UnixNano(), Entries: make([]replicationOp, 0, len(r.versions))}
+	for key, v := range r.versions {
+		if v.deleted {
+			snap.Entries = append(snap.Entries, replicationOp{Op: opDelete, Key: key, version: v.version})
+			continue
+		}
+		val, ok := r.local.Get(key)
+		if !ok {
+			continue
+		}
+		data, err := json.Marshal(val)
+		if err != nil {
+			r.mu.Unlock()
+			return nil, fmt.Errorf("キー %s の値のエンコードに失敗: %w", key, err)
+		}
+		snap.Entries = append(snap.Entries, replicationOp{Op: opSet, Key: key, Value: data, version: v.version})
+	}
+	r.mu.Unlock()
+
+	return json.Marshal(snap)
+}
@@ -0,0 +1,308 @@
+package mqttutil
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type deviceState struct {
+	Online bool    `json:"online"`
+	Temp   float64 `json:"temp"`
+}
+
+// newReplica はブローカーに接続したサービスと複製キャッシュを作成
+func newReplica(t *testing.T, broker *MockBroker, node string) *ReplicatedCache[deviceState] {
+	t.Helper()
+	return newClockedReplica(t, broker, node, 0, time.Now)
+}
+
+// newClockedReplica はトゥームストーンの保持期間と時刻を指定して複製キャッシュを作成
+// 時刻はリテインされたスナップショットを受信する前に設定する
+func newClockedReplica(t *testing.T, broker *MockBroker, node string, ttl time.Duration, now func() time.Time) *ReplicatedCache[deviceState] {
+	t.Helper()
+	service := NewService(broker.NewClient())
+	r, err := NewReplicatedCache[deviceState](service, nil, ReplicationConfig{
+		Topic:        "replicas/devices",
+		NodeID:       node,
+		QoS:          1,
+		TombstoneTTL: ttl,
+	})
+	if err != nil {
+		t.Fatalf("複製キャッシュの作成に失敗: %v", err)
+	}
+	r.now = now
+	if err := service.Start(); err != nil {
+		t.Fatalf("サービスの開始に失敗: %v", err)
+	}
+	t.Cleanup(service.Stop)
+	return r
+}
+
+// waitFor は条件が成立するまで待つ
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s がタイムアウトしました", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReplicatedCacheSetDelete(t *testing.T) {
+	broker := NewMockBroker()
+	a := newReplica(t, broker, "a")
+	b := newReplica(t, broker, "b")
+
+	if err := a.Set("dev-1", deviceState{Online: true, Temp: 21.5}); err != nil {
+		t.Fatalf("Setに失敗: %v", err)
+	}
+	waitFor(t, "Setの複製", func() bool {
+		v, ok := b.Get("dev-1")
+		return ok && v.Temp == 21.5
+	})
+
+	if err := b.Delete("dev-1"); err != nil {
+		t.Fatalf("Deleteに失敗: %v", err)
+	}
+	waitFor(t, "Deleteの複製", func() bool {
+		_, ok := a.Get("dev-1")
+		return !ok
+	})
+}
+
+func TestReplicatedCacheLastWriterWins(t *testing.T) {
+	r := newReplica(t, NewMockBroker(), "b")
+
+	newer := replicationOp{Op: opSet, Key: "dev-1", Value: []byte(`{"temp":2}`), version: version{Time: 200, Node: "a"}}
+	older := replicationOp{Op: opSet, Key: "dev-1", Value: []byte(`{"temp":1}`), version: version{Time: 100, Node: "c"}}
+
+	// 古い操作が後から届いても上書きしない
+	for _, op := range []replicationOp{newer, older} {
+		if err := r.apply(op); err != nil {
+			t.Fatalf("applyに失敗: %v", err)
+		}
+	}
+	if v, _ := r.Get("dev-1"); v.Temp != 2 {
+		t.Errorf("Temp = %v, 期待値 2", v.Temp)
+	}
+
+	// 同じタイムスタンプではノードIDが大きい方を採用する
+	tie := replicationOp{Op: opSet, Key: "dev-1", Value: []byte(`{"temp":3}`), version: version{Time: 200, Node: "z"}}
+	if err := r.apply(tie); err != nil {
+		t.Fatalf("applyに失敗: %v", err)
+	}
+	if v, _ := r.Get("dev-1"); v.Temp != 3 {
+		t.Errorf("Temp = %v, 期待値 3", v.Temp)
+	}
+
+	// 削除より古いSetでキーが復活しない
+	del := replicationOp{Op: opDelete, Key: "dev-1", version: version{Time: 300, Node: "a"}}
+	stale := replicationOp{Op: opSet, Key: "dev-1", Value: []byte(`{"temp":4}`), version: version{Time: 250, Node: "a"}}
+	for _, op := range []replicationOp{del, stale} {
+		if err := r.apply(op); err != nil {
+			t.Fatalf("applyに失敗: %v", err)
+		}
+	}
+	if _, ok := r.Get("dev-1"); ok {
+		t.Error("削除済みのキーが古い操作で復活しました")
+	}
+
+	// 観測した版より新しい版でローカルの操作が発行される
+	if err := r.Set("dev-1", deviceState{Temp: 5}); err != nil {
+		t.Fatalf("Setに失敗: %v", err)
+	}
+	if v, _ := r.Get("dev-1"); v.Temp != 5 {
+		t.Errorf("Temp = %v, 期待値 5", v.Temp)
+	}
+}
+
+func TestReplicatedCacheBootstrap(t *testing.T) {
+	broker := NewMockBroker()
+	a := newReplica(t, broker, "a")
+
+	if err := a.Set("dev-1", deviceState{Online: true}); err != nil {
+		t.Fatalf("Setに失敗: %v", err)
+	}
+	if err := a.Set("dev-2", deviceState{Temp: 18}); err != nil {
+		t.Fatalf("Setに失敗: %v", err)
+	}
+	if err := a.Delete("dev-2"); err != nil {
+		t.Fatalf("Deleteに失敗: %v", err)
+	}
+	if err := a.PublishSnapshot(); err != nil {
+		t.Fatalf("スナップショットの公開に失敗: %v", err)
+	}
+
+	// 後から参加したインスタンスはリテインされたスナップショットから復元する
+	c := newReplica(t, broker, "c")
+	waitFor(t, "スナップショットからの復元", func() bool {
+		v, ok := c.Get("dev-1")
+		return ok && v.Online
+	})
+	if _, ok := c.Get("dev-2"); ok {
+		t.Error("削除済みのキーがスナップショットから復元されました")
+	}
+
+	// 削除の版も引き継ぐため、それより古い操作は適用されない
+	stale := replicationOp{Op: opSet, Key: "dev-2", Value: []byte(`{"temp":1}`), version: version{Time: 1, Node: "a"}}
+	if err := c.apply(stale); err != nil {
+		t.Fatalf("applyに失敗: %v", err)
+	}
+	if _, ok := c.Get("dev-2"); ok {
+		t.Error("削除済みのキーが古い操作で復活しました")
+	}
+}
+
+func TestReplicatedCacheStaleSnapshot(t *testing.T) {
+	broker := NewMockBroker()
+	var clock atomic.Int64
+	clock.Store(time.Now().UnixNano())
+	now := func() time.Time { return time.Unix(0, clock.Load()) }
+	const ttl = time.Minute
+
+	// a はキーを保持したスナップショットを残したまま、Closeせずに停止する
+	a := newClockedReplica(t, broker, "a", ttl, now)
+	b := newClockedReplica(t, broker, "b", ttl, now)
+	if err := b.Set("dev-1", deviceState{Online: true}); err != nil {
+		t.Fatalf("Setに失敗: %v", err)
+	}
+	waitFor(t, "操作の複製", func() bool { _, ok := a.Get("dev-1"); return ok })
+	if err := a.PublishSnapshot(); err != nil {
+		t.Fatalf("スナップショットの公開に失敗: %v", err)
+	}
+	stale := broker.retainedFor("replicas/devices/snapshot/a")
+	if len(stale) != 1 {
+		t.Fatalf("a のスナップショットがリテインされていません: %v", stale)
+	}
+
+	// b がキーを削除し、トゥームストーンが期限を過ぎて破棄される
+	if err := b.Delete("dev-1"); err != nil {
+		t.Fatalf("Deleteに失敗: %v", err)
+	}
+	if err := b.Set("dev-2", deviceState{Temp: 20}); err != nil {
+		t.Fatalf("Setに失敗: %v", err)
+	}
+	clock.Add(int64(2 * ttl))
+	b.Prune()
+	if _, ok := b.versions["dev-1"]; ok {
+		t.Fatal("期限を過ぎたトゥームストーンが破棄されていません")
+	}
+	if err := b.PublishSnapshot(); err != nil {
+		t.Fatalf("スナップショットの公開に失敗: %v", err)
+	}
+
+	// 新しいインスタンスは b のスナップショットから復元し、古い a のスナップショットは適用しない
+	c := newClockedReplica(t, broker, "c", ttl, now)
+	waitFor(t, "スナップショットからの復元", func() bool { _, ok := c.Get("dev-2"); return ok })
+	c.handleSnapshot(stale[0].topic, stale[0].payload) // 配信順によらず古いスナップショットを確実に適用させる
+	if _, ok := c.Get("dev-1"); ok {
+		t.Error("古いスナップショットで削除済みのキーが復活しました")
+	}
+}
+
+func TestReplicatedCacheClose(t *testing.T) {
+	broker := NewMockBroker()
+	a := newReplica(t, broker, "a")
+	b := newReplica(t, broker, "b")
+	if err := b.PublishSnapshot(); err != nil {
+		t.Fatalf("スナップショットの公開に失敗: %v", err)
+	}
+
+	// Closeはリテインされたスナップショットを削除し、以降は複製しない
+	if err := b.Close(); err != nil {
+		t.Fatalf("Closeに失敗: %v", err)
+	}
+	if msgs := broker.retainedFor("replicas/devices/snapshot/#"); len(msgs) != 0 {
+		t.Errorf("リテインされたスナップショットが残っています: %v", msgs)
+	}
+	if err := b.PublishSnapshot(); err == nil {
+		t.Error("Close後のスナップショットの公開でエラーが返されませんでした")
+	}
+	if err := b.Set("dev-1", deviceState{}); err == nil {
+		t.Error("Close後のSetでエラーが返されませんでした")
+	}
+	if _, ok := b.Get("dev-1"); !ok {
+		t.Error("Close後もローカルのキャッシュには保存されることを期待")
+	}
+	if err := b.Close(); err != nil {
+		t.Errorf("2回目のCloseでエラーが返されました: %v", err)
+	}
+
+	if err := a.Set("dev-2", deviceState{}); err != nil {
+		t.Fatalf("Setに失敗: %v", err)
+	}
+	if err := a.PublishSnapshot(); err != nil {
+		t.Fatalf("スナップショットの公開に失敗: %v", err)
+	}
+	c := newReplica(t, broker, "c")
+	waitFor(t, "スナップショットからの復元", func() bool { _, ok := c.Get("dev-2"); return ok })
+	if _, ok := b.Get("dev-2"); ok {
+		t.Error("Close後に他のインスタンスの操作を受信しました")
+	}
+}
+
+func TestNewReplicatedCacheValidation(t *testing.T) {
+	service := NewService(NewMockClient())
+	for _, cfg := range []ReplicationConfig{
+		{Topic: ""},
+		{Topic: "replicas/#"},
+		{Topic: "replicas", NodeID: "a/b"},
+	} {
+		if _, err := NewReplicatedCache[deviceState](service, nil, cfg); err == nil {
+			t.Errorf("設定 %+v でエラーが返されませんでした", cfg)
+		}
+	}
+
+	r, err := NewReplicatedCache[deviceState](service, nil, ReplicationConfig{Topic: "replicas"})
+	if err != nil {
+		t.Fatalf("複製キャッシュの作成に失敗: %v", err)
+	}
+	if r.NodeID() == "" {
+		t.Error("ノードIDが生成されていません")
+	}
+}
+
+func TestReplicatedCachePrune(t *testing.T) {
+	service := NewService(NewMockBroker().NewClient())
+	r, err := NewReplicatedCache[deviceState](service, nil, ReplicationConfig{
+		Topic:        "replicas/devices",
+		NodeID:       "a",
+		TombstoneTTL: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("複製キャッシュの作成に失敗: %v", err)
+	}
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	r.Set("kept", deviceState{Temp: 1})
+	r.Set("expired", deviceState{Temp: 2})
+	r.Delete("deleted")
+	r.Local().Delete("expired") // ローカルの有効期限切れの代わり
+
+	// 期限内のトゥームストーンは残り、ローカルから消えたキーの版は破棄される
+	r.Prune()
+	if _, ok := r.versions["expired"]; ok {
+		t.Error("ローカルから消えたキーの版が残っています")
+	}
+	if v, ok := r.versions["deleted"]; !ok || !v.deleted {
+		t.Error("期限内のトゥームストーンが破棄されました")
+	}
+
+	// 期限を過ぎたトゥームストーンはスナップショットの作成時に破棄される
+	now = now.Add(2 * time.Minute)
+	data, err := r.snapshot()
+	if err != nil {
+		t.Fatalf("スナップショットの作成に失敗: %v", err)
+	}
+	if len(r.versions) != 1 {
+		t.Errorf("版の数 = %d、期待値は 1（kept のみ）: %v", len(r.versions), r.versions)
+	}
+	if strings.Contains(string(data), "deleted") || !strings.Contains(string(data), "kept") {
+		t.Errorf("スナップショット = %s、kept のみを含むことを期待", data)
+	}
+}
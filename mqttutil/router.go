@@ -0,0 +1,189 @@
+package mqttutil
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Params はトピックパターンから取り出した名前付きパラメータを保持する
+type Params map[string]string
+
+// Get は名前付きパラメータの値を返す（存在しない場合は空文字列）
+func (p Params) Get(name string) string {
+	return p[name]
+}
+
+// RouteHandler はパラメータ付きのメッセージ処理関数のシグネチャを定義
+type RouteHandler func(topic string, params Params, payload []byte)
+
+// Router は名前付きセグメントを含むトピックパターンでハンドラーを登録する
+//
+// パターンの書式:
+//   - {name}    1レベルに一致し、nameとして取り出す（+ に対応）
+//   - {name...} 残りすべてのレベルに一致し、nameとして取り出す（# に対応、末尾のみ）
+//   - + / #     名前なしのワイルドカード
+//
+// 例: "sites/{site}/sensors/{sensor}" は "sites/+/sensors/+" としてサブスクライブされる
+type Router struct {
+	service *Service
+	routes  []*route
+	mu      sync.RWMutex
+}
+
+// route は登録済みのパターンとハンドラー
+type route struct {
+	pattern  string // 登録されたパターン（エラーメッセージに使用）
+	filter   string
+	segments []segment
+	handler  RouteHandler
+}
+
+// segment はパターンの1レベル
+type segment struct {
+	literal string // ワイルドカードでない場合のレベル文字列
+	name    string // 名前付きセグメントの場合のパラメータ名
+	single  bool   // + に対応するセグメント
+	multi   bool   // # に対応するセグメント
+}
+
+// NewRouter は新しいRouterを作成
+func NewRouter(service *Service) *Router {
+	return &Router{
+		service: service,
+	}
+}
+
+// Handle はパターンにハンドラーを登録し、対応するワイルドカードフィルターをサブスクライブ
+func (r *Router) Handle(pattern string, handler RouteHandler) error {
+	rt, err := compilePattern(pattern)
+	if err != nil {
+		return err
+	}
+	rt.handler = handler
+
+	if err := r.service.Subscribe(rt.filter, func(topic string, payload []byte) {
+		params, ok := rt.match(topic)
+		if !ok {
+			return
+		}
+		rt.handler(topic, params, payload)
+	}); err != nil {
+		return fmt.Errorf("パターン %s（%s）のサブスクライブに失敗: %w", rt.pattern, rt.filter, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes = append(r.routes, rt)
+	return nil
+}
+
+// Filters は登録済みパターンに対応するトピックフィルターを登録順に返す
+func (r *Router) Filters() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	filters := make([]string, 0, len(r.routes))
+	for _, rt := range r.routes {
+		filters = append(filters, rt.filter)
+	}
+	return filters
+}
+
+// compilePattern はパターンを解析し、サブスクライブ用のフィルターを組み立てる
+func compilePattern(pattern string) (*route, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("トピックパターンが空です")
+	}
+
+	levels := strings.Split(pattern, "/")
+	segments := make([]segment, 0, len(levels))
+	filterLevels := make([]string, 0, len(levels))
+	names := make(map[string]bool)
+
+	for i, level := range levels {
+		last := i == len(levels)-1
+		var seg segment
+
+		switch {
+		case level == "+":
+			seg.single = true
+		case level == "#":
+			if !last {
+				return nil, fmt.Errorf("パターン %s: # は末尾にのみ指定できます", pattern)
+			}
+			seg.multi = true
+		case strings.HasPrefix(level, "{") && strings.HasSuffix(level, "}"):
+			name := strings.TrimSuffix(strings.TrimPrefix(level, "{"), "}")
+			if strings.HasSuffix(name, "...") {
+				if !last {
+					return nil, fmt.Errorf("パターン %s: {%s} は末尾にのみ指定できます", pattern, name)
+				}
+				name = strings.TrimSuffix(name, "...")
+				seg.multi = true
+			} else {
+				seg.single = true
+			}
+			if name == "" {
+				return nil, fmt.Errorf("パターン %s: パラメータ名が空です", pattern)
+			}
+			if names[name] {
+				return nil, fmt.Errorf("パターン %s: パラメータ名 %s が重複しています", pattern, name)
+			}
+			names[name] = true
+			seg.name = name
+		case strings.ContainsAny(level, "{}+#"):
+			return nil, fmt.Errorf("パターン %s: 不正なレベル %q", pattern, level)
+		default:
+			seg.literal = level
+		}
+
+		segments = append(segments, seg)
+		switch {
+		case seg.multi:
+			filterLevels = append(filterLevels, "#")
+		case seg.single:
+			filterLevels = append(filterLevels, "+")
+		default:
+			filterLevels = append(filterLevels, level)
+		}
+	}
+
+	return &route{
+		pattern:  pattern,
+		filter:   strings.Join(filterLevels, "/"),
+		segments: segments,
+	}, nil
+}
+
+// match はトピックがパターンに一致するかを判定し、名前付きパラメータを取り出す
+func (rt *route) match(topic string) (Params, bool) {
+	levels := strings.Split(topic, "/")
+	params := make(Params)
+
+	for i, seg := range rt.segments {
+		if seg.multi {
+			if seg.name != "" {
+				params[seg.name] = strings.Join(levels[min(i, len(levels)):], "/")
+			}
+			return params, true
+		}
+		if i >= len(levels) {
+			return nil, false
+		}
+		if seg.single {
+			if seg.name != "" {
+				params[seg.name] = levels[i]
+			}
+			continue
+		}
+		if seg.literal != levels[i] {
+			return nil, false
+		}
+	}
+
+	if len(levels) != len(rt.segments) {
+		return nil, false
+	}
+	return params, true
+}
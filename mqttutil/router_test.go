@@ -0,0 +1,135 @@
+package mqttutil
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCompilePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		filter  string
+		wantErr bool
+	}{
+		{"devices/{id}/control", "devices/+/control", false},
+		{"sites/{site}/sensors/{sensor}", "sites/+/sensors/+", false},
+		{"logs/{path...}", "logs/#", false},
+		{"raw/+/data/#", "raw/+/data/#", false},
+		{"static/topic", "static/topic", false},
+		{"", "", true},
+		{"a/{rest...}/b", "", true},
+		{"a/#/b", "", true},
+		{"a/{}", "", true},
+		{"a/{id}/{id}", "", true},
+		{"a/x{id}", "", true},
+	}
+
+	for _, tt := range tests {
+		rt, err := compilePattern(tt.pattern)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("compilePattern(%q) がエラーを返さなかった", tt.pattern)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("compilePattern(%q) 失敗: %v", tt.pattern, err)
+			continue
+		}
+		if rt.filter != tt.filter {
+			t.Errorf("compilePattern(%q).filter = %s、期待値は %s", tt.pattern, rt.filter, tt.filter)
+		}
+	}
+}
+
+func TestRouteMatch(t *testing.T) {
+	rt, err := compilePattern("sites/{site}/sensors/{sensor}")
+	if err != nil {
+		t.Fatalf("compilePattern() 失敗: %v", err)
+	}
+
+	params, ok := rt.match("sites/plant-a/sensors/temp-1")
+	if !ok {
+		t.Fatal("一致するトピックが一致しなかった")
+	}
+	if params.Get("site") != "plant-a" || params.Get("sensor") != "temp-1" {
+		t.Errorf("params = %v、期待値は site=plant-a sensor=temp-1", params)
+	}
+
+	if _, ok := rt.match("sites/plant-a/sensors"); ok {
+		t.Error("レベル数の異なるトピックが一致した")
+	}
+	if _, ok := rt.match("sites/plant-a/devices/temp-1"); ok {
+		t.Error("リテラルの異なるトピックが一致した")
+	}
+
+	rest, err := compilePattern("logs/{path...}")
+	if err != nil {
+		t.Fatalf("compilePattern() 失敗: %v", err)
+	}
+	params, ok = rest.match("logs/app/error/db")
+	if !ok || params.Get("path") != "app/error/db" {
+		t.Errorf("params = %v, %t、期待値は path=app/error/db", params, ok)
+	}
+}
+
+func TestRouterHandle(t *testing.T) {
+	client := NewMockClient()
+	service := NewService(client)
+	router := NewRouter(service)
+
+	if err := client.Connect(); err != nil {
+		t.Fatalf("Connect() 失敗: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var gotTopic string
+	var gotParams Params
+	err := router.Handle("devices/{id}/control", func(topic string, params Params, _ []byte) {
+		gotTopic = topic
+		gotParams = params
+		wg.Done()
+	})
+	if err != nil {
+		t.Fatalf("Handle() 失敗: %v", err)
+	}
+
+	if filters := router.Filters(); len(filters) != 1 || filters[0] != "devices/+/control" {
+		t.Errorf("Filters() = %v、期待値は [devices/+/control]", filters)
+	}
+
+	client.SimulateMessage("devices/dev-42/control", []byte(`{"cmd":"on"}`))
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("ルートハンドラーが呼び出されるのを待機してタイムアウト")
+	}
+
+	if gotTopic != "devices/dev-42/control" {
+		t.Errorf("topic = %s、期待値は devices/dev-42/control", gotTopic)
+	}
+	if gotParams.Get("id") != "dev-42" {
+		t.Errorf("id = %s、期待値は dev-42", gotParams.Get("id"))
+	}
+
+	if err := router.Handle("bad/{x...}/pattern", func(string, Params, []byte) {}); err == nil {
+		t.Error("不正なパターンでHandle()がエラーを返さなかった")
+	}
+
+	// サブスクライブのエラーには登録したパターンが含まれる
+	client.SetSubscribeError(errors.New("拒否されました"))
+	err = router.Handle("sites/{site}/alerts", func(string, Params, []byte) {})
+	if err == nil || !strings.Contains(err.Error(), "sites/{site}/alerts") {
+		t.Errorf("サブスクライブ失敗時のエラー = %v、パターンを含むことを期待", err)
+	}
+}
@@ -0,0 +1,325 @@
+package mqttutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule は定期公開の実行時刻を決める
+type Schedule interface {
+	// Next は時刻tより後の次の実行時刻を返す
+	// ゼロ値を返した場合、以降は実行しない
+	Next(t time.Time) time.Time
+}
+
+// Producer は公開するペイロードを生成する関数
+// ctxはService.Stopでキャンセルされるため、長時間かかる処理はctxに従うこと
+// Stopは実行中のProducerの終了を待つため、ctxに従わないProducerがあるとStopは戻らない
+// 待機する時間を制限する場合はStopContextを使用する
+// ErrSkipPublishを返した場合、その回は公開しない
+type Producer func(ctx context.Context) ([]byte, error)
+
+// ErrSkipPublish はProducerがその回の公開を行わないことを示すエラー（ログにも出力しない）
+var ErrSkipPublish = errors.New("公開をスキップします")
+
+// ScheduledPublisher はServiceが管理する定期公開の設定
+type ScheduledPublisher struct {
+	Topic    string
+	Schedule Schedule
+	Jitter   time.Duration // 各実行時刻に加える0〜Jitterのランダムな遅延
+	Producer Producer
+	Options  *PublishOptions // nilの場合はクライアントのQoSとリテイン設定で公開
+}
+
+// Schedule は定期公開を登録する
+// Serviceが開始済みであればすぐに、そうでなければStart時に実行を開始し、Stopで停止する
+// 停止したServiceには登録できない
+func (s *Service) Schedule(p ScheduledPublisher) error {
+	if p.Topic == "" {
+		return errors.New("定期公開のトピックが指定されていません")
+	}
+	if p.Schedule == nil {
+		return fmt.Errorf("トピック %s の定期公開にスケジュールが指定されていません", p.Topic)
+	}
+	if p.Producer == nil {
+		return fmt.Errorf("トピック %s の定期公開にProducerが指定されていません", p.Topic)
+	}
+	if p.Jitter < 0 {
+		return fmt.Errorf("トピック %s の定期公開のJitterが負の値です", p.Topic)
+	}
+	if s, ok := p.Schedule.(intervalSchedule); ok && s.interval <= 0 {
+		return fmt.Errorf("トピック %s の定期公開の間隔 %v は正の値を指定してください", p.Topic, s.interval)
+	}
+
+	s.schedMu.Lock()
+	defer s.schedMu.Unlock()
+
+	if s.ctx.Err() != nil {
+		return fmt.Errorf("トピック %s の定期公開を登録できません: サービスは停止しています", p.Topic)
+	}
+	s.publishers = append(s.publishers, p)
+	if s.started {
+		s.wg.Add(1)
+		go s.runPublisher(p)
+	}
+	return nil
+}
+
+// startPublishers は登録済みの定期公開を開始する
+func (s *Service) startPublishers() {
+	s.schedMu.Lock()
+	defer s.schedMu.Unlock()
+
+	if s.started || s.ctx.Err() != nil {
+		return
+	}
+	s.started = true
+	for _, p := range s.publishers {
+		s.wg.Add(1)
+		go s.runPublisher(p)
+	}
+}
+
+// runPublisher はサービスが停止するまでスケジュールに従って公開を繰り返す
+func (s *Service) runPublisher(p ScheduledPublisher) {
+	defer s.wg.Done()
+
+	prev := time.Now()
+	for {
+		next := p.Schedule.Next(prev)
+		// 処理が遅れて実行時刻を過ぎた場合は現在時刻から次の実行時刻を求める
+		if now := time.Now(); next.Before(now) {
+			next = p.Schedule.Next(now)
+		}
+		if next.IsZero() {
+			log.Printf("トピック %s の定期公開は次の実行時刻がないため終了します", p.Topic)
+			return
+		}
+		prev = next
+
+		delay := time.Until(next)
+		if p.Jitter > 0 {
+			delay += time.Duration(rand.Int64N(int64(p.Jitter)))
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.after(delay):
+		}
+
+		payload, err := p.Producer(s.ctx)
+		if err != nil {
+			if s.ctx.Err() != nil {
+				return
+			}
+			if errors.Is(err, ErrSkipPublish) {
+				continue
+			}
+			log.Printf("トピック %s の定期公開でペイロードの生成に失敗: %v", p.Topic, err)
+			continue
+		}
+		if p.Options != nil {
+			err = s.client.PublishWithOptions(p.Topic, payload, *p.Options)
+		} else {
+			err = s.client.Publish(p.Topic, payload)
+		}
+		if err != nil {
+			log.Printf("トピック %s の定期公開に失敗: %v", p.Topic, err)
+		}
+	}
+}
+
+// intervalSchedule は一定間隔のスケジュール
+type intervalSchedule struct {
+	interval time.Duration
+}
+
+// Every は一定間隔で実行するスケジュールを返す
+// intervalが0以下の場合、Service.Scheduleはエラーを返す（Nextはゼロ値を返し実行しない）
+func Every(interval time.Duration) Schedule {
+	return intervalSchedule{interval: interval}
+}
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	if s.interval <= 0 {
+		return time.Time{}
+	}
+	return t.Add(s.interval)
+}
+
+// cronSchedule はcron形式（分 時 日 月 曜日）のスケジュール
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64 // 各フィールドで許可される値のビットセット
+	domAny, dowAny                bool   // 日・曜日が * （*/n を含む）で指定されたかどうか
+}
+
+// cronField は各フィールドの値の範囲
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"分", 0, 59},
+	{"時", 0, 23},
+	{"日", 1, 31},
+	{"月", 1, 12},
+	{"曜日", 0, 6},
+}
+
+// ParseCron はcron形式のスケジュールを解析する
+//
+// 5つのフィールド（分 時 日 月 曜日）に *, */n, a-b, a-b/n, a,b を指定できる
+// 曜日は0（日曜）〜6（土曜）で、7も日曜として扱う
+// "@hourly", "@daily", "@weekly", "@monthly", "@yearly" と "@every <間隔>" も使用できる
+func ParseCron(expr string) (Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if rest, ok := strings.CutPrefix(expr, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("スケジュール %q の間隔が不正です", expr)
+		}
+		return Every(d), nil
+	}
+	switch expr {
+	case "@hourly":
+		expr = "0 * * * *"
+	case "@daily":
+		expr = "0 0 * * *"
+	case "@weekly":
+		expr = "0 0 * * 0"
+	case "@monthly":
+		expr = "0 0 1 * *"
+	case "@yearly":
+		expr = "0 0 1 1 *"
+	}
+
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("スケジュール %q のフィールド数が不正です（%d個、期待値は5個）", expr, len(parts))
+	}
+
+	var bits [5]uint64
+	for i, part := range parts {
+		f := cronFields[i]
+		if i == 4 {
+			// 曜日の7は日曜として扱うため範囲を広げて解析する
+			f.max = 7
+		}
+		b, err := parseCronField(part, f)
+		if err != nil {
+			return nil, fmt.Errorf("スケジュール %q: %w", expr, err)
+		}
+		bits[i] = b
+	}
+	if bits[4]&(1<<7) != 0 {
+		bits[4] = bits[4]&^(1<<7) | 1
+	}
+
+	return &cronSchedule{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		domAny: strings.HasPrefix(parts[2], "*"),
+		dowAny: strings.HasPrefix(parts[4], "*"),
+	}, nil
+}
+
+// parseCronField はcronの1フィールドを許可される値のビットセットに変換する
+func parseCronField(field string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%sフィールドの間隔 %q が不正です", f.name, stepPart)
+			}
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			a, b, _ := strings.Cut(rangePart, "-")
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(a)
+			hi, err2 = strconv.Atoi(b)
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("%sフィールドの範囲 %q が不正です", f.name, rangePart)
+			}
+		default:
+			n, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, fmt.Errorf("%sフィールドの値 %q が不正です", f.name, rangePart)
+			}
+			lo = n
+			if !hasStep {
+				hi = n
+			}
+		}
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("%sフィールドの値 %q が範囲外です（%d〜%d）", f.name, item, f.min, f.max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// cronSearchLimit は次の実行時刻を探索する上限（これを超えると一致する時刻がないとみなす）
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	// 次の分の0秒から探索する
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronSearchLimit)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+
+	// 一致する時刻がない（例: 2月30日）場合は実行しない
+	return time.Time{}
+}
+
+// dayMatches は日と曜日の条件を判定する
+// 両方が指定された場合はcronの慣例に従いどちらかに一致すればよい
+// * で始まるフィールド（*/2 など）は指定されていないものとして扱い、両方に一致する必要がある
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	domOK := s.dom&(1<<uint(t.Day())) != 0
+	dowOK := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return domOK && dowOK
+	}
+	return domOK || dowOK
+}
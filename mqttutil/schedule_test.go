@@ -0,0 +1,277 @@
+package mqttutil
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	base := time.Date(2025, 1, 15, 10, 7, 30, 0, time.UTC) // 水曜日
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2025, 1, 15, 10, 8, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2025, 1, 15, 10, 15, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2025, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"30 9 * * *", time.Date(2025, 1, 16, 9, 30, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 * * 1-5", time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)},
+		{"0 12 * * 0", time.Date(2025, 1, 19, 12, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2025, 1, 19, 12, 0, 0, 0, time.UTC)},
+		{"0 0 1,20 3 *", time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 20 * 6", time.Date(2025, 1, 18, 0, 0, 0, 0, time.UTC)},   // 日と曜日のどちらか
+		{"0 0 */2 * 1", time.Date(2025, 1, 27, 0, 0, 0, 0, time.UTC)},  // * で始まる日は曜日と両方
+		{"0 0 13 * */2", time.Date(2025, 2, 13, 0, 0, 0, 0, time.UTC)}, // * で始まる曜日は日と両方
+		{"@daily", time.Date(2025, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", base.Add(90 * time.Second)},
+	}
+
+	for _, tt := range tests {
+		s, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q) 失敗: %v", tt.expr, err)
+			continue
+		}
+		if got := s.Next(base); !got.Equal(tt.want) {
+			t.Errorf("ParseCron(%q).Next() = %v、期待値は %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	exprs := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@every -1s",
+		"@every soon",
+	}
+	for _, expr := range exprs {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) がエラーを返さなかった", expr)
+		}
+	}
+}
+
+func TestParseCronImpossible(t *testing.T) {
+	s, err := ParseCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("ParseCron() 失敗: %v", err)
+	}
+	if next := s.Next(time.Now()); !next.IsZero() {
+		t.Errorf("2月30日のNext() = %v、期待値はゼロ値", next)
+	}
+}
+
+// manualTimer は定期公開の待機をテストから進めるためのService.afterの代わり
+type manualTimer struct {
+	waits chan chan time.Time
+}
+
+func newManualTimer(s *Service) *manualTimer {
+	m := &manualTimer{waits: make(chan chan time.Time, 10)}
+	s.after = func(time.Duration) <-chan time.Time {
+		c := make(chan time.Time, 1)
+		m.waits <- c
+		return c
+	}
+	return m
+}
+
+// next は定期公開が次の実行時刻を待ち始めるまで待ち、その待機を返す
+func (m *manualTimer) next(t *testing.T) chan time.Time {
+	t.Helper()
+	select {
+	case c := <-m.waits:
+		return c
+	case <-time.After(time.Second):
+		t.Fatal("定期公開が待機を開始しませんでした")
+		return nil
+	}
+}
+
+// fire は次の実行時刻に進める
+func (m *manualTimer) fire(t *testing.T) {
+	t.Helper()
+	m.next(t) <- time.Now()
+}
+
+// receive はchから1件受信する
+func receive[T any](t *testing.T, ch <-chan T, what string) T {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(time.Second):
+		t.Fatalf("%s がタイムアウトしました", what)
+		var zero T
+		return zero
+	}
+}
+
+func TestServiceSchedule(t *testing.T) {
+	client := NewMockClient()
+	service := NewService(client)
+	timer := newManualTimer(service)
+
+	calls := make(chan struct{}, 10)
+	err := service.Schedule(ScheduledPublisher{
+		Topic:    "heartbeat",
+		Schedule: Every(10 * time.Millisecond),
+		Jitter:   5 * time.Millisecond,
+		Producer: func(_ context.Context) ([]byte, error) {
+			calls <- struct{}{}
+			return []byte("alive"), nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Schedule() 失敗: %v", err)
+	}
+
+	// Start前は実行されない
+	select {
+	case <-timer.waits:
+		t.Fatal("Start前に定期公開が開始されました")
+	default:
+	}
+
+	if err := service.Start(); err != nil {
+		t.Fatalf("Start() 失敗: %v", err)
+	}
+	for range 3 {
+		timer.fire(t)
+		receive(t, calls, "Producerの呼び出し")
+	}
+	// 公開の後に次の実行時刻を待ち始める
+	pending := timer.next(t)
+	if msg := client.GetLastPublishedMessage("heartbeat"); string(msg) != "alive" {
+		t.Errorf("公開されたメッセージ = %s、期待値は alive", string(msg))
+	}
+
+	// Stopは定期公開の終了を待ち、Stop後は実行されない
+	service.Stop()
+	pending <- time.Now()
+	select {
+	case <-calls:
+		t.Error("Stop後にProducerが呼び出されました")
+	default:
+	}
+
+	// 停止したServiceには登録できない
+	err = service.Schedule(ScheduledPublisher{Topic: "late", Schedule: Every(time.Second), Producer: func(context.Context) ([]byte, error) { return nil, nil }})
+	if err == nil {
+		t.Error("Stop後のSchedule() がエラーを返さなかった")
+	}
+}
+
+func TestServiceScheduleProducerError(t *testing.T) {
+	client := NewMockClient()
+	service := NewService(client)
+	timer := newManualTimer(service)
+	if err := service.Start(); err != nil {
+		t.Fatalf("Start() 失敗: %v", err)
+	}
+	defer service.Stop()
+
+	// 開始後に登録した定期公開もすぐに実行される
+	var calls atomic.Int32
+	err := service.Schedule(ScheduledPublisher{
+		Topic:    "telemetry",
+		Schedule: Every(5 * time.Millisecond),
+		Producer: func(_ context.Context) ([]byte, error) {
+			switch calls.Add(1) {
+			case 1:
+				return nil, errors.New("生成エラー")
+			case 2:
+				return nil, ErrSkipPublish
+			}
+			return []byte("ok"), nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Schedule() 失敗: %v", err)
+	}
+
+	// 生成エラーとスキップでは公開せず、次の実行時刻に進む
+	for range 2 {
+		timer.fire(t)
+	}
+	third := timer.next(t) // 2回目の実行の完了を待つ
+	if msg := client.GetLastPublishedMessage("telemetry"); msg != nil {
+		t.Errorf("生成エラーまたはスキップで公開されました: %s", msg)
+	}
+	third <- time.Now()
+	timer.next(t) // 3回目の公開の完了を待つ
+	if msg := client.GetLastPublishedMessage("telemetry"); string(msg) != "ok" {
+		t.Errorf("生成エラー後の公開メッセージ = %s、期待値は ok", string(msg))
+	}
+}
+
+func TestServiceScheduleValidation(t *testing.T) {
+	service := NewService(NewMockClient())
+	producer := func(_ context.Context) ([]byte, error) { return nil, nil }
+
+	invalid := []ScheduledPublisher{
+		{Schedule: Every(time.Second), Producer: producer},
+		{Topic: "t", Producer: producer},
+		{Topic: "t", Schedule: Every(time.Second)},
+		{Topic: "t", Schedule: Every(time.Second), Producer: producer, Jitter: -time.Second},
+		{Topic: "t", Schedule: Every(0), Producer: producer},
+		{Topic: "t", Schedule: Every(-time.Second), Producer: producer},
+	}
+	for i, p := range invalid {
+		if err := service.Schedule(p); err == nil {
+			t.Errorf("invalid[%d]: Schedule() がエラーを返さなかった", i)
+		}
+	}
+}
+
+func TestServiceStopContext(t *testing.T) {
+	client := NewMockClient()
+	service := NewService(client)
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+
+	// ctxに従わないProducer
+	err := service.Schedule(ScheduledPublisher{
+		Topic:    "stuck",
+		Schedule: Every(time.Millisecond),
+		Producer: func(context.Context) ([]byte, error) {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-release
+			return nil, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Schedule() 失敗: %v", err)
+	}
+	if err := service.Start(); err != nil {
+		t.Fatalf("Start() 失敗: %v", err)
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := service.StopContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("StopContext() = %v、期待値は %v", err, context.DeadlineExceeded)
+	}
+	if client.IsConnected() {
+		t.Error("待機を打ち切った後も接続が切断されていません")
+	}
+}
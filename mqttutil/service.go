@@ -3,28 +3,100 @@ package mqttutil
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"go-mqtt/cache"
 	"log"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Service は高レベルのMQTTサービスを表す
 type Service struct {
 	client    Client
-	handlers  map[string][]MessageHandler
+	handlers  map[string][]subscriber
+	stats     map[string]*topicStats
+	qos       map[string]byte // トピックごとのサブスクライブQoS（ない場合はクライアントの設定）
 	mu        sync.RWMutex
 	ctx       context.Context
 	cancelCtx context.CancelFunc
+	dedup     *Deduplicator
+	inflight  atomic.Int64 // 実行中のハンドラー数
+	nextID    uint64       // subscriberに割り当てる識別子
+
+	// トピックごとの最後のメッセージ（lastvalue.go）
+	lastValues cache.CacheInterface[Message]
+
+	// 定期公開（schedule.go）
+	schedMu    sync.Mutex
+	publishers []ScheduledPublisher
+	started    bool
+	wg         sync.WaitGroup
+	after      func(time.Duration) <-chan time.Time // 実行時刻までの待機（テストで置き換える）
+}
+
+// subscriber はハンドラーとそのハンドラー専用のフィルター
+type subscriber struct {
+	id      uint64
+	handler MessageHandler
+	codec   Filter // ペイロードの形式の確認（binding.go）。フィルターの統計には含めない
+	filters []Filter
+}
+
+// accepts はメッセージがすべてのフィルターを通過するかを返す
+func (sub subscriber) accepts(topic string, payload []byte) bool {
+	for _, f := range sub.filters {
+		if !f(topic, payload) {
+			return false
+		}
+	}
+	return true
+}
+
+// topicStats はサブスクリプションごとの統計カウンター
+type topicStats struct {
+	messages      atomic.Uint64
+	lastMessage   atomic.Int64 // 最終受信時刻（UnixNano）
+	filterHits    atomic.Uint64
+	filterMisses  atomic.Uint64
+	codecErrors   atomic.Uint64
+	handlerErrors atomic.Uint64
+}
+
+// FilterStats はフィルターの通過（Hits）と破棄（Misses）の件数
+// フィルターを持つハンドラーごとに1件として数える
+type FilterStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// ServiceOption はServiceのオプション設定を行う関数
+type ServiceOption func(*Service)
+
+// WithDeduplicator は受信メッセージの重複排除を有効にする
+func WithDeduplicator(d *Deduplicator) ServiceOption {
+	return func(s *Service) {
+		s.dedup = d
+	}
 }
 
 // NewService は新しいMQTTサービスを作成
-func NewService(client Client) *Service {
+func NewService(client Client, opts ...ServiceOption) *Service {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Service{
+	s := &Service{
 		client:    client,
-		handlers:  make(map[string][]MessageHandler),
+		handlers:  make(map[string][]subscriber),
+		stats:     make(map[string]*topicStats),
+		qos:       make(map[string]byte),
 		ctx:       ctx,
 		cancelCtx: cancel,
+		after:     time.After,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
 // Start はMQTTブローカーに接続しすべてのトピックをサブスクライブ
@@ -35,6 +107,18 @@ func (s *Service) Start() error {
 	}
 
 	// 登録されたトピックをサブスクライブ
+	if err := s.subscribeAll(); err != nil {
+		return err
+	}
+
+	// 登録された定期公開を開始
+	s.startPublishers()
+
+	return nil
+}
+
+// subscribeAll は登録されたすべてのトピックをサブスクライブ
+func (s *Service) subscribeAll() error {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
@@ -47,10 +131,34 @@ func (s *Service) Start() error {
 	return nil
 }
 
-// Stop はMQTTブローカーとの接続を切断
+// Stop は定期公開を停止し、MQTTブローカーとの接続を切断
+// 実行中の定期公開のProducerが終了するまで待つ
 func (s *Service) Stop() {
+	s.StopContext(context.Background())
+}
+
+// StopContext はStopと同様に停止するが、定期公開の終了を待つのはctxが終了するまでとする
+// 待機を打ち切った場合も接続は切断し、ctxのエラーを返す
+func (s *Service) StopContext(ctx context.Context) error {
+	// Scheduleと排他にし、Wait中に定期公開が追加されないようにする
+	s.schedMu.Lock()
 	s.cancelCtx()
+	s.schedMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
 	s.client.Disconnect()
+	return err
 }
 
 // PublishJSON はJSONエンコードされたメッセージをトピックに公開
@@ -63,54 +171,206 @@ func (s *Service) PublishJSON(topic string, data any) error {
 }
 
 // Subscribe はトピックにメッセージハンドラーを追加
-func (s *Service) Subscribe(topic string, handler MessageHandler) error {
+// filtersを指定した場合、すべてのフィルターを通過したメッセージのみがハンドラーに渡される
+func (s *Service) Subscribe(topic string, handler MessageHandler, filters ...Filter) error {
+	_, err := s.subscribe(topic, nil, handler, nil, filters)
+	return err
+}
+
+// SubscribeWithQoS はクライアントの設定の代わりにqosでトピックをサブスクライブし、メッセージハンドラーを追加
+// 既にサブスクライブしているトピックでは、SetTopicQoSと同様にQoSを変更する
+func (s *Service) SubscribeWithQoS(topic string, qos byte, handler MessageHandler, filters ...Filter) error {
+	_, err := s.subscribe(topic, &qos, handler, nil, filters)
+	return err
+}
+
+// subscribe はハンドラーを追加し、removeSubscriberで個別に削除するための識別子を返す
+// codecがnilでない場合、codecを通過しないメッセージはフィルターの前に破棄し、形式エラーとして数える
+func (s *Service) subscribe(topic string, qos *byte, handler MessageHandler, codec Filter, filters []Filter) (uint64, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	// ハンドラーを内部マップに追加
 	if _, exists := s.handlers[topic]; !exists {
-		s.handlers[topic] = []MessageHandler{}
+		s.handlers[topic] = []subscriber{}
+		s.stats[topic] = &topicStats{}
+		if qos != nil {
+			s.qos[topic] = *qos
+		}
 
 		// クライアントが既に接続されている場合、トピックをサブスクライブ
+		// 失敗した場合は登録を取り消し、次回の呼び出しで再度サブスクライブする
 		if s.client.IsConnected() {
 			if err := s.subscribeTopic(topic); err != nil {
-				return err
+				delete(s.handlers, topic)
+				delete(s.stats, topic)
+				delete(s.qos, topic)
+				return 0, err
 			}
 		}
+	} else if qos != nil {
+		if err := s.setTopicQoSLocked(topic, *qos); err != nil {
+			return 0, err
+		}
 	}
 
-	s.handlers[topic] = append(s.handlers[topic], handler)
+	s.nextID++
+	s.handlers[topic] = append(s.handlers[topic], subscriber{id: s.nextID, handler: handler, codec: codec, filters: filters})
+	return s.nextID, nil
+}
+
+// SetTopicQoS はサブスクライブ済みのトピックのQoSを変更する
+// クライアントが接続されている場合は、新しいQoSでサブスクライブし直す
+func (s *Service) SetTopicQoS(topic string, qos byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.handlers[topic]; !exists {
+		return fmt.Errorf("トピック %s はサブスクライブされていません", topic)
+	}
+	return s.setTopicQoSLocked(topic, qos)
+}
+
+// setTopicQoSLocked はトピックのQoSを変更し、必要に応じてサブスクライブし直す
+// ロックが既に取得された状態で呼び出される内部メソッド
+func (s *Service) setTopicQoSLocked(topic string, qos byte) error {
+	if cur, ok := s.qos[topic]; ok && cur == qos {
+		return nil
+	}
+	s.qos[topic] = qos
+	if s.client.IsConnected() {
+		return s.subscribeTopic(topic)
+	}
+	return nil
+}
+
+// Unsubscribe はトピックのすべてのハンドラーを削除し、サブスクリプションを解除する
+// サブスクライブされていないトピックでは何もしない
+func (s *Service) Unsubscribe(topic string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.handlers[topic]; !exists {
+		return nil
+	}
+	if s.client.IsConnected() {
+		if err := s.client.Unsubscribe(topic); err != nil {
+			return err
+		}
+	}
+	delete(s.handlers, topic)
+	delete(s.stats, topic)
+	delete(s.qos, topic)
+	return nil
+}
+
+// removeSubscriber はsubscribeで追加した識別子idのハンドラーのみを削除する
+// トピックの最後のハンドラーを削除した場合はサブスクリプションを解除する
+func (s *Service) removeSubscriber(topic string, id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	subs, exists := s.handlers[topic]
+	if !exists {
+		return nil
+	}
+	match := func(sub subscriber) bool { return sub.id == id }
+	if !slices.ContainsFunc(subs, match) {
+		return nil
+	}
+	if len(subs) > 1 {
+		s.handlers[topic] = slices.DeleteFunc(subs, match)
+		return nil
+	}
+	// 解除に失敗した場合はハンドラーを残し、次回の呼び出しで再度解除する
+	if s.client.IsConnected() {
+		if err := s.client.Unsubscribe(topic); err != nil {
+			return err
+		}
+	}
+	delete(s.handlers, topic)
+	delete(s.stats, topic)
+	delete(s.qos, topic)
 	return nil
 }
 
+// FilterStats はトピックのサブスクリプションにおけるフィルターの通過・破棄件数を返す
+func (s *Service) FilterStats(topic string) FilterStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st, exists := s.stats[topic]
+	if !exists {
+		return FilterStats{}
+	}
+	return FilterStats{
+		Hits:   st.filterHits.Load(),
+		Misses: st.filterMisses.Load(),
+	}
+}
+
 // subscribeTopic はトピックをサブスクライブし、登録されたハンドラーにメッセージをルーティング
 // ロックが既に取得された状態で呼び出される内部メソッド
 func (s *Service) subscribeTopic(topic string) error {
-	return s.client.Subscribe(topic, func(t string, payload []byte) {
-		s.handleMessage(t, payload)
-	})
+	handler := func(t string, payload []byte) {
+		s.handleMessage(topic, t, payload)
+	}
+	if qos, ok := s.qos[topic]; ok {
+		return s.client.SubscribeWithQoS(topic, qos, handler)
+	}
+	return s.client.Subscribe(topic, handler)
 }
 
-// handleMessage はメッセージをトピックに登録されたすべてのハンドラーにルーティング
-func (s *Service) handleMessage(topic string, payload []byte) {
+// handleMessage はメッセージをサブスクリプション（トピックフィルター）に登録されたすべてのハンドラーにルーティング
+// ワイルドカードを含むフィルターでは、filterとtopicは異なる値になる
+func (s *Service) handleMessage(filter, topic string, payload []byte) {
+	// 再配信された重複メッセージを破棄
+	// 重なり合うフィルターで同じメッセージを受け取る場合があるため、フィルターごとに判定する
+	if s.dedup != nil && s.dedup.isDuplicateIn(filter, topic, payload) {
+		return
+	}
+
+	// 最後の値を保存（フィルターの結果にかかわらず保存する）
+	s.storeLastValue(topic, payload)
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	// このトピックのすべてのハンドラーを見つける
-	handlers, exists := s.handlers[topic]
+	// このフィルターのすべてのハンドラーを見つける
+	handlers, exists := s.handlers[filter]
 	if !exists {
 		return
 	}
+	st := s.stats[filter]
+	st.messages.Add(1)
+	st.lastMessage.Store(time.Now().UnixNano())
 
 	// 各ハンドラーを別のゴルーチンで呼び出す
-	for _, handler := range handlers {
-		h := handler // ゴルーチン用にコピーを作成
+	for _, sub := range handlers {
+		// 形式として不正なペイロードはハンドラーに渡さない
+		if sub.codec != nil && !sub.codec(topic, payload) {
+			st.codecErrors.Add(1)
+			continue
+		}
+		// フィルターに一致しないメッセージはハンドラーに渡さない
+		if len(sub.filters) > 0 {
+			if !sub.accepts(topic, payload) {
+				st.filterMisses.Add(1)
+				continue
+			}
+			st.filterHits.Add(1)
+		}
+
+		h := sub.handler // ゴルーチン用にコピーを作成
+		s.inflight.Add(1)
 		go func() {
 			defer func() {
 				if r := recover(); r != nil {
+					st.handlerErrors.Add(1)
 					log.Printf("MQTTメッセージハンドラーでパニックから回復: %v", r)
 				}
 			}()
+			defer s.inflight.Add(-1)
 			h(topic, payload)
 		}()
 	}
@@ -129,3 +129,81 @@ func TestServiceStartStop(t *testing.T) {
 		t.Error("Stop()後もクライアントが接続されたまま")
 	}
 }
+
+func TestServiceSubscribeWithQoS(t *testing.T) {
+	client := NewMockClient()
+	service := NewService(client)
+
+	// 開始前に登録したQoSはStart時に使用される
+	if err := service.SubscribeWithQoS("topic/qos0", 0, func(_ string, _ []byte) {}); err != nil {
+		t.Fatalf("SubscribeWithQoS() 失敗: %v", err)
+	}
+	if err := service.Subscribe("topic/default", func(_ string, _ []byte) {}); err != nil {
+		t.Fatalf("Subscribe() 失敗: %v", err)
+	}
+	if err := service.Start(); err != nil {
+		t.Fatalf("Start() 失敗: %v", err)
+	}
+	defer service.Stop()
+
+	if qos, ok := client.GetSubscriptionQoS("topic/qos0"); !ok || qos != 0 {
+		t.Errorf("topic/qos0 のQoS = %d (%t)、期待値は 0", qos, ok)
+	}
+	// QoSを指定しない場合はクライアントの設定を使用する
+	if qos, ok := client.GetSubscriptionQoS("topic/default"); !ok || qos != 1 {
+		t.Errorf("topic/default のQoS = %d (%t)、期待値は 1", qos, ok)
+	}
+
+	// 接続中のQoS変更はサブスクライブし直して反映される
+	if err := service.SetTopicQoS("topic/default", 2); err != nil {
+		t.Fatalf("SetTopicQoS() 失敗: %v", err)
+	}
+	if qos, _ := client.GetSubscriptionQoS("topic/default"); qos != 2 {
+		t.Errorf("変更後のQoS = %d、期待値は 2", qos)
+	}
+	if err := service.SetTopicQoS("topic/unknown", 0); err == nil {
+		t.Error("サブスクライブしていないトピックでエラーが返されませんでした")
+	}
+}
+
+func TestServiceUnsubscribe(t *testing.T) {
+	client := NewMockClient()
+	service := NewService(client)
+	if err := service.Start(); err != nil {
+		t.Fatalf("Start() 失敗: %v", err)
+	}
+	defer service.Stop()
+
+	var mu sync.Mutex
+	received := 0
+	if err := service.Subscribe("topic/a", func(_ string, _ []byte) {
+		mu.Lock()
+		received++
+		mu.Unlock()
+	}); err != nil {
+		t.Fatalf("Subscribe() 失敗: %v", err)
+	}
+
+	if err := service.Unsubscribe("topic/a"); err != nil {
+		t.Fatalf("Unsubscribe() 失敗: %v", err)
+	}
+	if _, ok := client.GetSubscriptionQoS("topic/a"); ok {
+		t.Error("Unsubscribe()後もクライアントのサブスクリプションが残っています")
+	}
+	if _, exists := service.Status().Subscriptions["topic/a"]; exists {
+		t.Error("Unsubscribe()後もサービスのサブスクリプションが残っています")
+	}
+
+	client.SimulateMessage("topic/a", []byte("x"))
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if received != 0 {
+		t.Errorf("Unsubscribe()後にハンドラーが %d 回呼び出されました", received)
+	}
+
+	// サブスクライブしていないトピックは何もしない
+	if err := service.Unsubscribe("topic/none"); err != nil {
+		t.Errorf("Unsubscribe(topic/none) = %v、期待値は nil", err)
+	}
+}
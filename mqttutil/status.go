@@ -0,0 +1,73 @@
+package mqttutil
+
+import "time"
+
+// ConnectionReporter は接続先や再接続回数を報告できるクライアントが実装するインターフェース
+// Clientがこれを実装していない場合、Status()の該当項目はゼロ値になる
+type ConnectionReporter interface {
+	CurrentBroker() string
+	ReconnectCount() uint64
+}
+
+// ServiceStatus はServiceの状態のスナップショット
+type ServiceStatus struct {
+	Connected     bool
+	Broker        string
+	Reconnects    uint64
+	QueueDepth    int64  // 実行中のハンドラー数
+	HandlerErrors uint64 // 全サブスクリプションのハンドラーエラー（パニック）件数
+	Subscriptions map[string]SubscriptionStatus
+}
+
+// SubscriptionStatus はサブスクリプション（トピックフィルター）ごとの状態
+type SubscriptionStatus struct {
+	Handlers      int
+	Messages      uint64
+	LastMessage   time.Time // メッセージ未受信の場合はゼロ値
+	HandlerErrors uint64
+	CodecErrors   uint64 // ペイロードが形式（codec）として不正で破棄した件数（Filterには含まない）
+	Filter        FilterStats
+}
+
+// Healthy はブローカーに接続されているかどうかを返す
+// ライブネスプローブでの利用を想定している
+func (st ServiceStatus) Healthy() bool {
+	return st.Connected
+}
+
+// Status はServiceの現在の状態を返す
+func (s *Service) Status() ServiceStatus {
+	status := ServiceStatus{
+		Connected:  s.client.IsConnected(),
+		QueueDepth: s.inflight.Load(),
+	}
+	if r, ok := s.client.(ConnectionReporter); ok {
+		status.Broker = r.CurrentBroker()
+		status.Reconnects = r.ReconnectCount()
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	status.Subscriptions = make(map[string]SubscriptionStatus, len(s.handlers))
+	for topic, handlers := range s.handlers {
+		st := s.stats[topic]
+		sub := SubscriptionStatus{
+			Handlers:      len(handlers),
+			Messages:      st.messages.Load(),
+			HandlerErrors: st.handlerErrors.Load(),
+			CodecErrors:   st.codecErrors.Load(),
+			Filter: FilterStats{
+				Hits:   st.filterHits.Load(),
+				Misses: st.filterMisses.Load(),
+			},
+		}
+		if last := st.lastMessage.Load(); last != 0 {
+			sub.LastMessage = time.Unix(0, last)
+		}
+		status.HandlerErrors += sub.HandlerErrors
+		status.Subscriptions[topic] = sub
+	}
+
+	return status
+}
@@ -0,0 +1,86 @@
+package mqttutil
+
+import (
+	"testing"
+	"time"
+)
+
+func TestServiceStatus(t *testing.T) {
+	client := NewMockClient()
+	service := NewService(client)
+
+	// 接続前は異常
+	if status := service.Status(); status.Healthy() {
+		t.Error("接続前のStatus().Healthy() = true、期待値はfalse")
+	}
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	if err := service.Subscribe("status/slow", func(_ string, _ []byte) {
+		started <- struct{}{}
+		<-release
+	}); err != nil {
+		t.Fatalf("Subscribe() 失敗: %v", err)
+	}
+	if err := service.Subscribe("status/panic", func(_ string, _ []byte) {
+		panic("テスト用パニック")
+	}); err != nil {
+		t.Fatalf("Subscribe() 失敗: %v", err)
+	}
+
+	if err := service.Start(); err != nil {
+		t.Fatalf("Start() 失敗: %v", err)
+	}
+	defer service.Stop()
+	client.SimulateReconnect()
+
+	before := time.Now()
+	client.SimulateMessage("status/slow", []byte("a"))
+	client.SimulateMessage("status/panic", []byte("b"))
+	client.SimulateMessage("status/panic", []byte("c"))
+	<-started
+
+	// パニックしたハンドラーの回復を待つ
+	deadline := time.Now().Add(time.Second)
+	for service.Status().HandlerErrors < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	status := service.Status()
+	if !status.Healthy() || !status.Connected {
+		t.Error("Start()後のStatus()が接続状態を示していない")
+	}
+	if status.Broker != "mock://localhost" {
+		t.Errorf("Broker = %s、期待値は mock://localhost", status.Broker)
+	}
+	if status.Reconnects != 1 {
+		t.Errorf("Reconnects = %d、期待値は 1", status.Reconnects)
+	}
+	if status.QueueDepth != 1 {
+		t.Errorf("QueueDepth = %d、期待値は 1", status.QueueDepth)
+	}
+	if status.HandlerErrors != 2 {
+		t.Errorf("HandlerErrors = %d、期待値は 2", status.HandlerErrors)
+	}
+
+	slow := status.Subscriptions["status/slow"]
+	if slow.Messages != 1 || slow.Handlers != 1 {
+		t.Errorf("status/slow = %+v、期待値は Messages=1 Handlers=1", slow)
+	}
+	if slow.LastMessage.Before(before) {
+		t.Errorf("LastMessage = %v、期待値は %v 以降", slow.LastMessage, before)
+	}
+	panicked := status.Subscriptions["status/panic"]
+	if panicked.Messages != 2 || panicked.HandlerErrors != 2 {
+		t.Errorf("status/panic = %+v、期待値は Messages=2 HandlerErrors=2", panicked)
+	}
+
+	close(release)
+	deadline = time.Now().Add(time.Second)
+	for service.Status().QueueDepth != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if depth := service.Status().QueueDepth; depth != 0 {
+		t.Errorf("ハンドラー完了後のQueueDepth = %d、期待値は 0", depth)
+	}
+}
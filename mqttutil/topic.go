@@ -0,0 +1,32 @@
+package mqttutil
+
+import "strings"
+
+// TopicMatches はトピックフィルター（+ / # ワイルドカードを含む）が具体的なトピックに一致するかを返す
+func TopicMatches(filter, topic string) bool {
+	if filter == topic {
+		return true
+	}
+
+	// $で始まるトピックは先頭のワイルドカードに一致しない
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+
+	fl := strings.Split(filter, "/")
+	tl := strings.Split(topic, "/")
+	for i, f := range fl {
+		switch {
+		case f == "#":
+			// # は親レベル自体にも一致する（"a/#" は "a" に一致）
+			return i == len(fl)-1
+		case i >= len(tl):
+			return false
+		case f == "+":
+			continue
+		case f != tl[i]:
+			return false
+		}
+	}
+	return len(fl) == len(tl)
+}
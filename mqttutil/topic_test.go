@@ -0,0 +1,31 @@
+package mqttutil
+
+import "testing"
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		filter string
+		topic  string
+		want   bool
+	}{
+		{"sensors/data", "sensors/data", true},
+		{"sensors/data", "sensors/other", false},
+		{"sensors/+", "sensors/data", true},
+		{"sensors/+", "sensors/data/temp", false},
+		{"sensors/+/temp", "sensors/a/temp", true},
+		{"sensors/#", "sensors", true},
+		{"sensors/#", "sensors/a/b/c", true},
+		{"#", "any/topic", true},
+		{"+/+", "a/b", true},
+		{"+/+", "a", false},
+		{"#", "$SYS/broker", false},
+		{"+/broker", "$SYS/broker", false},
+		{"$SYS/#", "$SYS/broker", true},
+	}
+
+	for _, tt := range tests {
+		if got := TopicMatches(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("TopicMatches(%q, %q) = %t、期待値は %t", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}